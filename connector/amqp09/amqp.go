@@ -3,9 +3,11 @@ package amqp09
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/padiazg/notifier/model"
@@ -15,20 +17,43 @@ import (
 )
 
 type PublishOptions struct {
-	Key       string
+	// Key is the routing key, it can be a template rendered against each notification
+	Key string
+	// KeyFunc derives the routing key of each notification, overrides Key
+	KeyFunc KeyFunc
+	// Mandatory asks the broker to return messages it can't route, it enables
+	// Confirm so deliveries wait to find out whether they were returned
 	Mandatory bool
 	Immediate bool
 }
 
 type Config struct {
-	Logger          *log.Logger
-	Name            string
-	QueueName       string
+	Logger    *log.Logger
+	Name      string
+	QueueName string
+	// Address is the server URL, credentials can be given apart with SASL
 	Address         string
 	DeliveryTimeout time.Duration
 	PublishOptions  PublishOptions
-	wrapper         internalWrapperInterface
-	ctx             context.Context
+	Compression     *utils.Compression
+	Reconnect       *ReconnectOptions
+	Topology        *Topology
+	// TLS configures amqps:// connections
+	TLS *utils.TLSOptions
+	// SASL sets the authentication mechanism and credentials
+	SASL *utils.SASL
+	// Persistent publishes messages as persistent so they survive a broker
+	// restart when routed to durable queues
+	Persistent bool
+	// Confirm puts the channel in confirm mode, deliveries succeed once acked by the broker
+	Confirm bool
+	// PoolSize is the number of channels used to publish concurrently, 1 if not set
+	PoolSize int
+	// Workers is the number of notifications delivered concurrently by Run, 1 if not set
+	Workers int
+	OnError func(error)
+	wrapper internalWrapperInterface
+	ctx     context.Context
 }
 
 // AMQPNotifier implements the Notifier interface for message queues
@@ -36,6 +61,16 @@ type AMQPNotifier struct {
 	*Config
 	Channel     chan *model.Notification
 	jsonMarshal func(v any) ([]byte, error)
+	routingKey  KeyFunc
+	keyErr      error
+	lock        sync.RWMutex
+	down        bool
+	done        chan struct{}
+	closeOnce   sync.Once
+	pendingLock sync.Mutex
+	pending     []*model.Notification
+	// gaveUp is set once recovering the connection failed MaxAttempts times
+	gaveUp bool
 }
 
 var _ model.Notifier = (*AMQPNotifier)(nil)
@@ -61,13 +96,19 @@ func (n *AMQPNotifier) New(config *Config) *AMQPNotifier {
 		config.ctx = context.TODO()
 	}
 
+	// returns are only reported to deliveries waiting for confirmation
+	if config.PublishOptions.Mandatory {
+		config.Confirm = true
+	}
+
 	if config.wrapper == nil {
-		config.wrapper = &internalWrapper{}
+		config.wrapper = &internalWrapper{size: config.PoolSize}
 	}
 
 	n.Config = config
 	n.jsonMarshal = json.Marshal
 	n.Channel = make(chan *model.Notification)
+	n.routingKey, n.keyErr = newKeyFunc(config.PublishOptions)
 
 	return n
 }
@@ -85,21 +126,73 @@ func (n *AMQPNotifier) GetChannel() chan *model.Notification {
 }
 
 func (n *AMQPNotifier) Connect() error {
-	var err error
+	if n.keyErr != nil {
+		return n.keyErr
+	}
+
+	if err := n.connect(); err != nil {
+		return err
+	}
+
+	if n.Reconnect != nil {
+		n.done = make(chan struct{})
+		connClose, chanClose := n.notifyClose()
+		go n.watch(connClose, chanClose)
+	}
+
+	return nil
+}
+
+// connect dials the server and sets up the channel
+func (n *AMQPNotifier) connect() error {
+	config, err := n.dialConfig()
+	if err != nil {
+		return fmt.Errorf("configuring connection: %w", err)
+	}
 
-	if err = n.wrapper.Dial(n.Address); err != nil {
+	if err := n.wrapper.Dial(n.Address, config); err != nil {
 		return fmt.Errorf("dialing AMQP server: %w", err)
 	}
 
-	if err = n.wrapper.Channel(); err != nil {
+	// don't leak the connection, recover dials a new one on every attempt
+	if err := n.setupChannel(); err != nil {
+		_ = n.wrapper.CloseConn()
+		return err
+	}
+
+	return nil
+}
+
+// setupChannel opens the channel used to publish and declares the topology
+func (n *AMQPNotifier) setupChannel() error {
+	if err := n.wrapper.Channel(); err != nil {
 		return fmt.Errorf("creating channel: %w", err)
 	}
 
+	if err := n.declare(); err != nil {
+		return err
+	}
+
+	if n.Confirm {
+		if err := n.wrapper.Confirm(false); err != nil {
+			return fmt.Errorf("enabling publisher confirms: %w", err)
+		}
+	}
+
+	if n.PublishOptions.Mandatory {
+		n.wrapper.SetReturnHandler(n.handleReturn)
+	}
+
 	return nil
 }
 
 func (n *AMQPNotifier) Close() error {
 	if n.wrapper != nil {
+		// stop recovering the connection before closing it
+		if n.done != nil {
+			n.closeOnce.Do(func() { close(n.done) })
+		}
+
 		return n.wrapper.CloseConn()
 	}
 
@@ -107,12 +200,30 @@ func (n *AMQPNotifier) Close() error {
 }
 
 func (n *AMQPNotifier) Run() {
-	for notification := range n.Channel {
-		r := n.Deliver(notification)
-		if !r.Success {
-			n.Logger.Printf("%s: %+v", n.Name(), r)
-		}
+	var (
+		wg      sync.WaitGroup
+		workers = n.Workers
+	)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for notification := range n.Channel {
+				r := n.Deliver(notification)
+				if !r.Success {
+					n.Logger.Printf("%s: %+v", n.Name(), r)
+				}
+			}
+		}()
 	}
+
+	wg.Wait()
 }
 
 func (n *AMQPNotifier) Notify(payload *model.Notification) {
@@ -137,25 +248,56 @@ func (n *AMQPNotifier) Deliver(message *model.Notification) *model.Result {
 
 	defer cancel()
 
+	if n.keyErr != nil {
+		return &model.Result{Success: false, Error: n.keyErr}
+	}
+
+	key, err := n.routingKey(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("rendering routing key: %w", err)}
+	}
+
 	// Serialize the notification data to JSON
 	payload, err := n.jsonMarshal(message)
 	if err != nil {
 		return &model.Result{Success: false, Error: err}
 	}
 
-	err = n.wrapper.PublishWithContext(ctx,
-		n.QueueName,                       // exchange
-		n.Config.PublishOptions.Key,       // routing key
-		n.Config.PublishOptions.Mandatory, // mandatory
-		n.Config.PublishOptions.Immediate, // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        payload,
-		})
+	payload, encoding, err := n.Compression.Compress(payload)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("compressing payload: %w", err)}
+	}
+
+	msg := amqp.Publishing{
+		ContentType:     "application/json",
+		ContentEncoding: encoding,
+		Body:            payload,
+	}
+
+	setProperties(&msg, message)
+
+	if n.Persistent {
+		msg.DeliveryMode = amqp.Persistent
+	}
+
+	// returns are matched to the publishing by its id
+	if n.PublishOptions.Mandatory && msg.MessageId == "" {
+		msg.MessageId = utils.RandomId(utils.ID12)
+	}
+
+	conf, err := n.publish(ctx, key, msg)
+	if errors.Is(err, ErrNotConnected) {
+		return n.buffer(message)
+	}
+
 	if err != nil {
 		return &model.Result{Success: false, Error: fmt.Errorf("sending message: %v", err)}
 	}
 
+	if conf != nil {
+		return n.confirmed(ctx, conf)
+	}
+
 	select {
 	case <-ctx.Done():
 		if ctx.Err() == context.DeadlineExceeded {
@@ -166,3 +308,72 @@ func (n *AMQPNotifier) Deliver(message *model.Notification) *model.Result {
 		return &model.Result{Success: true}
 	}
 }
+
+// publish sends the message unless the connection is being recovered, in
+// confirm mode it returns the confirmation to wait for
+func (n *AMQPNotifier) publish(ctx context.Context, key string, msg amqp.Publishing) (confirmation, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.down {
+		return nil, ErrNotConnected
+	}
+
+	if !n.Confirm {
+		return nil, n.wrapper.PublishWithContext(ctx,
+			n.QueueName,                       // exchange
+			key,                               // routing key
+			n.Config.PublishOptions.Mandatory, // mandatory
+			n.Config.PublishOptions.Immediate, // immediate
+			msg)
+	}
+
+	conf, err := n.wrapper.PublishWithDeferredConfirmWithContext(ctx,
+		n.QueueName,                       // exchange
+		key,                               // routing key
+		n.Config.PublishOptions.Mandatory, // mandatory
+		n.Config.PublishOptions.Immediate, // immediate
+		msg)
+	if err == nil && conf == nil {
+		err = fmt.Errorf("channel is not in confirm mode")
+	}
+
+	return conf, err
+}
+
+// confirmed waits for the broker to ack the publishing
+func (n *AMQPNotifier) confirmed(ctx context.Context, conf confirmation) *model.Result {
+	acked, err := conf.WaitContext(ctx)
+	if err != nil {
+		conf.Forget()
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			return &model.Result{Success: false, Error: fmt.Errorf("message delivery timed out")}
+		}
+		return &model.Result{Success: false, Error: fmt.Errorf("waiting for confirmation: %w", err)}
+	}
+
+	if r := conf.Returned(); r != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("message returned by broker: %d %s", r.ReplyCode, r.ReplyText)}
+	}
+
+	if !acked {
+		return &model.Result{Success: false, Error: fmt.Errorf("message nacked by broker")}
+	}
+
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+// handleReturn reports returned messages no delivery is waiting for anymore
+func (n *AMQPNotifier) handleReturn(r amqp.Return) {
+	n.handleError(fmt.Errorf("%s: message %s returned by broker: %d %s", n.Name(), r.MessageId, r.ReplyCode, r.ReplyText))
+}
+
+// handleError reports an error through the logger and the OnError hook
+func (n *AMQPNotifier) handleError(err error) {
+	n.Logger.Print(err)
+
+	if n.OnError != nil {
+		n.OnError(err)
+	}
+}
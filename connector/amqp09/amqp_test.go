@@ -7,10 +7,12 @@ import (
 	"log"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,12 +20,16 @@ import (
 
 type MockInternalWrapper struct {
 	mock.Mock
-	Config *Config
-	wait   time.Duration
+	Config    *Config
+	wait      time.Duration
+	lock      sync.Mutex
+	connClose chan *amqp.Error
+	chanClose chan *amqp.Error
+	notified  int
 }
 
-func (m *MockInternalWrapper) Dial(url string) error {
-	args := m.Called(url)
+func (m *MockInternalWrapper) Dial(url string, config *amqp.Config) error {
+	args := m.Called(url, config)
 	return args.Error(0)
 }
 
@@ -52,6 +58,78 @@ func (m *MockInternalWrapper) PublishWithContext(ctx context.Context, exchange s
 	return args.Error(0)
 }
 
+func (m *MockInternalWrapper) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	m.Called(receiver)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.connClose = receiver
+	m.notified++
+	return receiver
+}
+
+func (m *MockInternalWrapper) NotifyChannelClose(receiver chan *amqp.Error) chan *amqp.Error {
+	m.Called(receiver)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.chanClose = receiver
+	return receiver
+}
+
+func (m *MockInternalWrapper) Confirm(noWait bool) error {
+	args := m.Called(noWait)
+	return args.Error(0)
+}
+
+func (m *MockInternalWrapper) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) (confirmation, error) {
+	args := m.Called(ctx, exchange, key, mandatory, immediate, msg)
+	conf, _ := args.Get(0).(confirmation)
+	return conf, args.Error(1)
+}
+
+func (m *MockInternalWrapper) SetReturnHandler(handler func(amqp.Return)) {
+	m.Called(handler)
+}
+
+func (m *MockInternalWrapper) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	a := m.Called(name, kind, durable, autoDelete, internal, noWait, args)
+	return a.Error(0)
+}
+
+func (m *MockInternalWrapper) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) error {
+	a := m.Called(name, durable, autoDelete, exclusive, noWait, args)
+	return a.Error(0)
+}
+
+func (m *MockInternalWrapper) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	a := m.Called(name, key, exchange, noWait, args)
+	return a.Error(0)
+}
+
+type mockConfirmation struct {
+	acked     bool
+	err       error
+	returned  *amqp.Return
+	wait      time.Duration
+	forgotten bool
+}
+
+func (c *mockConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(c.wait):
+		return c.acked, c.err
+	}
+}
+
+func (c *mockConfirmation) Returned() *amqp.Return {
+	return c.returned
+}
+
+func (c *mockConfirmation) Forget() {
+	c.forgotten = true
+}
+
 func checkName(name string) model.TestCheckNotifierFn {
 	return func(t *testing.T, np model.Notifier) {
 		t.Helper()
@@ -206,13 +284,14 @@ func TestAMQPNotifier_Connect(t *testing.T) {
 		tests = []struct {
 			name       string
 			wantErrMsg string
+			wantCloses int
 			before     func(n *AMQPNotifier)
 		}{
 			{
 				name: "success",
 				before: func(n *AMQPNotifier) {
 					w := n.wrapper.(*MockInternalWrapper)
-					w.On("Dial", "amqp://example.com").Return(nil)
+					w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
 					w.On("Channel").Return(nil)
 				},
 				wantErrMsg: "",
@@ -221,7 +300,7 @@ func TestAMQPNotifier_Connect(t *testing.T) {
 				name: "fail-Dial",
 				before: func(n *AMQPNotifier) {
 					w := n.wrapper.(*MockInternalWrapper)
-					w.On("Dial", "amqp://example.com").Return(fmt.Errorf("test-Dial-error"))
+					w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(fmt.Errorf("test-Dial-error"))
 					w.On("Channel").Return(nil)
 				},
 				wantErrMsg: "dialing AMQP server:",
@@ -230,10 +309,40 @@ func TestAMQPNotifier_Connect(t *testing.T) {
 				name: "fail-Channel",
 				before: func(n *AMQPNotifier) {
 					w := n.wrapper.(*MockInternalWrapper)
-					w.On("Dial", "amqp://example.com").Return(nil)
+					w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
 					w.On("Channel").Return(fmt.Errorf("test-Dial-error"))
+					w.On("CloseConn").Return(nil)
 				},
 				wantErrMsg: "creating channel:",
+				wantCloses: 1,
+			},
+			{
+				name: "success-confirm-mandatory",
+				before: func(n *AMQPNotifier) {
+					n.Confirm = true
+					n.PublishOptions.Mandatory = true
+
+					w := n.wrapper.(*MockInternalWrapper)
+					w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+					w.On("Channel").Return(nil)
+					w.On("Confirm", false).Return(nil)
+					w.On("SetReturnHandler", mock.Anything).Return()
+				},
+				wantErrMsg: "",
+			},
+			{
+				name: "fail-Confirm",
+				before: func(n *AMQPNotifier) {
+					n.Confirm = true
+
+					w := n.wrapper.(*MockInternalWrapper)
+					w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+					w.On("Channel").Return(nil)
+					w.On("Confirm", false).Return(fmt.Errorf("test-Confirm-error"))
+					w.On("CloseConn").Return(nil)
+				},
+				wantErrMsg: "enabling publisher confirms: test-Confirm-error",
+				wantCloses: 1,
 			},
 		}
 	)
@@ -261,6 +370,8 @@ func TestAMQPNotifier_Connect(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
+
+			n.wrapper.(*MockInternalWrapper).AssertNumberOfCalls(t, "CloseConn", tt.wantCloses)
 		})
 	}
 }
@@ -659,6 +770,52 @@ func TestAMQPNotifier_Deliver(t *testing.T) {
 					model.CheckResultError("test-jsonMarshal-error"),
 				},
 			},
+			{
+				name: "success-compressed",
+				before: func(n *AMQPNotifier) {
+					var (
+						payload = []byte("test")
+						w       = n.wrapper.(*MockInternalWrapper)
+					)
+
+					n.jsonMarshal = func(v any) ([]byte, error) {
+						return payload, nil
+					}
+
+					n.Compression = &utils.Compression{Encoding: utils.EncodingGzip}
+
+					w.On(
+						"PublishWithContext",
+						mock.Anything,
+						queueName, // exchange
+						"",        // routing key
+						false,     // mandatory
+						false,     // immediate
+						mock.MatchedBy(func(msg amqp.Publishing) bool {
+							plain, err := utils.Decompress(msg.ContentEncoding, msg.Body)
+							return msg.ContentEncoding == utils.EncodingGzip && err == nil && string(plain) == "test"
+						}),
+					).
+						Return(nil)
+				},
+				checks: []model.TestCheckResultFn{
+					model.CheckResultError(""),
+					checkSuccess,
+				},
+			},
+			{
+				name: "fail-compress",
+				before: func(n *AMQPNotifier) {
+					n.jsonMarshal = func(v any) ([]byte, error) {
+						return []byte("test"), nil
+					}
+
+					n.Compression = &utils.Compression{Encoding: "br"}
+				},
+				checks: []model.TestCheckResultFn{
+					model.CheckResultError("compressing payload:"),
+				},
+			},
 			{
 				name: "fail-Send",
 				before: func(n *AMQPNotifier) {
@@ -0,0 +1,60 @@
+package amqp09
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/padiazg/notifier/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// anonymousAuth authenticates with the ANONYMOUS mechanism
+type anonymousAuth struct{}
+
+func (*anonymousAuth) Mechanism() string {
+	return utils.SASLAnonymous
+}
+
+func (*anonymousAuth) Response() string {
+	return ""
+}
+
+// dialConfig builds the connection config from the TLS and SASL options, nil
+// when none is set so the address is dialed as is
+func (n *AMQPNotifier) dialConfig() (*amqp.Config, error) {
+	if n.TLS == nil && n.SASL == nil {
+		return nil, nil
+	}
+
+	tlsConfig, err := n.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	// same defaults used by amqp.Dial
+	config := &amqp.Config{
+		Heartbeat:       10 * time.Second,
+		Locale:          "en_US",
+		TLSClientConfig: tlsConfig,
+	}
+
+	if n.SASL != nil {
+		mechanism, username, password, err := n.SASL.Credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		switch mechanism {
+		case utils.SASLPlain:
+			config.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: username, Password: password}}
+		case utils.SASLExternal:
+			config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+		case utils.SASLAnonymous:
+			config.SASL = []amqp.Authentication{&anonymousAuth{}}
+		default:
+			return nil, fmt.Errorf("unsupported SASL mechanism %q", mechanism)
+		}
+	}
+
+	return config, nil
+}
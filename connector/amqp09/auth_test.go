@@ -0,0 +1,114 @@
+package amqp09
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAMQPNotifier_dialConfig(t *testing.T) {
+	t.Setenv("NOTIFIER_TEST_PASSWORD", "secret")
+
+	tests := []struct {
+		name          string
+		tls           *utils.TLSOptions
+		sasl          *utils.SASL
+		wantNil       bool
+		wantMechanism string
+		wantResponse  string
+		wantErrMsg    string
+	}{
+		{
+			name:    "none",
+			wantNil: true,
+		},
+		{
+			name: "tls",
+			tls:  &utils.TLSOptions{ServerName: "broker.internal"},
+		},
+		{
+			name: "plain",
+			sasl: &utils.SASL{
+				Username: utils.Secret{Value: "guest"},
+				Password: utils.Secret{Env: "NOTIFIER_TEST_PASSWORD"},
+			},
+			wantMechanism: "PLAIN",
+			wantResponse:  "\000guest\000secret",
+		},
+		{
+			name:          "external",
+			tls:           &utils.TLSOptions{},
+			sasl:          &utils.SASL{Mechanism: utils.SASLExternal},
+			wantMechanism: "EXTERNAL",
+			wantResponse:  "\000*\000*",
+		},
+		{
+			name:          "anonymous",
+			sasl:          &utils.SASL{Mechanism: utils.SASLAnonymous},
+			wantMechanism: "ANONYMOUS",
+		},
+		{
+			name:       "fail-tls",
+			tls:        &utils.TLSOptions{CAFile: "testdata/missing.pem"},
+			wantErrMsg: "reading CA file",
+		},
+		{
+			name:       "fail-sasl",
+			sasl:       &utils.SASL{Password: utils.Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wantErrMsg: "resolving password",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(&Config{TLS: tt.tls, SASL: tt.sasl, wrapper: &MockInternalWrapper{}})
+
+			got, err := n.dialConfig()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.Equal(t, 10*time.Second, got.Heartbeat)
+			assert.Equal(t, tt.tls != nil, got.TLSClientConfig != nil)
+
+			if tt.wantMechanism == "" {
+				assert.Nil(t, got.SASL)
+				return
+			}
+
+			if assert.Len(t, got.SASL, 1) {
+				assert.Equal(t, tt.wantMechanism, got.SASL[0].Mechanism())
+				assert.Equal(t, tt.wantResponse, got.SASL[0].Response())
+			}
+		})
+	}
+}
+
+func TestAMQPNotifier_ConnectAuth(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = &MockInternalWrapper{}
+		n   = New(&Config{
+			Address: "amqps://broker.internal",
+			SASL:    &utils.SASL{Username: utils.Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wrapper: w,
+			Logger:  log.New(&buf, "test-logger", log.LstdFlags),
+		})
+	)
+
+	assert.ErrorContains(t, n.Connect(), "configuring connection: resolving username")
+	w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything)
+}
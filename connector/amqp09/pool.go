@@ -0,0 +1,255 @@
+package amqp09
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// errPoolClosed is reported when publishing on a pool being replaced or closed
+var errPoolClosed = errors.New("channel pool closed")
+
+// amqpChannel is the part of *amqp.Channel used by the pool
+type amqpChannel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
+	Confirm(noWait bool) error
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Close() error
+}
+
+// pooledChannel is a slot of the pool, its channel is replaced when closed
+// by the server. The lock is held while the channel is in use
+type pooledChannel struct {
+	lock    sync.Mutex
+	channel amqpChannel
+	returns *returnTracker
+}
+
+// channelPool holds the channels used to publish concurrently over a single
+// connection, each publisher takes a channel for itself until done with it
+type channelPool struct {
+	lock      sync.Mutex
+	open      func() (amqpChannel, error)
+	slots     []*pooledChannel
+	free      chan *pooledChannel
+	done      chan struct{}
+	confirm   bool
+	handler   func(amqp.Return)
+	listeners []chan *amqp.Error
+}
+
+// newChannelPool opens size channels, at least one
+func newChannelPool(size int, open func() (amqpChannel, error)) (*channelPool, error) {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &channelPool{
+		open:  open,
+		slots: make([]*pooledChannel, size),
+		free:  make(chan *pooledChannel, size),
+		done:  make(chan struct{}),
+	}
+
+	for i := range p.slots {
+		slot := &pooledChannel{}
+		if err := p.setup(slot); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+
+		p.slots[i] = slot
+		p.free <- slot
+	}
+
+	return p, nil
+}
+
+// setup opens a channel for the slot with the settings of the pool
+func (p *channelPool) setup(slot *pooledChannel) error {
+	ch, err := p.open()
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	confirm, handler := p.confirm, p.handler
+	p.lock.Unlock()
+
+	if confirm {
+		if err := ch.Confirm(false); err != nil {
+			_ = ch.Close()
+			return fmt.Errorf("enabling publisher confirms: %w", err)
+		}
+	}
+
+	returns := newReturnTracker(confirm)
+	returns.SetHandler(handler)
+	ch.NotifyReturn(returns.returns)
+	go returns.Run()
+
+	slot.channel, slot.returns = ch, returns
+	go p.watch(slot, ch.NotifyClose(make(chan *amqp.Error, 1)))
+
+	return nil
+}
+
+// watch replaces the channel of the slot when closed by the server, if it
+// can't be replaced the listeners are notified
+func (p *channelPool) watch(slot *pooledChannel, closed chan *amqp.Error) {
+	cause, ok := <-closed
+	if !ok || p.closing() {
+		return
+	}
+
+	slot.lock.Lock()
+	err := p.setup(slot)
+	slot.lock.Unlock()
+
+	if err != nil {
+		p.notify(cause)
+	}
+}
+
+// notify reports a channel that couldn't be replaced to the listeners, which
+// are notified once like with amqp.Channel.NotifyClose
+func (p *channelPool) notify(cause *amqp.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, l := range p.listeners {
+		l <- cause
+		close(l)
+	}
+
+	p.listeners = nil
+}
+
+// NotifyClose registers a listener for channels that couldn't be replaced
+func (p *channelPool) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.listeners = append(p.listeners, receiver)
+
+	return receiver
+}
+
+// Confirm puts every channel in confirm mode, channels opened later too
+func (p *channelPool) Confirm(noWait bool) error {
+	p.lock.Lock()
+	p.confirm = true
+	p.lock.Unlock()
+
+	for _, slot := range p.slots {
+		slot.lock.Lock()
+		err := slot.channel.Confirm(noWait)
+		if err == nil {
+			slot.returns.lock.Lock()
+			slot.returns.claim = true
+			slot.returns.lock.Unlock()
+		}
+		slot.lock.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetReturnHandler sets the function receiving unclaimed returns of every channel
+func (p *channelPool) SetReturnHandler(handler func(amqp.Return)) {
+	p.lock.Lock()
+	p.handler = handler
+	p.lock.Unlock()
+
+	for _, slot := range p.slots {
+		slot.lock.Lock()
+		slot.returns.SetHandler(handler)
+		slot.lock.Unlock()
+	}
+}
+
+// acquire takes a free channel, waiting for one until ctx is done
+func (p *channelPool) acquire(ctx context.Context) (*pooledChannel, error) {
+	select {
+	case <-p.done:
+		return nil, errPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case slot := <-p.free:
+		slot.lock.Lock()
+
+		// the pool was closed while waiting
+		if p.closing() {
+			p.release(slot)
+			return nil, errPoolClosed
+		}
+
+		return slot, nil
+	}
+}
+
+func (p *channelPool) release(slot *pooledChannel) {
+	slot.lock.Unlock()
+	p.free <- slot
+}
+
+// Do runs fn with a channel of the pool
+func (p *channelPool) Do(ctx context.Context, fn func(slot *pooledChannel) error) error {
+	slot, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer p.release(slot)
+
+	return fn(slot)
+}
+
+// Close closes every channel, a pool can't be used after closed
+func (p *channelPool) Close() error {
+	p.lock.Lock()
+	if p.closing() {
+		p.lock.Unlock()
+		return nil
+	}
+	close(p.done)
+	p.lock.Unlock()
+
+	var errs []error
+	for _, slot := range p.slots {
+		if slot == nil {
+			continue
+		}
+
+		slot.lock.Lock()
+		if slot.channel != nil {
+			if err := slot.channel.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		slot.lock.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *channelPool) closing() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
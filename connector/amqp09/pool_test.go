@@ -0,0 +1,327 @@
+package amqp09
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeChannel records the calls made by the pool
+type fakeChannel struct {
+	lock       sync.Mutex
+	id         int
+	confirm    bool
+	confirmErr error
+	published  []string
+	closed     bool
+	closeChan  chan *amqp.Error
+	returnChan chan amqp.Return
+}
+
+func (c *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.published = append(c.published, msg.MessageId)
+	return nil
+}
+
+func (c *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	return nil, c.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.confirm = c.confirmErr == nil
+	return c.confirmErr
+}
+
+func (c *fakeChannel) NotifyReturn(ch chan amqp.Return) chan amqp.Return {
+	c.returnChan = ch
+	return ch
+}
+
+func (c *fakeChannel) NotifyClose(ch chan *amqp.Error) chan *amqp.Error {
+	c.closeChan = ch
+	return ch
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.closeChan)
+		close(c.returnChan)
+	}
+
+	return nil
+}
+
+// kill closes the channel like the server does, with an error
+func (c *fakeChannel) kill(cause *amqp.Error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+	c.closeChan <- cause
+	close(c.closeChan)
+	close(c.returnChan)
+}
+
+func (c *fakeChannel) isConfirm() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.confirm
+}
+
+// fakeOpener opens fake channels, failing once the given number was opened
+type fakeOpener struct {
+	lock     sync.Mutex
+	channels []*fakeChannel
+	limit    int
+}
+
+func (o *fakeOpener) open() (amqpChannel, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.limit > 0 && len(o.channels) >= o.limit {
+		return nil, fmt.Errorf("test-Channel-error")
+	}
+
+	ch := &fakeChannel{id: len(o.channels)}
+	o.channels = append(o.channels, ch)
+
+	return ch, nil
+}
+
+func (o *fakeOpener) opened() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return len(o.channels)
+}
+
+func (o *fakeOpener) channel(i int) *fakeChannel {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.channels[i]
+}
+
+func TestNewChannelPool(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		limit      int
+		wantOpened int
+		wantErrMsg string
+	}{
+		{name: "default-size", size: 0, wantOpened: 1},
+		{name: "size", size: 4, wantOpened: 4},
+		{name: "fail-open", size: 4, limit: 2, wantOpened: 2, wantErrMsg: "test-Channel-error"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			opener := &fakeOpener{limit: tt.limit}
+
+			p, err := newChannelPool(tt.size, opener.open)
+			assert.Equal(t, tt.wantOpened, opener.opened())
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				for _, ch := range opener.channels {
+					assert.True(t, ch.closed, "channel opened before the error not closed")
+				}
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Len(t, p.free, tt.wantOpened)
+				assert.NoError(t, p.Close())
+			}
+		})
+	}
+}
+
+func TestChannelPool_Do(t *testing.T) {
+	var (
+		opener = &fakeOpener{}
+		p, _   = newChannelPool(2, opener.open)
+		wg     sync.WaitGroup
+		inUse  = make(chan struct{})
+		hold   = make(chan struct{})
+	)
+
+	// both channels in use
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = p.Do(context.TODO(), func(slot *pooledChannel) error {
+				inUse <- struct{}{}
+				<-hold
+				return slot.channel.PublishWithContext(context.TODO(), "", "", false, false, amqp.Publishing{})
+			})
+		}()
+	}
+
+	<-inUse
+	<-inUse
+
+	// a third publisher waits for a free channel
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Do(ctx, func(*pooledChannel) error { return nil }), context.DeadlineExceeded)
+
+	close(hold)
+	wg.Wait()
+
+	// each publisher got its own channel
+	assert.Len(t, opener.channel(0).published, 1)
+	assert.Len(t, opener.channel(1).published, 1)
+
+	assert.NoError(t, p.Close())
+	assert.NoError(t, p.Close())
+	assert.ErrorIs(t, p.Do(context.TODO(), func(*pooledChannel) error { return nil }), errPoolClosed)
+}
+
+func TestChannelPool_replace(t *testing.T) {
+	var (
+		opener  = &fakeOpener{}
+		p, _    = newChannelPool(2, opener.open)
+		handled = make(chan amqp.Return, 1)
+	)
+
+	assert.NoError(t, p.Confirm(false))
+	p.SetReturnHandler(func(r amqp.Return) { handled <- r })
+
+	// the server closes one of the channels
+	opener.channel(1).kill(&amqp.Error{Code: amqp.PreconditionFailed, Reason: "test-close"})
+
+	assert.Eventually(t, func() bool { return opener.opened() == 3 }, time.Second, time.Millisecond,
+		"closed channel not replaced")
+
+	// only the closed channel is replaced, with the settings of the pool
+	replaced := opener.channel(2)
+	assert.Eventually(t, replaced.isConfirm, time.Second, time.Millisecond, "replaced channel not in confirm mode")
+	assert.False(t, opener.channel(0).closed)
+
+	slots := map[amqpChannel]bool{}
+	for _, slot := range p.slots {
+		slot.lock.Lock()
+		slots[slot.channel] = true
+		slot.lock.Unlock()
+	}
+	assert.Equal(t, map[amqpChannel]bool{opener.channel(0): true, replaced: true}, slots)
+
+	assert.NoError(t, p.Close())
+}
+
+func TestChannelPool_replaceFailed(t *testing.T) {
+	var (
+		opener = &fakeOpener{limit: 2}
+		p, _   = newChannelPool(2, opener.open)
+		closed = p.NotifyClose(make(chan *amqp.Error, 1))
+		cause  = &amqp.Error{Code: amqp.ChannelError, Reason: "test-close"}
+	)
+
+	opener.channel(0).kill(cause)
+
+	select {
+	case got := <-closed:
+		assert.Equal(t, cause, got)
+	case <-time.After(time.Second):
+		t.Fatal("listener not notified")
+	}
+
+	_, ok := <-closed
+	assert.False(t, ok, "listener not closed after notified")
+
+	assert.NoError(t, p.Close())
+}
+
+func TestChannelPool_Confirm(t *testing.T) {
+	var (
+		opener = &fakeOpener{}
+		p, _   = newChannelPool(2, opener.open)
+	)
+
+	opener.channel(1).confirmErr = fmt.Errorf("test-Confirm-error")
+
+	assert.ErrorContains(t, p.Confirm(false), "test-Confirm-error")
+	assert.True(t, opener.channel(0).isConfirm())
+	assert.True(t, p.slots[0].returns.claim)
+
+	assert.NoError(t, p.Close())
+}
+
+func TestAMQPNotifier_RunWorkers(t *testing.T) {
+	var (
+		w       = &MockInternalWrapper{}
+		n       = New(&Config{QueueName: "test", Workers: 3, DeliveryTimeout: 1000, wrapper: w})
+		release = make(chan struct{})
+		running sync.WaitGroup
+		done    = make(chan struct{})
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	// deliveries block until all the workers are publishing
+	running.Add(3)
+	w.On("PublishWithContext", mock.Anything, "test", "", false, false, mock.Anything).
+		Run(func(args mock.Arguments) {
+			running.Done()
+			<-release
+		}).
+		Return(nil)
+
+	go func() {
+		n.Run()
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		go n.Notify(&model.Notification{Data: "test"})
+	}
+
+	running.Wait()
+	close(release)
+	close(n.Channel)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after the channel was closed")
+	}
+
+	w.AssertNumberOfCalls(t, "PublishWithContext", 3)
+}
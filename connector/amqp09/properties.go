@@ -0,0 +1,22 @@
+package amqp09
+
+import (
+	"github.com/padiazg/notifier/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// setProperties maps the notification metadata to the publishing properties
+// and headers so consumers can route and filter without parsing the body
+func setProperties(msg *amqp.Publishing, message *model.Notification) {
+	msg.MessageId = message.ID
+	msg.Type = string(message.Event)
+	msg.Timestamp = message.Timestamp
+	msg.CorrelationId = message.CorrelationID
+
+	if len(message.Metadata) > 0 {
+		msg.Headers = make(amqp.Table, len(message.Metadata))
+		for k, v := range message.Metadata {
+			msg.Headers[k] = v
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package amqp09
+
+import (
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetProperties(t *testing.T) {
+	var (
+		timestamp = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		tests = []struct {
+			name    string
+			message *model.Notification
+			want    amqp.Publishing
+		}{
+			{
+				name:    "empty",
+				message: &model.Notification{Data: "test"},
+				want:    amqp.Publishing{ContentType: "application/json"},
+			},
+			{
+				name: "all",
+				message: &model.Notification{
+					ID:            "abc",
+					Event:         "orders.created",
+					Timestamp:     timestamp,
+					CorrelationID: "req-1",
+					Metadata:      map[string]string{"tenant": "acme", "region": "eu"},
+				},
+				want: amqp.Publishing{
+					ContentType:   "application/json",
+					MessageId:     "abc",
+					Type:          "orders.created",
+					Timestamp:     timestamp,
+					CorrelationId: "req-1",
+					Headers:       amqp.Table{"tenant": "acme", "region": "eu"},
+				},
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			msg := amqp.Publishing{ContentType: "application/json"}
+			setProperties(&msg, tt.message)
+			assert.Equal(t, tt.want, msg)
+			assert.NoError(t, msg.Headers.Validate())
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverPersistent(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			QueueName:       "test",
+			Persistent:      true,
+			DeliveryTimeout: 30,
+			wrapper:         w,
+		})
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	w.On("PublishWithContext", mock.Anything, "test", "", false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte("test"),
+	}).Return(nil)
+
+	r := n.Deliver(&model.Notification{Data: "test"})
+	assert.NoError(t, r.Error)
+	assert.True(t, r.Success)
+	// published without confirm mode
+	assert.False(t, r.Acknowledged)
+	w.AssertExpectations(t)
+}
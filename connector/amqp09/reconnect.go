@@ -0,0 +1,200 @@
+package amqp09
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrNotConnected is reported for notifications delivered while the connection is down
+	ErrNotConnected = errors.New("not connected to AMQP server")
+	// ErrBuffered is reported for notifications kept until the connection is recovered
+	ErrBuffered = errors.New("notification buffered until the connection is recovered")
+)
+
+// ReconnectOptions enables the recovery of the connection and channel when
+// they are closed by the server
+type ReconnectOptions struct {
+	// InitialInterval is the wait before the first attempt, doubled after each failure
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between attempts
+	MaxInterval time.Duration
+	// MaxAttempts gives up after the given number of failed attempts, 0 retries forever
+	MaxAttempts int
+	// BufferSize is how many notifications are kept while disconnected to be
+	// delivered after recovering, when 0 or full notifications are failed
+	BufferSize int
+}
+
+// notifyClose registers to be notified when the connection or the channel are closed
+func (n *AMQPNotifier) notifyClose() (chan *amqp.Error, chan *amqp.Error) {
+	var (
+		connClose = n.wrapper.NotifyClose(make(chan *amqp.Error, 1))
+		chanClose = n.wrapper.NotifyChannelClose(make(chan *amqp.Error, 1))
+	)
+
+	return connClose, chanClose
+}
+
+// watch waits for the connection or the channel to be closed and recovers them
+func (n *AMQPNotifier) watch(connClose, chanClose chan *amqp.Error) {
+	for {
+		var (
+			cause    *amqp.Error
+			connLost bool
+		)
+
+		select {
+		case <-n.done:
+			return
+		case cause = <-connClose:
+			connLost = true
+		case cause = <-chanClose:
+		}
+
+		// closed by Close
+		if n.closing() {
+			return
+		}
+
+		if !n.recover(connLost, cause) {
+			return
+		}
+
+		connClose, chanClose = n.notifyClose()
+	}
+}
+
+// recover re-creates the channel, or the whole connection if it was lost,
+// retrying with backoff until it succeeds or MaxAttempts is reached
+func (n *AMQPNotifier) recover(connLost bool, cause *amqp.Error) bool {
+	var (
+		backoff = &utils.Backoff{
+			Initial: n.Reconnect.InitialInterval,
+			Max:     n.Reconnect.MaxInterval,
+		}
+		what = "channel"
+	)
+
+	if connLost {
+		what = "connection"
+	}
+
+	n.setDown(true)
+
+	if cause != nil {
+		n.handleError(fmt.Errorf("%s: %s closed: %v", n.Name(), what, cause))
+	} else {
+		n.handleError(fmt.Errorf("%s: %s closed", n.Name(), what))
+	}
+
+	for {
+		if n.Reconnect.MaxAttempts > 0 && backoff.Attempts() >= n.Reconnect.MaxAttempts {
+			n.handleError(fmt.Errorf("%s: giving up reconnecting after %d attempts", n.Name(), backoff.Attempts()))
+			n.giveUp()
+			return false
+		}
+
+		timer := time.NewTimer(backoff.Next())
+		select {
+		case <-n.done:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		// try to keep the connection when only the channel was closed
+		if !connLost {
+			if err := n.setupChannel(); err == nil {
+				break
+			}
+
+			connLost = true
+		}
+
+		err := n.connect()
+		if err == nil {
+			break
+		}
+
+		n.handleError(fmt.Errorf("%s: reconnecting, attempt %d: %w", n.Name(), backoff.Attempts(), err))
+	}
+
+	n.setDown(false)
+	n.Logger.Printf("%s: %s recovered", n.Name(), what)
+	n.flush()
+
+	return true
+}
+
+// buffer keeps a notification delivered while disconnected
+func (n *AMQPNotifier) buffer(message *model.Notification) *model.Result {
+	if n.Reconnect == nil || n.Reconnect.BufferSize == 0 {
+		return &model.Result{Success: false, Error: ErrNotConnected}
+	}
+
+	n.pendingLock.Lock()
+	defer n.pendingLock.Unlock()
+
+	if n.gaveUp {
+		return &model.Result{Success: false, Error: ErrNotConnected}
+	}
+
+	if len(n.pending) >= n.Reconnect.BufferSize {
+		return &model.Result{Success: false, Error: fmt.Errorf("%w: buffer is full", ErrNotConnected)}
+	}
+
+	n.pending = append(n.pending, message)
+
+	return &model.Result{Success: false, Error: ErrBuffered}
+}
+
+// flush delivers the notifications buffered while disconnected
+func (n *AMQPNotifier) flush() {
+	n.pendingLock.Lock()
+	pending := n.pending
+	n.pending = nil
+	n.pendingLock.Unlock()
+
+	for _, message := range pending {
+		r := n.Deliver(message)
+		if !r.Success && !errors.Is(r.Error, ErrBuffered) {
+			n.handleError(fmt.Errorf("%s: delivering buffered notification %s: %w", n.Name(), message.ID, r.Error))
+		}
+	}
+}
+
+// giveUp fails the notifications buffered while disconnected, the ones
+// delivered afterwards fail right away as the connection won't be recovered
+func (n *AMQPNotifier) giveUp() {
+	n.pendingLock.Lock()
+	pending := n.pending
+	n.pending = nil
+	n.gaveUp = true
+	n.pendingLock.Unlock()
+
+	for _, message := range pending {
+		n.handleError(fmt.Errorf("%s: dropping buffered notification %s: %w", n.Name(), message.ID, ErrNotConnected))
+	}
+}
+
+func (n *AMQPNotifier) setDown(down bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.down = down
+}
+
+func (n *AMQPNotifier) closing() bool {
+	select {
+	case <-n.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,305 @@
+package amqp09
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// errorRecorder collects the errors reported through the OnError hook
+type errorRecorder struct {
+	lock   sync.Mutex
+	errors []string
+}
+
+func (r *errorRecorder) OnError(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errors = append(r.errors, err.Error())
+}
+
+func (r *errorRecorder) Contains(want string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, e := range r.errors {
+		if bytes.Contains([]byte(e), []byte(want)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newReconnectNotifier(reconnect *ReconnectOptions, recorder *errorRecorder) (*AMQPNotifier, *MockInternalWrapper) {
+	var (
+		buf bytes.Buffer
+		w   = &MockInternalWrapper{}
+		n   = New(&Config{
+			Name:            "amqp09-test",
+			Address:         "amqp://example.com",
+			QueueName:       "test",
+			DeliveryTimeout: 100,
+			Reconnect:       reconnect,
+			OnError:         recorder.OnError,
+			wrapper:         w,
+			Logger:          log.New(&buf, "test:", log.LstdFlags),
+		})
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	return n, w
+}
+
+func TestAMQPNotifier_recover(t *testing.T) {
+	tests := []struct {
+		name        string
+		connLost    bool
+		reconnect   *ReconnectOptions
+		before      func(n *AMQPNotifier, w *MockInternalWrapper)
+		want        bool
+		wantErrors  []string
+		wantDials   int
+		wantCloses  int
+		wantPublish int
+	}{
+		{
+			name:      "success-connection",
+			connLost:  true,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(fmt.Errorf("test-Dial-error")).Once()
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+				w.On("Channel").Return(nil)
+			},
+			want: true,
+			wantErrors: []string{
+				"amqp09-test: connection closed: Exception (320) Reason: \"test-close\"",
+				"amqp09-test: reconnecting, attempt 1: dialing AMQP server: test-Dial-error",
+			},
+			wantDials: 2,
+		},
+		{
+			name:      "success-channel-only",
+			connLost:  false,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				w.On("Channel").Return(nil)
+			},
+			want:       true,
+			wantErrors: []string{"amqp09-test: channel closed:"},
+			wantDials:  0,
+		},
+		{
+			name:      "success-channel-fallback-connection",
+			connLost:  false,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				w.On("Channel").Return(fmt.Errorf("test-Channel-error")).Once()
+				w.On("Channel").Return(nil)
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+			},
+			want:      true,
+			wantDials: 1,
+		},
+		{
+			name:      "success-flush-buffered",
+			connLost:  true,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond, BufferSize: 2},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				n.pending = []*model.Notification{{ID: "1"}, {ID: "2"}}
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+				w.On("Channel").Return(nil)
+				w.On("PublishWithContext", mock.Anything, "test", "", false, false, mock.Anything).
+					Return(fmt.Errorf("test-Publish-error")).Once()
+				w.On("PublishWithContext", mock.Anything, "test", "", false, false, mock.Anything).
+					Return(nil)
+			},
+			want:        true,
+			wantErrors:  []string{"amqp09-test: delivering buffered notification 1: sending message: test-Publish-error"},
+			wantDials:   1,
+			wantPublish: 2,
+		},
+		{
+			name:      "fail-max-attempts",
+			connLost:  true,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond, MaxAttempts: 2},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				n.pending = []*model.Notification{{ID: "1"}, {ID: "2"}}
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(fmt.Errorf("test-Dial-error"))
+			},
+			want: false,
+			wantErrors: []string{
+				"amqp09-test: giving up reconnecting after 2 attempts",
+				"amqp09-test: dropping buffered notification 1: not connected to AMQP server",
+				"amqp09-test: dropping buffered notification 2: not connected to AMQP server",
+			},
+			wantDials: 2,
+		},
+		{
+			name:      "fail-setup-closes-connection",
+			connLost:  true,
+			reconnect: &ReconnectOptions{InitialInterval: time.Millisecond, MaxAttempts: 2},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+				w.On("Channel").Return(fmt.Errorf("test-PRECONDITION_FAILED"))
+				w.On("CloseConn").Return(nil)
+			},
+			want:       false,
+			wantErrors: []string{"amqp09-test: reconnecting, attempt 2: creating channel: test-PRECONDITION_FAILED"},
+			wantDials:  2,
+			wantCloses: 2,
+		},
+		{
+			name:      "fail-closed",
+			connLost:  true,
+			reconnect: &ReconnectOptions{InitialInterval: time.Hour},
+			before: func(n *AMQPNotifier, w *MockInternalWrapper) {
+				close(n.done)
+			},
+			want:      false,
+			wantDials: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				recorder = &errorRecorder{}
+				n, w     = newReconnectNotifier(tt.reconnect, recorder)
+			)
+
+			n.done = make(chan struct{})
+
+			if tt.before != nil {
+				tt.before(n, w)
+			}
+
+			got := n.recover(tt.connLost, &amqp.Error{Code: amqp.ConnectionForced, Reason: "test-close"})
+			assert.Equalf(t, tt.want, got, "recover() = %t, want %t", got, tt.want)
+			assert.Equalf(t, !tt.want, n.down, "down = %t, want %t", n.down, !tt.want)
+			assert.Empty(t, n.pending)
+
+			for _, want := range tt.wantErrors {
+				assert.Truef(t, recorder.Contains(want), "errors = %v, want %s", recorder.errors, want)
+			}
+
+			w.AssertNumberOfCalls(t, "Dial", tt.wantDials)
+			w.AssertNumberOfCalls(t, "CloseConn", tt.wantCloses)
+			w.AssertNumberOfCalls(t, "PublishWithContext", tt.wantPublish)
+		})
+	}
+}
+
+func TestAMQPNotifier_watch(t *testing.T) {
+	var (
+		recorder = &errorRecorder{}
+		n, w     = newReconnectNotifier(&ReconnectOptions{InitialInterval: time.Millisecond}, recorder)
+	)
+
+	w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+	w.On("Channel").Return(nil)
+	w.On("NotifyClose", mock.Anything).Return()
+	w.On("NotifyChannelClose", mock.Anything).Return()
+	w.On("CloseConn").Return(nil)
+
+	assert.NoError(t, n.Connect())
+
+	// connection dropped by the broker
+	w.lock.Lock()
+	w.connClose <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restart"}
+	w.lock.Unlock()
+
+	assert.Eventually(t, func() bool {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		return w.notified == 2
+	}, time.Second, time.Millisecond, "close notifications not registered again after recovering")
+
+	w.AssertNumberOfCalls(t, "Dial", 2)
+	assert.True(t, recorder.Contains("broker restart"))
+
+	// closing the notifier stops watching
+	assert.NoError(t, n.Close())
+	assert.NoError(t, n.Close())
+	time.Sleep(10 * time.Millisecond)
+	w.AssertNumberOfCalls(t, "Dial", 2)
+}
+
+func TestAMQPNotifier_DeliverDisconnected(t *testing.T) {
+	tests := []struct {
+		name      string
+		reconnect *ReconnectOptions
+		pending   int
+		gaveUp    bool
+		checks    []model.TestCheckResultFn
+		wantCount int
+	}{
+		{
+			name:      "fail-no-buffer",
+			reconnect: &ReconnectOptions{},
+			checks: model.CheckResult(
+				model.CheckResultError("not connected to AMQP server"),
+			),
+		},
+		{
+			name:      "buffered",
+			reconnect: &ReconnectOptions{BufferSize: 2},
+			pending:   1,
+			checks: model.CheckResult(
+				model.CheckResultError("notification buffered until the connection is recovered"),
+			),
+			wantCount: 2,
+		},
+		{
+			name:      "fail-buffer-full",
+			reconnect: &ReconnectOptions{BufferSize: 2},
+			pending:   2,
+			checks: model.CheckResult(
+				model.CheckResultError("not connected to AMQP server: buffer is full"),
+			),
+			wantCount: 2,
+		},
+		{
+			name:      "fail-gave-up",
+			reconnect: &ReconnectOptions{BufferSize: 2, MaxAttempts: 1},
+			gaveUp:    true,
+			checks: model.CheckResult(
+				model.CheckResultError("not connected to AMQP server"),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n, w := newReconnectNotifier(tt.reconnect, &errorRecorder{})
+			n.down = true
+			n.gaveUp = tt.gaveUp
+
+			for i := 0; i < tt.pending; i++ {
+				n.pending = append(n.pending, &model.Notification{})
+			}
+
+			r := n.Deliver(&model.Notification{Data: "test"})
+			for _, c := range tt.checks {
+				c(t, n, r)
+			}
+
+			assert.Len(t, n.pending, tt.wantCount)
+			w.AssertNotCalled(t, "PublishWithContext")
+		})
+	}
+}
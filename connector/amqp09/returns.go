@@ -0,0 +1,153 @@
+package amqp09
+
+import (
+	"context"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// confirmation is the outcome of a publishing awaited in confirm mode
+type confirmation interface {
+	// WaitContext blocks until the broker acks or nacks the publishing
+	WaitContext(ctx context.Context) (bool, error)
+	// Returned gives the publishing back if the broker couldn't route it, it
+	// must be called after WaitContext
+	Returned() *amqp.Return
+	// Forget stops waiting for the return of the publishing, it must be
+	// called instead of Returned when WaitContext fails
+	Forget()
+}
+
+// returnTracker consumes the messages returned on a channel. In confirm mode
+// returns are kept to be claimed by the publisher waiting for them, otherwise
+// they are passed to the handler
+type returnTracker struct {
+	lock     sync.Mutex
+	returns  chan amqp.Return
+	barrier  chan chan struct{}
+	done     chan struct{}
+	returned map[string]amqp.Return
+	waiting  map[string]int
+	claim    bool
+	handler  func(amqp.Return)
+}
+
+func newReturnTracker(claim bool) *returnTracker {
+	return &returnTracker{
+		returns:  make(chan amqp.Return),
+		barrier:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+		returned: make(map[string]amqp.Return),
+		waiting:  make(map[string]int),
+		claim:    claim,
+	}
+}
+
+// SetHandler sets the function receiving unclaimed returns
+func (t *returnTracker) SetHandler(handler func(amqp.Return)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.handler = handler
+}
+
+// Run consumes returns until the channel is closed
+func (t *returnTracker) Run() {
+	defer close(t.done)
+
+	for {
+		select {
+		case r, ok := <-t.returns:
+			if !ok {
+				return
+			}
+
+			t.lock.Lock()
+			// nobody would claim the return of a publishing not waited for
+			if t.claim && t.waiting[r.MessageId] > 0 {
+				t.returned[r.MessageId] = r
+			} else if t.handler != nil {
+				t.handler(r)
+			}
+			t.lock.Unlock()
+
+		case done := <-t.barrier:
+			close(done)
+		}
+	}
+}
+
+// Expect registers a publisher waiting for the return of the message id, it
+// must be followed by Take or Forget
+func (t *returnTracker) Expect(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.waiting[id]++
+}
+
+// Forget unregisters a publisher that stopped waiting for the return of the
+// message id, a return kept for it is dropped
+func (t *returnTracker) Forget(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.forget(id)
+}
+
+// forget unregisters a publisher, the lock must be held
+func (t *returnTracker) forget(id string) {
+	if t.waiting[id]--; t.waiting[id] > 0 {
+		return
+	}
+
+	delete(t.waiting, id)
+	delete(t.returned, id)
+}
+
+// Take claims the return for the message id, if any. The library hands a
+// return over before the ack of the same publishing, so once Run went through
+// the barrier every return preceding the ack has been recorded
+func (t *returnTracker) Take(id string) *amqp.Return {
+	done := make(chan struct{})
+
+	select {
+	case t.barrier <- done:
+		<-done
+	case <-t.done:
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	r, ok := t.returned[id]
+	t.forget(id)
+
+	if !ok {
+		return nil
+	}
+
+	return &r
+}
+
+// deferredConfirmation binds a library confirmation to the channel returns
+type deferredConfirmation struct {
+	*amqp.DeferredConfirmation
+	tracker *returnTracker
+	id      string
+}
+
+func (c *deferredConfirmation) Returned() *amqp.Return {
+	if c.tracker == nil {
+		return nil
+	}
+
+	return c.tracker.Take(c.id)
+}
+
+func (c *deferredConfirmation) Forget() {
+	if c.tracker != nil {
+		c.tracker.Forget(c.id)
+	}
+}
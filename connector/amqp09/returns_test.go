@@ -0,0 +1,328 @@
+package amqp09
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReturnTracker_Take(t *testing.T) {
+	var (
+		tracker = newReturnTracker(true)
+		ret     = amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	)
+
+	go tracker.Run()
+
+	// the library blocks until the return is received, then processes the ack
+	tracker.Expect("abc")
+	tracker.returns <- ret
+
+	got := tracker.Take("abc")
+	if assert.NotNil(t, got, "Take() = nil, want return") {
+		assert.Equal(t, ret, *got)
+	}
+
+	assert.Nil(t, tracker.Take("abc"), "Take() returned twice")
+	assert.Nil(t, tracker.Take("other"))
+	assert.Empty(t, tracker.waiting)
+
+	// channel closed
+	close(tracker.returns)
+	<-tracker.done
+	assert.Nil(t, tracker.Take("abc"))
+}
+
+func TestReturnTracker_Handler(t *testing.T) {
+	var (
+		tracker = newReturnTracker(false)
+		got     = make(chan amqp.Return, 1)
+		ret     = amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	)
+
+	tracker.SetHandler(func(r amqp.Return) { got <- r })
+	go tracker.Run()
+
+	tracker.returns <- ret
+
+	select {
+	case r := <-got:
+		assert.Equal(t, ret, r)
+	case <-time.After(time.Second):
+		t.Errorf("handler not called")
+	}
+
+	assert.Nil(t, tracker.Take("abc"), "unclaimed return kept")
+	close(tracker.returns)
+}
+
+func TestReturnTracker_Forget(t *testing.T) {
+	var (
+		tracker = newReturnTracker(true)
+		got     = make(chan amqp.Return, 1)
+		ret     = amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	)
+
+	tracker.SetHandler(func(r amqp.Return) { got <- r })
+	go tracker.Run()
+
+	// the publisher timed out before the return, which is kept
+	tracker.Expect("abc")
+	tracker.returns <- ret
+	tracker.Forget("abc")
+
+	// or it timed out first, nobody will claim it
+	tracker.Expect("def")
+	tracker.Forget("def")
+	tracker.returns <- amqp.Return{MessageId: "def"}
+
+	select {
+	case r := <-got:
+		assert.Equal(t, "def", r.MessageId)
+	case <-time.After(time.Second):
+		t.Errorf("handler not called")
+	}
+
+	tracker.lock.Lock()
+	assert.Empty(t, tracker.returned, "forgotten returns kept")
+	assert.Empty(t, tracker.waiting)
+	tracker.lock.Unlock()
+
+	close(tracker.returns)
+}
+
+func TestAMQPNotifier_DeliverConfirm(t *testing.T) {
+	var (
+		buf       bytes.Buffer
+		logger    = log.New(&buf, "test:", log.LstdFlags)
+		queueName = "test"
+
+		checkSuccess = func(want bool) model.TestCheckResultFn {
+			return func(t *testing.T, n model.Notifier, r *model.Result) {
+				t.Helper()
+				assert.Equal(t, want, r.Success)
+			}
+		}
+
+		// publishers giving up stop waiting for the return
+		timedOut    = &mockConfirmation{acked: true, wait: time.Second}
+		checkForgot = func(t *testing.T, n model.Notifier, r *model.Result) {
+			t.Helper()
+			assert.True(t, timedOut.forgotten, "return still awaited")
+		}
+
+		checkAcknowledged = func(want bool) model.TestCheckResultFn {
+			return func(t *testing.T, n model.Notifier, r *model.Result) {
+				t.Helper()
+				assert.Equal(t, want, r.Acknowledged)
+			}
+		}
+
+		tests = []struct {
+			name      string
+			mandatory bool
+			message   *model.Notification
+			before    func(w *MockInternalWrapper)
+			checks    []model.TestCheckResultFn
+		}{
+			{
+				name:    "success-acked",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false,
+						amqp.Publishing{ContentType: "application/json", MessageId: "abc", Body: []byte("test")}).
+						Return(&mockConfirmation{acked: true}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+					checkAcknowledged(true),
+				),
+			},
+			{
+				name:      "success-mandatory-message-id",
+				mandatory: true,
+				message:   &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", true, false,
+						amqp.Publishing{ContentType: "application/json", MessageId: "abc", Body: []byte("test")}).
+						Return(&mockConfirmation{acked: true}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+				),
+			},
+			{
+				name:      "success-mandatory-random-id",
+				mandatory: true,
+				message:   &model.Notification{Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", true, false,
+						mock.MatchedBy(func(msg amqp.Publishing) bool { return len(msg.MessageId) == 24 })).
+						Return(&mockConfirmation{acked: true}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+				),
+			},
+			{
+				name:    "fail-nacked",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false, mock.Anything).
+						Return(&mockConfirmation{acked: false}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("message nacked by broker"),
+					checkSuccess(false),
+					checkAcknowledged(false),
+				),
+			},
+			{
+				name:      "fail-returned",
+				mandatory: true,
+				message:   &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", true, false, mock.Anything).
+						Return(&mockConfirmation{
+							acked:    true,
+							returned: &amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"},
+						}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("message returned by broker: 312 NO_ROUTE"),
+					checkSuccess(false),
+				),
+			},
+			{
+				name:    "fail-timeout",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false, mock.Anything).
+						Return(timedOut, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("message delivery timed out"),
+					checkForgot,
+				),
+			},
+			{
+				name:    "fail-wait",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false, mock.Anything).
+						Return(&mockConfirmation{err: fmt.Errorf("test-Wait-error")}, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("waiting for confirmation: test-Wait-error"),
+				),
+			},
+			{
+				name:    "fail-publish",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false, mock.Anything).
+						Return(nil, fmt.Errorf("test-Publish-error"))
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: test-Publish-error"),
+				),
+			},
+			{
+				name:    "fail-not-confirm-mode",
+				message: &model.Notification{ID: "abc", Data: "test"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithDeferredConfirmWithContext", mock.Anything, queueName, "", false, false, mock.Anything).
+						Return(nil, nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: channel is not in confirm mode"),
+				),
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					QueueName:       queueName,
+					Confirm:         true,
+					PublishOptions:  PublishOptions{Mandatory: tt.mandatory},
+					DeliveryTimeout: 30,
+					ctx:             context.TODO(),
+					wrapper:         w,
+					Logger:          logger,
+				})
+			)
+
+			n.jsonMarshal = func(v any) ([]byte, error) {
+				return []byte("test"), nil
+			}
+
+			if tt.before != nil {
+				tt.before(w)
+			}
+
+			r := n.Deliver(tt.message)
+			for _, c := range tt.checks {
+				c(t, n, r)
+			}
+
+			w.AssertNotCalled(t, "PublishWithContext")
+			buf.Reset()
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverMandatoryWithoutConfirm(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			QueueName:       "test",
+			PublishOptions:  PublishOptions{Mandatory: true},
+			DeliveryTimeout: 30,
+			wrapper:         w,
+			Logger:          log.New(&bytes.Buffer{}, "test:", log.LstdFlags),
+		})
+	)
+
+	assert.True(t, n.Confirm, "Confirm not enabled by Mandatory")
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	// unroutable, the broker returns the message and then acks it
+	w.On("PublishWithDeferredConfirmWithContext", mock.Anything, "test", "", true, false, mock.Anything).
+		Return(&mockConfirmation{
+			acked:    true,
+			returned: &amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"},
+		}, nil)
+
+	r := n.Deliver(&model.Notification{ID: "abc", Data: "test"})
+	assert.False(t, r.Success)
+	assert.ErrorContains(t, r.Error, "message returned by broker: 312 NO_ROUTE")
+	w.AssertNotCalled(t, "PublishWithContext")
+}
+
+func TestAMQPNotifier_handleReturn(t *testing.T) {
+	var (
+		recorder = &errorRecorder{}
+		n, _     = newReconnectNotifier(nil, recorder)
+	)
+
+	n.handleReturn(amqp.Return{MessageId: "abc", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"})
+	assert.True(t, recorder.Contains("amqp09-test: message abc returned by broker: 312 NO_ROUTE"))
+}
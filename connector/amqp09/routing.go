@@ -0,0 +1,34 @@
+package amqp09
+
+import (
+	"fmt"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// KeyFunc derives the routing key of a notification
+type KeyFunc func(message *model.Notification) (string, error)
+
+// newKeyFunc returns the function used to route notifications, a KeyFunc in
+// the options takes precedence over the Key, which can be a template like
+// "orders.{{.Event}}.{{.Data.region}}"
+func newKeyFunc(options PublishOptions) (KeyFunc, error) {
+	if options.KeyFunc != nil {
+		return options.KeyFunc, nil
+	}
+
+	if !utils.IsTemplate(options.Key) {
+		key := options.Key
+		return func(*model.Notification) (string, error) { return key, nil }, nil
+	}
+
+	tpl, err := utils.ParseTemplate("routing-key", options.Key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing routing key template: %w", err)
+	}
+
+	return func(message *model.Notification) (string, error) {
+		return tpl.Render(message)
+	}, nil
+}
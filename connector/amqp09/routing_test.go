@@ -0,0 +1,200 @@
+package amqp09
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewKeyFunc(t *testing.T) {
+	var (
+		message = &model.Notification{
+			Event: "orders.created",
+			Data:  map[string]any{"region": "eu"},
+		}
+
+		tests = []struct {
+			name       string
+			options    PublishOptions
+			message    *model.Notification
+			want       string
+			wantErrMsg string
+			wantNewErr string
+		}{
+			{
+				name:    "static",
+				options: PublishOptions{Key: "orders"},
+				message: message,
+				want:    "orders",
+			},
+			{
+				name:    "empty",
+				message: message,
+				want:    "",
+			},
+			{
+				name:    "template",
+				options: PublishOptions{Key: "{{.Event}}.{{.Data.region}}"},
+				message: message,
+				want:    "orders.created.eu",
+			},
+			{
+				name: "func-overrides-key",
+				options: PublishOptions{
+					Key: "orders",
+					KeyFunc: func(m *model.Notification) (string, error) {
+						return "audit." + string(m.Event), nil
+					},
+				},
+				message: message,
+				want:    "audit.orders.created",
+			},
+			{
+				name:       "fail-render",
+				options:    PublishOptions{Key: "{{.Event}}.{{.Data.country}}"},
+				message:    message,
+				wantErrMsg: `map has no entry for key "country"`,
+			},
+			{
+				name:       "fail-parse",
+				options:    PublishOptions{Key: "{{.Event"},
+				wantNewErr: "parsing routing key template",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := newKeyFunc(tt.options)
+			if tt.wantNewErr != "" {
+				assert.ErrorContains(t, err, tt.wantNewErr)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got, err := fn(tt.message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.want, got, "routing key = %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverRoutingKey(t *testing.T) {
+	var (
+		buf       bytes.Buffer
+		logger    = log.New(&buf, "test:", log.LstdFlags)
+		queueName = "notifications"
+
+		tests = []struct {
+			name    string
+			options PublishOptions
+			message *model.Notification
+			before  func(w *MockInternalWrapper)
+			checks  []model.TestCheckResultFn
+		}{
+			{
+				name:    "success-template",
+				options: PublishOptions{Key: "{{.Event}}.{{.Data.region}}"},
+				message: &model.Notification{Event: "orders.created", Data: map[string]any{"region": "eu"}},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithContext", mock.Anything, queueName, "orders.created.eu", false, false, mock.Anything).
+						Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+				),
+			},
+			{
+				name: "success-func",
+				options: PublishOptions{
+					KeyFunc: func(m *model.Notification) (string, error) {
+						return "events." + string(m.Event), nil
+					},
+				},
+				message: &model.Notification{Event: "user.deleted"},
+				before: func(w *MockInternalWrapper) {
+					w.On("PublishWithContext", mock.Anything, queueName, "events.user.deleted", false, false, mock.Anything).
+						Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+				),
+			},
+			{
+				name: "fail-func",
+				options: PublishOptions{
+					KeyFunc: func(m *model.Notification) (string, error) {
+						return "", fmt.Errorf("test-KeyFunc-error")
+					},
+				},
+				message: &model.Notification{Event: "user.deleted"},
+				checks: model.CheckResult(
+					model.CheckResultError("rendering routing key: test-KeyFunc-error"),
+				),
+			},
+			{
+				name:    "fail-parse",
+				options: PublishOptions{Key: "{{.Event"},
+				message: &model.Notification{Event: "user.deleted"},
+				checks: model.CheckResult(
+					model.CheckResultError("parsing routing key template"),
+				),
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					QueueName:       queueName,
+					PublishOptions:  tt.options,
+					DeliveryTimeout: 30,
+					ctx:             context.TODO(),
+					wrapper:         w,
+					Logger:          logger,
+				})
+			)
+
+			if tt.before != nil {
+				tt.before(w)
+			}
+
+			r := n.Deliver(tt.message)
+			for _, c := range tt.checks {
+				c(t, n, r)
+			}
+
+			w.AssertExpectations(t)
+			buf.Reset()
+		})
+	}
+}
+
+func TestAMQPNotifier_ConnectRoutingKey(t *testing.T) {
+	w := &MockInternalWrapper{}
+	n := New(&Config{
+		PublishOptions: PublishOptions{Key: "{{.Event"},
+		wrapper:        w,
+	})
+
+	assert.ErrorContains(t, n.Connect(), "parsing routing key template")
+	w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything)
+}
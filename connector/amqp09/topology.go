@@ -0,0 +1,127 @@
+package amqp09
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology holds the exchanges, queues and bindings declared when connecting,
+// and again after the connection is recovered
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+// Exchange describes an exchange to declare
+type Exchange struct {
+	Name string
+	// Kind is the exchange type, amqp.ExchangeDirect if empty
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Arguments  amqp.Table
+}
+
+// Queue describes a queue to declare
+type Queue struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	// Quorum declares a replicated quorum queue, it must be durable
+	Quorum               bool
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	MessageTTL           time.Duration
+	MaxLength            int64
+	MaxLengthBytes       int64
+	// Arguments are extra arguments, they override the ones set by the fields above
+	Arguments amqp.Table
+}
+
+// Binding binds a queue to an exchange
+type Binding struct {
+	Queue     string
+	Exchange  string
+	Key       string
+	Arguments amqp.Table
+}
+
+// arguments builds the declaration arguments of the queue
+func (q *Queue) arguments() amqp.Table {
+	args := amqp.Table{}
+
+	if q.Quorum {
+		args["x-queue-type"] = "quorum"
+	}
+
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+
+	if q.MaxLength > 0 {
+		args["x-max-length"] = q.MaxLength
+	}
+
+	if q.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = q.MaxLengthBytes
+	}
+
+	for k, v := range q.Arguments {
+		args[k] = v
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	return args
+}
+
+// declare declares the topology on the channel
+func (n *AMQPNotifier) declare() error {
+	if n.Topology == nil {
+		return nil
+	}
+
+	for _, e := range n.Topology.Exchanges {
+		kind := e.Kind
+		if kind == "" {
+			kind = amqp.ExchangeDirect
+		}
+
+		if err := n.wrapper.ExchangeDeclare(e.Name, kind, e.Durable, e.AutoDelete, e.Internal, false, e.Arguments); err != nil {
+			return fmt.Errorf("declaring exchange %s: %w", e.Name, err)
+		}
+	}
+
+	for _, q := range n.Topology.Queues {
+		if q.Quorum && !q.Durable {
+			return fmt.Errorf("declaring queue %s: quorum queues must be durable", q.Name)
+		}
+
+		if err := n.wrapper.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.arguments()); err != nil {
+			return fmt.Errorf("declaring queue %s: %w", q.Name, err)
+		}
+	}
+
+	for _, b := range n.Topology.Bindings {
+		if err := n.wrapper.QueueBind(b.Queue, b.Key, b.Exchange, false, b.Arguments); err != nil {
+			return fmt.Errorf("binding queue %s to exchange %s: %w", b.Queue, b.Exchange, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package amqp09
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_arguments(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue Queue
+		want  amqp.Table
+	}{
+		{
+			name:  "no-arguments",
+			queue: Queue{Name: "notifications", Durable: true},
+			want:  nil,
+		},
+		{
+			name: "all-arguments",
+			queue: Queue{
+				Name:                 "notifications",
+				Durable:              true,
+				Quorum:               true,
+				DeadLetterExchange:   "notifications.dlx",
+				DeadLetterRoutingKey: "dead",
+				MessageTTL:           time.Minute,
+				MaxLength:            1000,
+				MaxLengthBytes:       1 << 20,
+				Arguments:            amqp.Table{"x-overflow": "reject-publish", "x-max-length": int64(10)},
+			},
+			want: amqp.Table{
+				"x-queue-type":              "quorum",
+				"x-dead-letter-exchange":    "notifications.dlx",
+				"x-dead-letter-routing-key": "dead",
+				"x-message-ttl":             int64(60000),
+				"x-max-length":              int64(10),
+				"x-max-length-bytes":        int64(1 << 20),
+				"x-overflow":                "reject-publish",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.queue.arguments()
+			assert.Equal(t, tt.want, got)
+			if got != nil {
+				assert.NoError(t, got.Validate())
+			}
+		})
+	}
+}
+
+func TestAMQPNotifier_declare(t *testing.T) {
+	var (
+		buf      bytes.Buffer
+		topology = &Topology{
+			Exchanges: []Exchange{
+				{Name: "notifications", Kind: amqp.ExchangeTopic, Durable: true},
+				{Name: "notifications.dlx"},
+			},
+			Queues: []Queue{
+				{Name: "orders", Durable: true, Quorum: true, DeadLetterExchange: "notifications.dlx"},
+			},
+			Bindings: []Binding{
+				{Queue: "orders", Exchange: "notifications", Key: "orders.#"},
+			},
+		}
+		ordersArgs = amqp.Table{"x-queue-type": "quorum", "x-dead-letter-exchange": "notifications.dlx"}
+
+		tests = []struct {
+			name       string
+			topology   *Topology
+			before     func(w *MockInternalWrapper)
+			wantErrMsg string
+		}{
+			{
+				name:     "success-no-topology",
+				topology: nil,
+			},
+			{
+				name:     "success",
+				topology: topology,
+				before: func(w *MockInternalWrapper) {
+					w.On("ExchangeDeclare", "notifications", amqp.ExchangeTopic, true, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("ExchangeDeclare", "notifications.dlx", amqp.ExchangeDirect, false, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("QueueDeclare", "orders", true, false, false, false, ordersArgs).Return(nil)
+					w.On("QueueBind", "orders", "orders.#", "notifications", false, amqp.Table(nil)).Return(nil)
+				},
+			},
+			{
+				name:     "fail-exchange",
+				topology: topology,
+				before: func(w *MockInternalWrapper) {
+					w.On("ExchangeDeclare", "notifications", amqp.ExchangeTopic, true, false, false, false, amqp.Table(nil)).
+						Return(fmt.Errorf("test-ExchangeDeclare-error"))
+				},
+				wantErrMsg: "declaring exchange notifications: test-ExchangeDeclare-error",
+			},
+			{
+				name:     "fail-queue",
+				topology: topology,
+				before: func(w *MockInternalWrapper) {
+					w.On("ExchangeDeclare", "notifications", amqp.ExchangeTopic, true, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("ExchangeDeclare", "notifications.dlx", amqp.ExchangeDirect, false, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("QueueDeclare", "orders", true, false, false, false, ordersArgs).
+						Return(fmt.Errorf("test-QueueDeclare-error"))
+				},
+				wantErrMsg: "declaring queue orders: test-QueueDeclare-error",
+			},
+			{
+				name: "fail-quorum-not-durable",
+				topology: &Topology{
+					Queues: []Queue{{Name: "orders", Quorum: true}},
+				},
+				wantErrMsg: "declaring queue orders: quorum queues must be durable",
+			},
+			{
+				name:     "fail-binding",
+				topology: topology,
+				before: func(w *MockInternalWrapper) {
+					w.On("ExchangeDeclare", "notifications", amqp.ExchangeTopic, true, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("ExchangeDeclare", "notifications.dlx", amqp.ExchangeDirect, false, false, false, false, amqp.Table(nil)).Return(nil)
+					w.On("QueueDeclare", "orders", true, false, false, false, ordersArgs).Return(nil)
+					w.On("QueueBind", "orders", "orders.#", "notifications", false, amqp.Table(nil)).
+						Return(fmt.Errorf("test-QueueBind-error"))
+				},
+				wantErrMsg: "binding queue orders to exchange notifications: test-QueueBind-error",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					Topology: tt.topology,
+					wrapper:  w,
+					Logger:   log.New(&buf, "test-logger", log.LstdFlags),
+				})
+			)
+
+			if tt.before != nil {
+				tt.before(w)
+			}
+
+			err := n.declare()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+				w.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestAMQPNotifier_ConnectTopology(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = &MockInternalWrapper{}
+		n   = New(&Config{
+			Address: "amqp://example.com",
+			Topology: &Topology{
+				Exchanges: []Exchange{{Name: "notifications", Kind: amqp.ExchangeFanout}},
+			},
+			wrapper: w,
+			Logger:  log.New(&buf, "test-logger", log.LstdFlags),
+		})
+	)
+
+	w.On("Dial", "amqp://example.com", (*amqp.Config)(nil)).Return(nil)
+	w.On("Channel").Return(nil)
+	w.On("ExchangeDeclare", "notifications", amqp.ExchangeFanout, false, false, false, false, amqp.Table(nil)).Return(nil)
+
+	assert.NoError(t, n.Connect())
+
+	// declared again when the channel is recovered
+	assert.NoError(t, n.setupChannel())
+	w.AssertNumberOfCalls(t, "ExchangeDeclare", 2)
+}
@@ -7,21 +7,37 @@ import (
 )
 
 type internalWrapperInterface interface {
-	Dial(url string) error
+	Dial(url string, config *amqp.Config) error
 	CloseConn() error
 	Channel() error
 	CloseChannel() error
 	PublishWithContext(ctx context.Context, exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) error
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	NotifyChannelClose(receiver chan *amqp.Error) chan *amqp.Error
+	Confirm(noWait bool) error
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) (confirmation, error)
+	SetReturnHandler(handler func(amqp.Return))
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) error
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
 }
 
 type internalWrapper struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	conn *amqp.Connection
+	// size is the number of channels in the pool
+	size int
+	pool *channelPool
 }
 
-func (w *internalWrapper) Dial(url string) error {
+func (w *internalWrapper) Dial(url string, config *amqp.Config) error {
 	var err error
-	w.conn, err = amqp.Dial(url)
+
+	if config == nil {
+		w.conn, err = amqp.Dial(url)
+	} else {
+		w.conn, err = amqp.DialConfig(url, *config)
+	}
+
 	return err
 }
 
@@ -29,16 +45,95 @@ func (w *internalWrapper) CloseConn() error {
 	return w.conn.Close()
 }
 
+// Channel opens the pool of channels, replacing the one opened before
 func (w *internalWrapper) Channel() error {
-	var err error
-	w.channel, err = w.conn.Channel()
-	return err
+	conn := w.conn
+
+	if w.pool != nil {
+		_ = w.pool.Close()
+	}
+
+	pool, err := newChannelPool(w.size, func() (amqpChannel, error) {
+		ch, err := conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+
+		return ch, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.pool = pool
+
+	return nil
 }
 
 func (w *internalWrapper) CloseChannel() error {
-	return w.channel.Close()
+	return w.pool.Close()
 }
 
 func (w *internalWrapper) PublishWithContext(ctx context.Context, exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) error {
-	return w.channel.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	return w.pool.Do(ctx, func(slot *pooledChannel) error {
+		return slot.channel.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	})
+}
+
+func (w *internalWrapper) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return w.conn.NotifyClose(receiver)
+}
+
+// NotifyChannelClose registers to be notified when a channel of the pool is
+// closed and can't be replaced
+func (w *internalWrapper) NotifyChannelClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return w.pool.NotifyClose(receiver)
+}
+
+func (w *internalWrapper) Confirm(noWait bool) error {
+	return w.pool.Confirm(noWait)
+}
+
+func (w *internalWrapper) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange string, key string, mandatory bool, immediate bool, msg amqp.Publishing) (confirmation, error) {
+	var conf confirmation
+
+	err := w.pool.Do(ctx, func(slot *pooledChannel) error {
+		// the return could arrive before the publishing call returns
+		slot.returns.Expect(msg.MessageId)
+
+		dc, err := slot.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+		if err != nil || dc == nil {
+			slot.returns.Forget(msg.MessageId)
+			return err
+		}
+
+		conf = &deferredConfirmation{DeferredConfirmation: dc, tracker: slot.returns, id: msg.MessageId}
+
+		return nil
+	})
+
+	return conf, err
+}
+
+func (w *internalWrapper) SetReturnHandler(handler func(amqp.Return)) {
+	w.pool.SetReturnHandler(handler)
+}
+
+func (w *internalWrapper) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return w.pool.Do(context.Background(), func(slot *pooledChannel) error {
+		return slot.channel.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, args)
+	})
+}
+
+func (w *internalWrapper) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) error {
+	return w.pool.Do(context.Background(), func(slot *pooledChannel) error {
+		_, err := slot.channel.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+		return err
+	})
+}
+
+func (w *internalWrapper) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return w.pool.Do(context.Background(), func(slot *pooledChannel) error {
+		return slot.channel.QueueBind(name, key, exchange, noWait, args)
+	})
 }
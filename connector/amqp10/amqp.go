@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	amqp "github.com/Azure/go-amqp"
@@ -14,17 +15,43 @@ import (
 )
 
 type Config struct {
-	Logger          *log.Logger
-	Name            string
-	QueueName       string
+	Logger *log.Logger
+	Name   string
+	// QueueName is the address notifications are sent to, it can be a template
+	// rendered against each notification
+	QueueName string
+	// Targets maps event types to the addresses their notifications are sent
+	// to, other events are sent to QueueName
+	Targets map[model.EventType]string
+	// TargetFunc chooses the address of each notification, overrides QueueName
+	// and Targets
+	TargetFunc TargetFunc
+	// LinkIdleTimeout closes the sender links not used for the given time,
+	// they are opened again when needed. 0 keeps them open
+	LinkIdleTimeout time.Duration
+	// Address is the server URL, credentials can be given apart with SASL
 	Address         string
 	DeliveryTimeout time.Duration
 	SessionOptions  *amqp.SessionOptions
 	ConnOptions     *amqp.ConnOptions
 	SenderOptions   *amqp.SenderOptions
 	SendOptions     *amqp.SendOptions
-	wrapper         internalWrapperInterface
-	ctx             context.Context
+	Compression     *utils.Compression
+	Reconnect       *ReconnectOptions
+	// TLS configures amqps:// connections, overrides ConnOptions.TLSConfig
+	TLS *utils.TLSOptions
+	// SASL sets the authentication mechanism and credentials, overrides
+	// ConnOptions.SASLType
+	SASL *utils.SASL
+	// Durable marks messages as durable so the broker keeps them across restarts
+	Durable bool
+	// Settlement sets the delivery guarantee, overriding the settlement modes
+	// in SenderOptions
+	Settlement Settlement
+	// ServiceBus enables the Azure Service Bus mode
+	ServiceBus *ServiceBusOptions
+	wrapper    internalWrapperInterface
+	ctx        context.Context
 }
 
 // AMQPNotifier implements the Notifier interface for message queues
@@ -32,6 +59,23 @@ type AMQPNotifier struct {
 	*Config
 	Channel     chan *model.Notification
 	jsonMarshal func(v any) ([]byte, error)
+	lock        sync.RWMutex
+	// generation is incremented every time the session is re-created
+	generation uint64
+	target     TargetFunc
+	targetErr  error
+	linksLock  sync.Mutex
+	links      map[string]*link
+	linkSeq    uint64
+	done       chan struct{}
+	closeOnce  sync.Once
+	// acknowledged tells if the broker confirms each message
+	acknowledged  bool
+	settlementErr error
+	serviceBus    *serviceBus
+	serviceBusErr error
+	// cbs is the link tokens are put on, opened with the first sender link
+	cbs cbsLink
 }
 
 var _ model.Notifier = (*AMQPNotifier)(nil)
@@ -64,6 +108,17 @@ func (n *AMQPNotifier) New(config *Config) *AMQPNotifier {
 	n.Config = config
 	n.jsonMarshal = json.Marshal
 	n.Channel = make(chan *model.Notification)
+	n.links = make(map[string]*link)
+	n.done = make(chan struct{})
+	n.target, n.targetErr = newTargetFunc(config)
+	n.serviceBus, n.serviceBusErr = newServiceBus(config.Address, config.ServiceBus)
+
+	if opts, err := senderOptions(config.SenderOptions, config.Settlement); err != nil {
+		n.settlementErr = err
+	} else {
+		config.SenderOptions = opts
+		n.acknowledged = acknowledged(opts, config.SendOptions)
+	}
 
 	return n
 }
@@ -81,28 +136,73 @@ func (n *AMQPNotifier) GetChannel() chan *model.Notification {
 }
 
 func (n *AMQPNotifier) Connect() error {
+	if n.settlementErr != nil {
+		return n.settlementErr
+	}
+
+	if n.targetErr != nil {
+		return n.targetErr
+	}
+
+	if n.serviceBusErr != nil {
+		return n.serviceBusErr
+	}
+
+	if err := n.connect(n.ctx); err != nil {
+		return err
+	}
+
+	if n.LinkIdleTimeout > 0 {
+		go n.watchIdle()
+	}
+
+	if n.serviceBus != nil {
+		go n.watchTokens()
+	}
+
+	return nil
+}
+
+// connect creates the connection and the session, and the sender link when
+// there is a single target. Links to other targets are opened when needed
+func (n *AMQPNotifier) connect(ctx context.Context) error {
 	var err error
 
+	opts, err := n.connOptions()
+	if err != nil {
+		return fmt.Errorf("configuring connection: %w", err)
+	}
+
 	// create a connection
-	if err = n.wrapper.Dial(n.ctx, n.Address, n.ConnOptions); err != nil {
+	if err = n.wrapper.Dial(ctx, n.Address, opts); err != nil {
 		return fmt.Errorf("dialing AMQP server: %w", err)
 	}
 
 	// create a session
-	if err = n.wrapper.NewSession(n.ctx, n.SessionOptions); err != nil {
+	if err = n.wrapper.NewSession(ctx, n.SessionOptions); err != nil {
 		return fmt.Errorf("creating AMQP session: %w", err)
 	}
 
-	// create a sender
-	if err = n.wrapper.NewSender(n.ctx, n.QueueName, n.SenderOptions); err != nil {
-		return fmt.Errorf("creating sender link: %w", err)
+	n.resetLinks()
+
+	if !n.single() {
+		return nil
 	}
 
-	return nil
+	// create a sender
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	_, err = n.openSender(ctx, n.QueueName)
+
+	return err
 }
 
 func (n *AMQPNotifier) Close() error {
 	if n.wrapper != nil {
+		// stop closing idle links and renewing tokens
+		n.closeOnce.Do(func() { close(n.done) })
+
 		return n.wrapper.CloseConn()
 	}
 
@@ -140,14 +240,53 @@ func (n *AMQPNotifier) Deliver(message *model.Notification) *model.Result {
 
 	defer cancel()
 
+	if n.targetErr != nil {
+		return &model.Result{Success: false, Error: n.targetErr}
+	}
+
+	if n.serviceBusErr != nil {
+		return &model.Result{Success: false, Error: n.serviceBusErr}
+	}
+
+	target, err := n.target(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("rendering target: %w", err)}
+	}
+
 	// Serialize the notification data to JSON
 	payload, err := n.jsonMarshal(message)
 	if err != nil {
 		return &model.Result{Success: false, Error: err}
 	}
 
+	payload, encoding, err := n.Compression.Compress(payload)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("compressing payload: %w", err)}
+	}
+
+	msg := amqp.NewMessage(payload)
+	setProperties(msg, message, encoding)
+
+	if n.Durable {
+		msg.Header = &amqp.MessageHeader{Durable: true}
+	}
+
+	if n.serviceBus != nil {
+		if err := n.serviceBus.annotate(msg, message); err != nil {
+			return &model.Result{Success: false, Error: fmt.Errorf("annotating message: %w", err)}
+		}
+	}
+
 	// send message
-	err = n.wrapper.Send(ctx, amqp.NewMessage(payload), n.SendOptions)
+	generation, err := n.send(ctx, target, msg)
+	if err != nil && n.Reconnect != nil {
+		if what := recoveryFor(err); what != recoverNone {
+			if err = n.recover(ctx, what, target, generation); err == nil {
+				_, err = n.send(ctx, target, msg)
+			}
+		}
+	}
+
 	if err != nil {
 		return &model.Result{Success: false, Error: fmt.Errorf("sending message: %v", err)}
 	}
@@ -159,6 +298,21 @@ func (n *AMQPNotifier) Deliver(message *model.Notification) *model.Result {
 		}
 		return &model.Result{Success: false, Error: ctx.Err()}
 	default:
-		return &model.Result{Success: true}
+		// unsettled sends return once the broker accepted the message
+		return &model.Result{Success: true, Acknowledged: n.acknowledged}
 	}
 }
+
+// send sends the message to the target and returns the generation of the
+// link used
+func (n *AMQPNotifier) send(ctx context.Context, target string, msg *amqp.Message) (generation, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	gen, err := n.sender(ctx, target)
+	if err != nil {
+		return gen, err
+	}
+
+	return gen, n.wrapper.Send(ctx, target, msg, n.SendOptions)
+}
@@ -12,6 +12,7 @@ import (
 
 	amqp "github.com/Azure/go-amqp"
 	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -37,8 +38,8 @@ func (m *MockInternalWrapper) NewSender(ctx context.Context, target string, opts
 	return args.Error(0)
 }
 
-func (m *MockInternalWrapper) Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error {
-	args := m.Called(ctx, msg, opts)
+func (m *MockInternalWrapper) Send(ctx context.Context, target string, msg *amqp.Message, opts *amqp.SendOptions) error {
+	args := m.Called(ctx, target, msg, opts)
 	if m.wait > 0 {
 		fmt.Printf("waiting %d\n", m.wait)
 		time.Sleep(m.wait)
@@ -47,6 +48,17 @@ func (m *MockInternalWrapper) Send(ctx context.Context, msg *amqp.Message, opts
 	return args.Error(0)
 }
 
+func (m *MockInternalWrapper) CloseSender(ctx context.Context, target string) error {
+	args := m.Called(ctx, target)
+	return args.Error(0)
+}
+
+func (m *MockInternalWrapper) NewCBSLink(ctx context.Context, replyTo string) (cbsLink, error) {
+	args := m.Called(ctx, replyTo)
+	link, _ := args.Get(0).(cbsLink)
+	return link, args.Error(1)
+}
+
 func (m *MockInternalWrapper) CloseConn() error {
 	args := m.Called()
 	return args.Error(0)
@@ -502,7 +514,7 @@ func TestAMQPNotifier_Run(t *testing.T) {
 						return payload, nil
 					}
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckNotifierFn{
@@ -521,7 +533,7 @@ func TestAMQPNotifier_Run(t *testing.T) {
 						return nil, fmt.Errorf("test-jsonMarshal-error")
 					}
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckNotifierFn{
@@ -542,7 +554,7 @@ func TestAMQPNotifier_Run(t *testing.T) {
 
 					n.wrapper.(*MockInternalWrapper).wait = 50 * time.Millisecond
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckNotifierFn{
@@ -564,6 +576,9 @@ func TestAMQPNotifier_Run(t *testing.T) {
 				})
 			)
 
+			// the sender link is opened on first use
+			n.wrapper.(*MockInternalWrapper).On("NewSender", mock.Anything, "", (*amqp.SenderOptions)(nil)).Return(nil).Maybe()
+
 			if tt.before != nil {
 				tt.before(n)
 			}
@@ -617,7 +632,7 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 						return payload, nil
 					}
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckResultFn{
@@ -637,13 +652,55 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 						return nil, fmt.Errorf("test-jsonMarshal-error")
 					}
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckResultFn{
 					model.CheckResultError("test-jsonMarshal-error"),
 				},
 			},
+			{
+				name: "success-compressed",
+				before: func(n *AMQPNotifier) {
+					var (
+						payload = []byte("test")
+						w       = n.wrapper.(*MockInternalWrapper)
+					)
+
+					n.jsonMarshal = func(v any) ([]byte, error) {
+						return payload, nil
+					}
+
+					n.Compression = &utils.Compression{Encoding: utils.EncodingGzip}
+
+					w.On("Send", mock.Anything, "", mock.MatchedBy(func(msg *amqp.Message) bool {
+						if msg.Properties == nil || msg.Properties.ContentEncoding == nil {
+							return false
+						}
+
+						plain, err := utils.Decompress(*msg.Properties.ContentEncoding, msg.GetData())
+						return *msg.Properties.ContentEncoding == utils.EncodingGzip && err == nil && string(plain) == "test"
+					}), (*amqp.SendOptions)(nil)).
+						Return(nil)
+				},
+				checks: []model.TestCheckResultFn{
+					model.CheckResultError(""),
+					checkSuccess,
+				},
+			},
+			{
+				name: "fail-compress",
+				before: func(n *AMQPNotifier) {
+					n.jsonMarshal = func(v any) ([]byte, error) {
+						return []byte("test"), nil
+					}
+
+					n.Compression = &utils.Compression{Encoding: "br"}
+				},
+				checks: []model.TestCheckResultFn{
+					model.CheckResultError("compressing payload:"),
+				},
+			},
 			{
 				name: "fail-Send",
 				before: func(n *AMQPNotifier) {
@@ -656,7 +713,7 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 						return payload, nil
 					}
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(fmt.Errorf("test-Send-error"))
 				},
 				checks: []model.TestCheckResultFn{
@@ -677,7 +734,7 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 
 					n.wrapper.(*MockInternalWrapper).wait = 50 * time.Millisecond
 
-					w.On("Send", mock.Anything, amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+					w.On("Send", mock.Anything, "", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
 						Return(nil)
 				},
 				checks: []model.TestCheckResultFn{
@@ -697,6 +754,9 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 				DeliveryTimeout: 10,
 			})
 
+			// the sender link is opened on first use
+			n.wrapper.(*MockInternalWrapper).On("NewSender", mock.Anything, "", (*amqp.SenderOptions)(nil)).Return(nil).Maybe()
+
 			if tt.before != nil {
 				tt.before(n)
 			}
@@ -0,0 +1,56 @@
+package amqp10
+
+import (
+	"fmt"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/utils"
+)
+
+// connOptions adds the TLS and SASL options to ConnOptions, which are
+// returned as is when neither is set. Service Bus connections are anonymous
+// unless SASL is set, senders are authorized with tokens
+func (n *AMQPNotifier) connOptions() (*amqp.ConnOptions, error) {
+	if n.TLS == nil && n.SASL == nil && n.ServiceBus == nil {
+		return n.ConnOptions, nil
+	}
+
+	// don't modify the options owned by the caller
+	opts := amqp.ConnOptions{}
+	if n.ConnOptions != nil {
+		opts = *n.ConnOptions
+	}
+
+	if n.TLS != nil {
+		tlsConfig, err := n.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		opts.TLSConfig = tlsConfig
+	}
+
+	if n.ServiceBus != nil && n.SASL == nil {
+		opts.SASLType = amqp.SASLTypeAnonymous()
+	}
+
+	if n.SASL != nil {
+		mechanism, username, password, err := n.SASL.Credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		switch mechanism {
+		case utils.SASLPlain:
+			opts.SASLType = amqp.SASLTypePlain(username, password)
+		case utils.SASLExternal:
+			opts.SASLType = amqp.SASLTypeExternal("")
+		case utils.SASLAnonymous:
+			opts.SASLType = amqp.SASLTypeAnonymous()
+		default:
+			return nil, fmt.Errorf("unsupported SASL mechanism %q", mechanism)
+		}
+	}
+
+	return &opts, nil
+}
@@ -0,0 +1,116 @@
+package amqp10
+
+import (
+	"testing"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAMQPNotifier_connOptions(t *testing.T) {
+	var (
+		connOptions = &amqp.ConnOptions{ContainerID: "notifier"}
+
+		tests = []struct {
+			name        string
+			connOptions *amqp.ConnOptions
+			tls         *utils.TLSOptions
+			sasl        *utils.SASL
+			wantSame    bool
+			wantTLS     bool
+			wantSASL    bool
+			wantErrMsg  string
+		}{
+			{
+				name:     "none-nil",
+				wantSame: true,
+			},
+			{
+				name:        "none-kept",
+				connOptions: connOptions,
+				wantSame:    true,
+			},
+			{
+				name:        "tls-and-plain",
+				connOptions: connOptions,
+				tls:         &utils.TLSOptions{ServerName: "broker.internal"},
+				sasl:        &utils.SASL{Username: utils.Secret{Value: "guest"}, Password: utils.Secret{Value: "guest"}},
+				wantTLS:     true,
+				wantSASL:    true,
+			},
+			{
+				name:     "external",
+				tls:      &utils.TLSOptions{},
+				sasl:     &utils.SASL{Mechanism: utils.SASLExternal},
+				wantTLS:  true,
+				wantSASL: true,
+			},
+			{
+				name:     "anonymous",
+				sasl:     &utils.SASL{Mechanism: utils.SASLAnonymous},
+				wantSASL: true,
+			},
+			{
+				name:       "fail-tls",
+				tls:        &utils.TLSOptions{CAFile: "testdata/missing.pem"},
+				wantErrMsg: "reading CA file",
+			},
+			{
+				name:       "fail-sasl",
+				sasl:       &utils.SASL{Mechanism: "GSSAPI"},
+				wantErrMsg: `unsupported SASL mechanism "GSSAPI"`,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(&Config{
+				ConnOptions: tt.connOptions,
+				TLS:         tt.tls,
+				SASL:        tt.sasl,
+				wrapper:     &MockInternalWrapper{},
+			})
+
+			got, err := n.connOptions()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.wantSame {
+				assert.Same(t, tt.connOptions, got)
+				return
+			}
+
+			assert.Equal(t, tt.wantTLS, got.TLSConfig != nil)
+			assert.Equal(t, tt.wantSASL, got.SASLType != nil)
+
+			if tt.connOptions != nil {
+				assert.Equal(t, tt.connOptions.ContainerID, got.ContainerID)
+			}
+		})
+	}
+
+	// the options of the caller are not modified
+	assert.Nil(t, connOptions.TLSConfig)
+	assert.Nil(t, connOptions.SASLType)
+}
+
+func TestAMQPNotifier_ConnectAuth(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			Address: "amqps://broker.internal",
+			SASL:    &utils.SASL{Username: utils.Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wrapper: w,
+		})
+	)
+
+	assert.ErrorContains(t, n.Connect(), "configuring connection: resolving username")
+	w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything, mock.Anything)
+}
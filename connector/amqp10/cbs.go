@@ -0,0 +1,181 @@
+package amqp10
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/utils"
+)
+
+// CBS (claims-based security) request properties
+const (
+	cbsAddress           = "$cbs"
+	cbsOperation         = "operation"
+	cbsPutToken          = "put-token"
+	cbsType              = "type"
+	cbsName              = "name"
+	cbsExpiration        = "expiration"
+	cbsTokenType         = "servicebus.windows.net:sastoken"
+	cbsStatusCode        = "status-code"
+	cbsStatusDescription = "status-description"
+)
+
+// cbsLink is the request/response link pair attached to the $cbs node,
+// responses are sent to the ReplyTo address
+type cbsLink interface {
+	ReplyTo() string
+	Send(ctx context.Context, msg *amqp.Message) error
+	// Receive returns the next response, accepting it
+	Receive(ctx context.Context) (*amqp.Message, error)
+}
+
+// putToken authorizes the audience with the token
+func putToken(ctx context.Context, link cbsLink, audience, token string, expiry time.Time) error {
+	var (
+		id      = utils.RandomId(utils.ID12)
+		replyTo = link.ReplyTo()
+		request = &amqp.Message{
+			Value: token,
+			Properties: &amqp.MessageProperties{
+				MessageID: id,
+				ReplyTo:   &replyTo,
+			},
+			ApplicationProperties: map[string]any{
+				cbsOperation:  cbsPutToken,
+				cbsType:       cbsTokenType,
+				cbsName:       audience,
+				cbsExpiration: expiry,
+			},
+		}
+	)
+
+	if err := link.Send(ctx, request); err != nil {
+		return fmt.Errorf("sending put-token request: %w", err)
+	}
+
+	for {
+		response, err := link.Receive(ctx)
+		if err != nil {
+			return fmt.Errorf("receiving put-token response: %w", err)
+		}
+
+		// responses to requests that timed out before
+		if response.Properties != nil && response.Properties.CorrelationID != nil && response.Properties.CorrelationID != id {
+			continue
+		}
+
+		return cbsStatus(response)
+	}
+}
+
+// cbsStatus checks the status code of a CBS response
+func cbsStatus(response *amqp.Message) error {
+	var code int64
+
+	switch v := response.ApplicationProperties[cbsStatusCode].(type) {
+	case int32:
+		code = int64(v)
+	case int64:
+		code = v
+	case int:
+		code = int64(v)
+	default:
+		return fmt.Errorf("put-token response without status code")
+	}
+
+	if code == 200 || code == 202 {
+		return nil
+	}
+
+	description, _ := response.ApplicationProperties[cbsStatusDescription].(string)
+
+	return fmt.Errorf("put-token rejected: %d %s", code, description)
+}
+
+// cbsSender and cbsReceiver are the methods of *amqp.Sender and
+// *amqp.Receiver the $cbs link pair uses
+type cbsSender interface {
+	Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error
+	Close(ctx context.Context) error
+}
+
+type cbsReceiver interface {
+	Receive(ctx context.Context, opts *amqp.ReceiveOptions) (*amqp.Message, error)
+	AcceptMessage(ctx context.Context, msg *amqp.Message) error
+	Close(ctx context.Context) error
+}
+
+// cbsSession attaches the links of the $cbs link pair
+type cbsSession interface {
+	NewSender(ctx context.Context, target string, opts *amqp.SenderOptions) (cbsSender, error)
+	NewReceiver(ctx context.Context, source string, opts *amqp.ReceiverOptions) (cbsReceiver, error)
+}
+
+// amqpSession is a cbsSession over a go-amqp session
+type amqpSession struct {
+	session *amqp.Session
+}
+
+func (s amqpSession) NewSender(ctx context.Context, target string, opts *amqp.SenderOptions) (cbsSender, error) {
+	sender, err := s.session.NewSender(ctx, target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return sender, nil
+}
+
+func (s amqpSession) NewReceiver(ctx context.Context, source string, opts *amqp.ReceiverOptions) (cbsReceiver, error) {
+	receiver, err := s.session.NewReceiver(ctx, source, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return receiver, nil
+}
+
+// newCBSLink attaches the link pair of internalWrapper.NewCBSLink
+func newCBSLink(ctx context.Context, session cbsSession, replyTo string) (*amqpCBSLink, error) {
+	sender, err := session.NewSender(ctx, cbsAddress, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	receiver, err := session.NewReceiver(ctx, cbsAddress, &amqp.ReceiverOptions{TargetAddress: replyTo})
+	if err != nil {
+		_ = sender.Close(ctx)
+		return nil, err
+	}
+
+	return &amqpCBSLink{replyTo: replyTo, sender: sender, receiver: receiver}, nil
+}
+
+// amqpCBSLink is a cbsLink over a sender and a receiver on the session
+type amqpCBSLink struct {
+	replyTo  string
+	sender   cbsSender
+	receiver cbsReceiver
+}
+
+func (l *amqpCBSLink) ReplyTo() string {
+	return l.replyTo
+}
+
+func (l *amqpCBSLink) Send(ctx context.Context, msg *amqp.Message) error {
+	return l.sender.Send(ctx, msg, nil)
+}
+
+func (l *amqpCBSLink) Receive(ctx context.Context) (*amqp.Message, error) {
+	msg, err := l.receiver.Receive(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.receiver.AcceptMessage(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,50 @@
+package amqp10
+
+import (
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+)
+
+// setProperties maps the notification metadata to the message properties and
+// application properties so consumers can route and filter without parsing
+// the body
+func setProperties(msg *amqp.Message, message *model.Notification, encoding string) {
+	var (
+		props amqp.MessageProperties
+		set   bool
+	)
+
+	if message.ID != "" {
+		props.MessageID, set = message.ID, true
+	}
+
+	if message.Event != "" {
+		subject := string(message.Event)
+		props.Subject, set = &subject, true
+	}
+
+	if !message.Timestamp.IsZero() {
+		timestamp := message.Timestamp
+		props.CreationTime, set = &timestamp, true
+	}
+
+	if message.CorrelationID != "" {
+		props.CorrelationID, set = message.CorrelationID, true
+	}
+
+	if encoding != "" {
+		props.ContentEncoding, set = &encoding, true
+	}
+
+	// messages without metadata are sent without properties
+	if set {
+		msg.Properties = &props
+	}
+
+	if len(message.Metadata) > 0 {
+		msg.ApplicationProperties = make(map[string]any, len(message.Metadata))
+		for k, v := range message.Metadata {
+			msg.ApplicationProperties[k] = v
+		}
+	}
+}
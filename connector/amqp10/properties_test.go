@@ -0,0 +1,62 @@
+package amqp10
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetProperties(t *testing.T) {
+	var (
+		timestamp = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		subject   = "orders.created"
+		encoding  = "gzip"
+
+		tests = []struct {
+			name     string
+			message  *model.Notification
+			encoding string
+			want     *amqp.Message
+		}{
+			{
+				name:    "empty",
+				message: &model.Notification{Data: "test"},
+				want:    amqp.NewMessage([]byte("test")),
+			},
+			{
+				name: "all",
+				message: &model.Notification{
+					ID:            "abc",
+					Event:         "orders.created",
+					Timestamp:     timestamp,
+					CorrelationID: "req-1",
+					Metadata:      map[string]string{"tenant": "acme"},
+				},
+				encoding: encoding,
+				want: &amqp.Message{
+					Data: [][]byte{[]byte("test")},
+					Properties: &amqp.MessageProperties{
+						MessageID:       "abc",
+						Subject:         &subject,
+						CreationTime:    &timestamp,
+						CorrelationID:   "req-1",
+						ContentEncoding: &encoding,
+					},
+					ApplicationProperties: map[string]any{"tenant": "acme"},
+				},
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			msg := amqp.NewMessage([]byte("test"))
+			setProperties(msg, tt.message, tt.encoding)
+			assert.Equal(t, tt.want, msg)
+		})
+	}
+}
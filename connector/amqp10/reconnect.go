@@ -0,0 +1,183 @@
+package amqp10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/utils"
+)
+
+// ReconnectOptions enables the recovery of the connection, session and sender
+// link when sending fails because any of them was closed or detached
+type ReconnectOptions struct {
+	// InitialInterval is the wait before the first attempt, doubled after each failure
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between attempts
+	MaxInterval time.Duration
+	// MaxAttempts gives up after the given number of failed attempts, 0 retries
+	// until the delivery times out
+	MaxAttempts int
+}
+
+// recovery tells what has to be re-created after a send error
+type recovery int
+
+const (
+	recoverNone recovery = iota
+	recoverSender
+	recoverSession
+	recoverConn
+)
+
+func (r recovery) String() string {
+	switch r {
+	case recoverSender:
+		return "sender link"
+	case recoverSession:
+		return "session"
+	case recoverConn:
+		return "connection"
+	default:
+		return "none"
+	}
+}
+
+// recoveryFor classifies a send error
+func recoveryFor(err error) recovery {
+	var (
+		connErr    *amqp.ConnError
+		sessionErr *amqp.SessionError
+		linkErr    *amqp.LinkError
+	)
+
+	switch {
+	case errors.As(err, &connErr):
+		return recoverConn
+	case errors.As(err, &sessionErr):
+		return recoverSession
+	case errors.As(err, &linkErr):
+		return recoverSender
+	default:
+		return recoverNone
+	}
+}
+
+// recover re-creates what failed, starting from the least disruptive step and
+// falling back to a new connection, retrying with backoff. seen is the
+// generation of the link when the send failed, if it changed another delivery
+// already recovered. The first attempt is made right away and the lock is
+// only held while attempting, so other deliveries aren't blocked by the waits
+func (n *AMQPNotifier) recover(ctx context.Context, what recovery, target string, seen generation) error {
+	backoff := &utils.Backoff{
+		Initial: n.Reconnect.InitialInterval,
+		Max:     n.Reconnect.MaxInterval,
+	}
+
+	for attempt := 1; ; attempt++ {
+		done, err := n.attempt(ctx, what, target, seen)
+		if done {
+			return nil
+		}
+
+		if err == nil {
+			n.Logger.Printf("%s: %s recovered", n.Name(), what)
+			return nil
+		}
+
+		n.Logger.Printf("%s: recovering %s, attempt %d: %v", n.Name(), what, attempt, err)
+
+		if n.Reconnect.MaxAttempts > 0 && attempt >= n.Reconnect.MaxAttempts {
+			return fmt.Errorf("giving up recovering %s after %d attempts: %w", what, attempt, err)
+		}
+
+		// the session or the connection might be gone too
+		what = recoverConn
+
+		timer := time.NewTimer(backoff.Next())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("recovering %s: %w", what, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt re-creates what failed unless another delivery already did it,
+// which is reported in done
+func (n *AMQPNotifier) attempt(ctx context.Context, what recovery, target string, seen generation) (done bool, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.recovered(what, target, seen) {
+		return true, nil
+	}
+
+	return false, n.reopen(ctx, what, target)
+}
+
+// recovered tells if the session, or the link to the target, were
+// re-created after the send failed
+func (n *AMQPNotifier) recovered(what recovery, target string, seen generation) bool {
+	if n.generation != seen.session {
+		return true
+	}
+
+	if what != recoverSender {
+		return false
+	}
+
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	// closed while idle, it's opened again when sending
+	l, ok := n.links[target]
+	return !ok || l.generation != seen.link
+}
+
+// reopen re-creates the sender link to the target, the session or the whole
+// connection. Links to other targets are opened again when needed
+func (n *AMQPNotifier) reopen(ctx context.Context, what recovery, target string) error {
+	switch what {
+	case recoverConn:
+		// the connection is probably closed already
+		_ = n.wrapper.CloseConn()
+
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+
+		n.generation++
+	case recoverSession:
+		_ = n.wrapper.CloseSession(ctx)
+
+		if err := n.wrapper.NewSession(ctx, n.SessionOptions); err != nil {
+			return fmt.Errorf("creating AMQP session: %w", err)
+		}
+
+		n.generation++
+		n.resetLinks()
+	}
+
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	if _, ok := n.links[target]; ok && what != recoverSender {
+		// opened by connect
+		return nil
+	}
+
+	if what == recoverSender {
+		// release the detached link before replacing it
+		if err := n.wrapper.CloseSender(ctx, target); err != nil {
+			n.Logger.Printf("%s: closing sender link %s: %v", n.Name(), target, err)
+		}
+	}
+
+	_, err := n.openSender(ctx, target)
+
+	return err
+}
@@ -0,0 +1,368 @@
+package amqp10
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecoveryFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want recovery
+	}{
+		{name: "conn", err: &amqp.ConnError{}, want: recoverConn},
+		{name: "session", err: &amqp.SessionError{}, want: recoverSession},
+		{name: "link", err: &amqp.LinkError{}, want: recoverSender},
+		{name: "wrapped-link", err: fmt.Errorf("sending: %w", &amqp.LinkError{}), want: recoverSender},
+		{name: "other", err: fmt.Errorf("test-error"), want: recoverNone},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := recoveryFor(tt.err)
+			assert.Equalf(t, tt.want, got, "recoveryFor() = %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverRecover(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		logger  = log.New(&buf, "test:", log.LstdFlags)
+		message = &model.Notification{Data: "test"}
+		payload = []byte("test")
+
+		checkSuccess = func(want bool) model.TestCheckResultFn {
+			return func(t *testing.T, n model.Notifier, r *model.Result) {
+				t.Helper()
+				assert.Equal(t, want, r.Success)
+			}
+		}
+
+		tests = []struct {
+			name       string
+			reconnect  *ReconnectOptions
+			before     func(w *MockInternalWrapper)
+			checks     []model.TestCheckResultFn
+			wantCalls  map[string]int
+			wantLog    string
+			generation uint64
+		}{
+			{
+				name:      "success-link-detached",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.LinkError{RemoteErr: &amqp.Error{Condition: amqp.ErrCondDetachForced}}).Once()
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(nil)
+					w.On("CloseSender", mock.Anything, "test-queue").Return(nil)
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).
+						Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+				),
+				wantCalls:  map[string]int{"Send": 2, "CloseSender": 1, "NewSender": 1, "NewSession": 0, "Dial": 0},
+				wantLog:    "sender link recovered",
+				generation: 0,
+			},
+			{
+				name:      "success-session-closed",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.SessionError{}).Once()
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(nil)
+					w.On("CloseSession", mock.Anything).Return(fmt.Errorf("already closed"))
+					w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+				),
+				wantCalls:  map[string]int{"Send": 2, "NewSender": 1, "NewSession": 1, "Dial": 0},
+				wantLog:    "session recovered",
+				generation: 1,
+			},
+			{
+				name:      "success-conn-closed",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.ConnError{}).Once()
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(nil)
+					w.On("CloseConn").Return(nil)
+					w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).
+						Return(fmt.Errorf("test-Dial-error")).Once()
+					w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).Return(nil)
+					w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+				),
+				wantCalls:  map[string]int{"Send": 2, "NewSender": 1, "NewSession": 1, "Dial": 2},
+				wantLog:    "recovering connection, attempt 1: dialing AMQP server: test-Dial-error",
+				generation: 1,
+			},
+			{
+				name:      "success-link-fallback-conn",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.LinkError{}).Once()
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(nil)
+					w.On("CloseSender", mock.Anything, "test-queue").Return(fmt.Errorf("already detached"))
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).
+						Return(&amqp.ConnError{}).Once()
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).
+						Return(nil)
+					w.On("CloseConn").Return(nil)
+					w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).Return(nil)
+					w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+					checkSuccess(true),
+				),
+				wantCalls:  map[string]int{"Send": 2, "CloseSender": 1, "NewSender": 2, "NewSession": 1, "Dial": 1},
+				wantLog:    "connection recovered",
+				generation: 1,
+			},
+			{
+				name:      "fail-max-attempts",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond, MaxAttempts: 2},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.ConnError{})
+					w.On("CloseConn").Return(nil)
+					w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).
+						Return(fmt.Errorf("test-Dial-error"))
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: giving up recovering connection after 2 attempts: dialing AMQP server: test-Dial-error"),
+					checkSuccess(false),
+				),
+				wantCalls: map[string]int{"Send": 1, "Dial": 2},
+			},
+			{
+				name:      "fail-timeout",
+				reconnect: &ReconnectOptions{InitialInterval: time.Hour},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.LinkError{})
+					w.On("CloseSender", mock.Anything, "test-queue").Return(nil)
+					w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).
+						Return(&amqp.LinkError{})
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: recovering connection: context deadline exceeded"),
+				),
+				// the first attempt doesn't wait for the backoff
+				wantCalls: map[string]int{"Send": 1, "NewSender": 1},
+			},
+			{
+				name:      "fail-not-recoverable",
+				reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(fmt.Errorf("test-Send-error"))
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: test-Send-error"),
+				),
+				wantCalls: map[string]int{"Send": 1, "NewSender": 0},
+			},
+			{
+				name: "fail-reconnect-disabled",
+				before: func(w *MockInternalWrapper) {
+					w.On("Send", mock.Anything, "test-queue", amqp.NewMessage(payload), (*amqp.SendOptions)(nil)).
+						Return(&amqp.LinkError{})
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("sending message: amqp: link closed"),
+				),
+				wantCalls: map[string]int{"Send": 1, "NewSender": 0},
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					Address:         "amqp://example.com",
+					QueueName:       "test-queue",
+					DeliveryTimeout: 100,
+					Reconnect:       tt.reconnect,
+					ctx:             context.TODO(),
+					wrapper:         w,
+					Logger:          logger,
+				})
+			)
+
+			n.jsonMarshal = func(v any) ([]byte, error) {
+				return payload, nil
+			}
+
+			// the sender link was opened when connecting
+			n.links["test-queue"] = &link{}
+
+			if tt.before != nil {
+				tt.before(w)
+			}
+
+			r := n.Deliver(message)
+			for _, c := range tt.checks {
+				c(t, n, r)
+			}
+
+			for method, calls := range tt.wantCalls {
+				w.AssertNumberOfCalls(t, method, calls)
+			}
+
+			assert.Equal(t, tt.generation, n.generation)
+
+			if tt.wantLog != "" {
+				assert.Contains(t, buf.String(), tt.wantLog)
+			}
+
+			buf.Reset()
+		})
+	}
+}
+
+func TestAMQPNotifier_recoverAlreadyRecovered(t *testing.T) {
+	tests := []struct {
+		name   string
+		what   recovery
+		before func(n *AMQPNotifier)
+	}{
+		{
+			name: "session-recreated",
+			what: recoverConn,
+			before: func(n *AMQPNotifier) {
+				n.generation = 1
+			},
+		},
+		{
+			name: "link-recreated",
+			what: recoverSender,
+			before: func(n *AMQPNotifier) {
+				n.links["test-queue"] = &link{generation: 2}
+			},
+		},
+		{
+			name: "link-closed-idle",
+			what: recoverSender,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					Reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+					wrapper:   w,
+				})
+			)
+
+			// another delivery recovered the link after this one failed
+			if tt.before != nil {
+				tt.before(n)
+			}
+
+			assert.NoError(t, n.recover(context.TODO(), tt.what, "test-queue", generation{link: 1}))
+			w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything, mock.Anything)
+			w.AssertNotCalled(t, "NewSender", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAMQPNotifier_recoverOtherTarget(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			Reconnect: &ReconnectOptions{InitialInterval: time.Millisecond},
+			wrapper:   w,
+			Logger:    log.New(&bytes.Buffer{}, "test:", log.LstdFlags),
+		})
+	)
+
+	// the link to another target was recovered, this one is still detached
+	n.links["orders"] = &link{generation: 3}
+	n.links["audit"] = &link{generation: 1}
+	n.linkSeq = 3
+
+	w.On("CloseSender", mock.Anything, "audit").Return(nil)
+	w.On("NewSender", mock.Anything, "audit", (*amqp.SenderOptions)(nil)).Return(nil)
+
+	assert.NoError(t, n.recover(context.TODO(), recoverSender, "audit", generation{link: 1}))
+	w.AssertNumberOfCalls(t, "CloseSender", 1)
+	w.AssertNumberOfCalls(t, "NewSender", 1)
+	assert.Equal(t, uint64(4), n.links["audit"].generation)
+	assert.Equal(t, uint64(3), n.links["orders"].generation)
+}
+
+func TestAMQPNotifier_recoverUnlocked(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			Reconnect: &ReconnectOptions{InitialInterval: time.Hour},
+			wrapper:   w,
+			Logger:    log.New(&bytes.Buffer{}, "test:", log.LstdFlags),
+		})
+		ctx, cancel = context.WithTimeout(context.TODO(), 200*time.Millisecond)
+		attempted   = make(chan struct{})
+		done        = make(chan error)
+	)
+
+	defer cancel()
+
+	n.links["test-queue"] = &link{generation: 1}
+	w.On("CloseSender", mock.Anything, "test-queue").Return(nil)
+	w.On("NewSender", mock.Anything, "test-queue", (*amqp.SenderOptions)(nil)).
+		Run(func(mock.Arguments) { close(attempted) }).
+		Return(&amqp.LinkError{})
+
+	go func() {
+		done <- n.recover(ctx, recoverSender, "test-queue", generation{link: 1})
+	}()
+
+	// the first attempt doesn't wait for the backoff
+	<-attempted
+
+	// other deliveries can send while the recovery waits to try again
+	assert.Eventually(t, func() bool {
+		if !n.lock.TryRLock() {
+			return false
+		}
+		n.lock.RUnlock()
+
+		return true
+	}, time.Second, time.Millisecond)
+
+	assert.ErrorContains(t, <-done, "context deadline exceeded")
+}
@@ -0,0 +1,274 @@
+package amqp10
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Service Bus message annotations
+const (
+	annotationPartitionKey         = "x-opt-partition-key"
+	annotationScheduledEnqueueTime = "x-opt-scheduled-enqueue-time"
+)
+
+// ServiceBusOptions enables the Azure Service Bus mode. Senders are authorized
+// with SAS tokens put on the $cbs node and renewed before they expire, the
+// connection uses SASL ANONYMOUS unless SASL is set
+type ServiceBusOptions struct {
+	// KeyName and Key are the shared access policy used to sign the tokens
+	KeyName string
+	Key     utils.Secret
+	// TokenTTL is how long tokens are valid, 1 hour if not set
+	TokenTTL time.Duration
+	// RenewBefore is how long before expiring tokens are renewed, 5 minutes if not set
+	RenewBefore time.Duration
+	// SessionID is a template for the session of session-enabled entities
+	SessionID string
+	// PartitionKey is a template for the partition of partitioned entities
+	PartitionKey string
+	// ScheduledEnqueueTime is a template rendering an RFC 3339 time, messages
+	// become available at that time
+	ScheduledEnqueueTime string
+	// Annotations holds message annotations, values can be templates
+	Annotations map[string]string
+}
+
+// serviceBus holds the parsed Service Bus options
+type serviceBus struct {
+	*ServiceBusOptions
+	host         string
+	sessionID    *utils.Template
+	partitionKey *utils.Template
+	scheduled    *utils.Template
+	annotations  map[string]*utils.Template
+	keys         []string
+	now          func() time.Time
+}
+
+func newServiceBus(address string, options *ServiceBusOptions) (*serviceBus, error) {
+	if options == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing address: %w", err)
+	}
+
+	sb := &serviceBus{
+		ServiceBusOptions: options,
+		host:              u.Host,
+		annotations:       make(map[string]*utils.Template, len(options.Annotations)),
+		now:               time.Now,
+	}
+
+	if sb.TokenTTL == 0 {
+		sb.TokenTTL = time.Hour
+	}
+
+	if sb.RenewBefore == 0 {
+		sb.RenewBefore = 5 * time.Minute
+	}
+
+	if sb.RenewBefore >= sb.TokenTTL {
+		return nil, fmt.Errorf("RenewBefore must be shorter than TokenTTL")
+	}
+
+	parse := func(name, text string) (*utils.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+
+		tpl, err := utils.ParseTemplate(name, text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s template: %w", name, err)
+		}
+
+		return tpl, nil
+	}
+
+	if sb.sessionID, err = parse("session id", options.SessionID); err != nil {
+		return nil, err
+	}
+
+	if sb.partitionKey, err = parse("partition key", options.PartitionKey); err != nil {
+		return nil, err
+	}
+
+	if sb.scheduled, err = parse("scheduled enqueue time", options.ScheduledEnqueueTime); err != nil {
+		return nil, err
+	}
+
+	for k, v := range options.Annotations {
+		if sb.annotations[k], err = utils.ParseTemplate(k, v); err != nil {
+			return nil, fmt.Errorf("parsing annotation %s template: %w", k, err)
+		}
+
+		sb.keys = append(sb.keys, k)
+	}
+
+	// render annotations in a stable order
+	sort.Strings(sb.keys)
+
+	return sb, nil
+}
+
+// audience is the resource a token for the target is valid for
+func (sb *serviceBus) audience(target string) string {
+	return fmt.Sprintf("sb://%s/%s", sb.host, target)
+}
+
+// token signs a SAS token for the audience
+func (sb *serviceBus) token(audience string) (string, time.Time, error) {
+	key, err := sb.Key.Resolve()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("resolving key: %w", err)
+	}
+
+	expiry := sb.now().Add(sb.TokenTTL)
+
+	return sasToken(audience, sb.KeyName, key, expiry), expiry, nil
+}
+
+// sasToken builds a shared access signature as described in
+// https://learn.microsoft.com/azure/service-bus-messaging/service-bus-sas
+func sasToken(audience, keyName, key string, expiry time.Time) string {
+	var (
+		resource = url.QueryEscape(audience)
+		expires  = strconv.FormatInt(expiry.Unix(), 10)
+		mac      = hmac.New(sha256.New, []byte(key))
+	)
+
+	mac.Write([]byte(resource + "\n" + expires))
+	signature := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", resource, signature, expires, keyName)
+}
+
+// annotate maps the notification to the Service Bus properties and annotations
+func (sb *serviceBus) annotate(msg *amqp.Message, message *model.Notification) error {
+	if sb.sessionID != nil {
+		sessionID, err := sb.sessionID.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering session id: %w", err)
+		}
+
+		if msg.Properties == nil {
+			msg.Properties = &amqp.MessageProperties{}
+		}
+
+		msg.Properties.GroupID = &sessionID
+	}
+
+	annotations := amqp.Annotations{}
+
+	if sb.partitionKey != nil {
+		key, err := sb.partitionKey.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering partition key: %w", err)
+		}
+
+		annotations[annotationPartitionKey] = key
+	}
+
+	if sb.scheduled != nil {
+		text, err := sb.scheduled.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering scheduled enqueue time: %w", err)
+		}
+
+		at, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return fmt.Errorf("parsing scheduled enqueue time: %w", err)
+		}
+
+		annotations[annotationScheduledEnqueueTime] = at
+	}
+
+	for _, k := range sb.keys {
+		v, err := sb.annotations[k].Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering annotation %s: %w", k, err)
+		}
+
+		annotations[k] = v
+	}
+
+	if len(annotations) > 0 {
+		msg.Annotations = annotations
+	}
+
+	return nil
+}
+
+// authorize puts a token for the target on the $cbs node and records when it
+// expires. It must be called holding linksLock
+func (n *AMQPNotifier) authorize(ctx context.Context, target string) (time.Time, error) {
+	audience := n.serviceBus.audience(target)
+
+	token, expiry, err := n.serviceBus.token(audience)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if n.cbs == nil {
+		if n.cbs, err = n.wrapper.NewCBSLink(ctx, "cbs-"+utils.RandomId(utils.ID8)); err != nil {
+			return time.Time{}, fmt.Errorf("creating $cbs link: %w", err)
+		}
+	}
+
+	if err := putToken(ctx, n.cbs, audience, token, expiry); err != nil {
+		return time.Time{}, err
+	}
+
+	return expiry, nil
+}
+
+// renewTokens renews the tokens of the links expiring soon
+func (n *AMQPNotifier) renewTokens(ctx context.Context, now time.Time) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	for target, l := range n.links {
+		if l.expiry.Sub(now) > n.serviceBus.RenewBefore {
+			continue
+		}
+
+		expiry, err := n.authorize(ctx, target)
+		if err != nil {
+			n.Logger.Printf("%s: renewing token for %s: %v", n.Name(), target, err)
+			continue
+		}
+
+		l.expiry = expiry
+	}
+}
+
+// watchTokens renews tokens until the notifier is closed
+func (n *AMQPNotifier) watchTokens() {
+	ticker := time.NewTicker(n.serviceBus.RenewBefore / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case now := <-ticker.C:
+			n.renewTokens(n.ctx, now)
+		}
+	}
+}
@@ -0,0 +1,624 @@
+package amqp10
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeCBS is a $cbs node answering put-token requests with the given status
+type fakeCBS struct {
+	lock      sync.Mutex
+	requests  []*amqp.Message
+	responses chan *amqp.Message
+	status    any
+	sendErr   error
+	// stale is answered before the response to the request
+	stale *amqp.Message
+}
+
+func newFakeCBS(status any) *fakeCBS {
+	return &fakeCBS{status: status, responses: make(chan *amqp.Message, 2)}
+}
+
+func (c *fakeCBS) ReplyTo() string {
+	return "cbs-test"
+}
+
+func (c *fakeCBS) Send(ctx context.Context, msg *amqp.Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+
+	c.requests = append(c.requests, msg)
+
+	if c.stale != nil {
+		c.responses <- c.stale
+	}
+
+	properties := map[string]any{cbsStatusDescription: "test-description"}
+	if c.status != nil {
+		properties[cbsStatusCode] = c.status
+	}
+
+	c.responses <- &amqp.Message{
+		Properties:            &amqp.MessageProperties{CorrelationID: msg.Properties.MessageID},
+		ApplicationProperties: properties,
+	}
+
+	return nil
+}
+
+func (c *fakeCBS) Receive(ctx context.Context) (*amqp.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-c.responses:
+		return msg, nil
+	}
+}
+
+func (c *fakeCBS) audiences() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var result []string
+	for _, r := range c.requests {
+		result = append(result, r.ApplicationProperties[cbsName].(string))
+	}
+
+	return result
+}
+
+func TestSasToken(t *testing.T) {
+	got := sasToken("sb://example.servicebus.windows.net/orders", "RootManageSharedAccessKey", "test-key", time.Unix(1700000000, 0))
+	want := "SharedAccessSignature sr=sb%3A%2F%2Fexample.servicebus.windows.net%2Forders" +
+		"&sig=jy2aGQN5xOgxLLQsPZsOYzdPx2%2F%2FhsA3WfmtJzBZYfQ%3D&se=1700000000&skn=RootManageSharedAccessKey"
+
+	assert.Equal(t, want, got)
+}
+
+func TestNewServiceBus(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         *ServiceBusOptions
+		wantNil         bool
+		wantTokenTTL    time.Duration
+		wantRenewBefore time.Duration
+		wantErrMsg      string
+	}{
+		{
+			name:    "disabled",
+			wantNil: true,
+		},
+		{
+			name:            "defaults",
+			options:         &ServiceBusOptions{},
+			wantTokenTTL:    time.Hour,
+			wantRenewBefore: 5 * time.Minute,
+		},
+		{
+			name:            "custom",
+			options:         &ServiceBusOptions{TokenTTL: 10 * time.Minute, RenewBefore: time.Minute},
+			wantTokenTTL:    10 * time.Minute,
+			wantRenewBefore: time.Minute,
+		},
+		{
+			name:       "fail-renew-before",
+			options:    &ServiceBusOptions{TokenTTL: time.Minute},
+			wantErrMsg: "RenewBefore must be shorter than TokenTTL",
+		},
+		{
+			name:       "fail-session-id",
+			options:    &ServiceBusOptions{SessionID: "{{.Event"},
+			wantErrMsg: "parsing session id template",
+		},
+		{
+			name:       "fail-annotation",
+			options:    &ServiceBusOptions{Annotations: map[string]string{"x-opt-test": "{{.Event"}},
+			wantErrMsg: "parsing annotation x-opt-test template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newServiceBus("amqps://example.servicebus.windows.net", tt.options)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.Equal(t, "example.servicebus.windows.net", got.host)
+			assert.Equal(t, tt.wantTokenTTL, got.TokenTTL)
+			assert.Equal(t, tt.wantRenewBefore, got.RenewBefore)
+		})
+	}
+}
+
+func TestServiceBus_annotate(t *testing.T) {
+	var (
+		message = &model.Notification{
+			Event: "orders.created",
+			Data:  map[string]any{"tenant": "acme", "at": "2024-01-02T03:04:05Z"},
+		}
+
+		tests = []struct {
+			name            string
+			options         *ServiceBusOptions
+			wantGroupID     string
+			wantAnnotations amqp.Annotations
+			wantErrMsg      string
+		}{
+			{
+				name:    "none",
+				options: &ServiceBusOptions{},
+			},
+			{
+				name: "all",
+				options: &ServiceBusOptions{
+					SessionID:            "{{.Data.tenant}}",
+					PartitionKey:         "{{.Event}}",
+					ScheduledEnqueueTime: "{{.Data.at}}",
+					Annotations:          map[string]string{"x-opt-tenant": "{{.Data.tenant}}"},
+				},
+				wantGroupID: "acme",
+				wantAnnotations: amqp.Annotations{
+					annotationPartitionKey:         "orders.created",
+					annotationScheduledEnqueueTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+					"x-opt-tenant":                 "acme",
+				},
+			},
+			{
+				name:       "fail-session-id",
+				options:    &ServiceBusOptions{SessionID: "{{.Data.region}}"},
+				wantErrMsg: "rendering session id",
+			},
+			{
+				name:       "fail-scheduled",
+				options:    &ServiceBusOptions{ScheduledEnqueueTime: "{{.Data.tenant}}"},
+				wantErrMsg: "parsing scheduled enqueue time",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sb, err := newServiceBus("amqps://example.servicebus.windows.net", tt.options)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			msg := amqp.NewMessage([]byte("test"))
+
+			err = sb.annotate(msg, message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAnnotations, msg.Annotations)
+
+			if tt.wantGroupID == "" {
+				assert.Nil(t, msg.Properties)
+				return
+			}
+
+			if assert.NotNil(t, msg.Properties) {
+				assert.Equal(t, tt.wantGroupID, *msg.Properties.GroupID)
+			}
+		})
+	}
+}
+
+func TestPutToken(t *testing.T) {
+	var (
+		expiry = time.Unix(1700000000, 0)
+
+		tests = []struct {
+			name       string
+			cbs        *fakeCBS
+			wantErrMsg string
+		}{
+			{
+				name: "ok-int32",
+				cbs:  newFakeCBS(int32(200)),
+			},
+			{
+				name: "accepted-int64",
+				cbs:  newFakeCBS(int64(202)),
+			},
+			{
+				name: "stale-response",
+				cbs: func() *fakeCBS {
+					c := newFakeCBS(int32(200))
+					c.stale = &amqp.Message{
+						Properties:            &amqp.MessageProperties{CorrelationID: "other"},
+						ApplicationProperties: map[string]any{cbsStatusCode: int32(401)},
+					}
+					return c
+				}(),
+			},
+			{
+				name:       "rejected",
+				cbs:        newFakeCBS(int32(401)),
+				wantErrMsg: "put-token rejected: 401 test-description",
+			},
+			{
+				name:       "missing-status",
+				cbs:        newFakeCBS(nil),
+				wantErrMsg: "put-token response without status code",
+			},
+			{
+				name: "fail-send",
+				cbs: func() *fakeCBS {
+					c := newFakeCBS(int32(200))
+					c.sendErr = fmt.Errorf("test-Send-error")
+					return c
+				}(),
+				wantErrMsg: "sending put-token request: test-Send-error",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+			defer cancel()
+
+			err := putToken(ctx, tt.cbs, "sb://example.servicebus.windows.net/orders", "test-token", expiry)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			request := tt.cbs.requests[0]
+			assert.Equal(t, "test-token", request.Value)
+			assert.Equal(t, "cbs-test", *request.Properties.ReplyTo)
+			assert.Equal(t, map[string]any{
+				cbsOperation:  cbsPutToken,
+				cbsType:       cbsTokenType,
+				cbsName:       "sb://example.servicebus.windows.net/orders",
+				cbsExpiration: expiry,
+			}, request.ApplicationProperties)
+		})
+	}
+}
+
+// fakeCBSSession attaches a fake $cbs link pair answering put-token requests
+// with the given status, like a $cbs node would through go-amqp links
+type fakeCBSSession struct {
+	sender      *fakeCBSSender
+	receiver    *fakeCBSReceiver
+	senderErr   error
+	receiverErr error
+	targets     []string
+	receiverOpt *amqp.ReceiverOptions
+}
+
+func newFakeCBSSession(status any) *fakeCBSSession {
+	receiver := &fakeCBSReceiver{responses: make(chan *amqp.Message, 1)}
+
+	return &fakeCBSSession{
+		sender:   &fakeCBSSender{status: status, receiver: receiver},
+		receiver: receiver,
+	}
+}
+
+func (s *fakeCBSSession) NewSender(ctx context.Context, target string, opts *amqp.SenderOptions) (cbsSender, error) {
+	s.targets = append(s.targets, target)
+	if s.senderErr != nil {
+		return nil, s.senderErr
+	}
+
+	return s.sender, nil
+}
+
+func (s *fakeCBSSession) NewReceiver(ctx context.Context, source string, opts *amqp.ReceiverOptions) (cbsReceiver, error) {
+	s.targets = append(s.targets, source)
+	s.receiverOpt = opts
+	if s.receiverErr != nil {
+		return nil, s.receiverErr
+	}
+
+	return s.receiver, nil
+}
+
+type fakeCBSSender struct {
+	status   any
+	receiver *fakeCBSReceiver
+	requests []*amqp.Message
+	closed   bool
+}
+
+func (s *fakeCBSSender) Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error {
+	s.requests = append(s.requests, msg)
+	s.receiver.responses <- &amqp.Message{
+		Properties:            &amqp.MessageProperties{CorrelationID: msg.Properties.MessageID},
+		ApplicationProperties: map[string]any{cbsStatusCode: s.status, cbsStatusDescription: "test-description"},
+	}
+
+	return nil
+}
+
+func (s *fakeCBSSender) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+type fakeCBSReceiver struct {
+	responses  chan *amqp.Message
+	receiveErr error
+	acceptErr  error
+	accepted   []*amqp.Message
+}
+
+func (r *fakeCBSReceiver) Receive(ctx context.Context, opts *amqp.ReceiveOptions) (*amqp.Message, error) {
+	if r.receiveErr != nil {
+		return nil, r.receiveErr
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-r.responses:
+		return msg, nil
+	}
+}
+
+func (r *fakeCBSReceiver) AcceptMessage(ctx context.Context, msg *amqp.Message) error {
+	if r.acceptErr != nil {
+		return r.acceptErr
+	}
+
+	r.accepted = append(r.accepted, msg)
+
+	return nil
+}
+
+func (r *fakeCBSReceiver) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestNewCBSLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     func(s *fakeCBSSession)
+		status     any
+		wantErrMsg string
+		// wantClosed tells if the sender link was released
+		wantClosed bool
+	}{
+		{
+			name:   "success",
+			status: int32(202),
+		},
+		{
+			name:       "rejected",
+			status:     int32(401),
+			wantErrMsg: "put-token rejected: 401 test-description",
+		},
+		{
+			name:   "fail-sender",
+			status: int32(200),
+			before: func(s *fakeCBSSession) {
+				s.senderErr = fmt.Errorf("test-NewSender-error")
+			},
+			wantErrMsg: "test-NewSender-error",
+		},
+		{
+			name:   "fail-receiver",
+			status: int32(200),
+			before: func(s *fakeCBSSession) {
+				s.receiverErr = fmt.Errorf("test-NewReceiver-error")
+			},
+			wantErrMsg: "test-NewReceiver-error",
+			wantClosed: true,
+		},
+		{
+			name:   "fail-receive",
+			status: int32(200),
+			before: func(s *fakeCBSSession) {
+				s.receiver.receiveErr = fmt.Errorf("test-Receive-error")
+			},
+			wantErrMsg: "receiving put-token response: test-Receive-error",
+		},
+		{
+			name:   "fail-accept",
+			status: int32(200),
+			before: func(s *fakeCBSSession) {
+				s.receiver.acceptErr = fmt.Errorf("test-Accept-error")
+			},
+			wantErrMsg: "receiving put-token response: test-Accept-error",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				session     = newFakeCBSSession(tt.status)
+				ctx, cancel = context.WithTimeout(context.TODO(), time.Second)
+			)
+
+			defer cancel()
+
+			if tt.before != nil {
+				tt.before(session)
+			}
+
+			link, err := newCBSLink(ctx, session, "cbs-test")
+			if err == nil {
+				err = putToken(ctx, link, "sb://example.servicebus.windows.net/orders", "test-token", time.Unix(1700000000, 0))
+			}
+
+			assert.Equal(t, tt.wantClosed, session.sender.closed)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// requests go to $cbs, responses come back on the reply address
+			assert.Equal(t, []string{cbsAddress, cbsAddress}, session.targets)
+			assert.Equal(t, "cbs-test", session.receiverOpt.TargetAddress)
+			assert.Equal(t, "cbs-test", *session.sender.requests[0].Properties.ReplyTo)
+			assert.Len(t, session.receiver.accepted, 1)
+		})
+	}
+}
+
+func TestAMQPNotifier_connOptionsServiceBus(t *testing.T) {
+	n := New(&Config{
+		Address:    "amqps://example.servicebus.windows.net",
+		ServiceBus: &ServiceBusOptions{},
+		wrapper:    &MockInternalWrapper{},
+	})
+
+	got, err := n.connOptions()
+	assert.NoError(t, err)
+	assert.NotNil(t, got.SASLType, "SASL ANONYMOUS not set")
+
+	n.SASL = &utils.SASL{Username: utils.Secret{Value: "guest"}, Password: utils.Secret{Value: "guest"}}
+
+	got, err = n.connOptions()
+	assert.NoError(t, err)
+	assert.NotNil(t, got.SASLType)
+}
+
+func TestAMQPNotifier_DeliverServiceBus(t *testing.T) {
+	var (
+		w   = &MockInternalWrapper{}
+		cbs = newFakeCBS(int32(200))
+		n   = New(&Config{
+			Address:         "amqps://example.servicebus.windows.net",
+			QueueName:       "{{.Event}}",
+			DeliveryTimeout: 1000,
+			ServiceBus: &ServiceBusOptions{
+				KeyName:      "RootManageSharedAccessKey",
+				Key:          utils.Secret{Value: "test-key"},
+				PartitionKey: "{{.Data.tenant}}",
+			},
+			wrapper: w,
+			Logger:  log.New(&bytes.Buffer{}, "test:", log.LstdFlags),
+		})
+		sent *amqp.Message
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	w.On("NewCBSLink", mock.Anything, mock.Anything).Return(cbs, nil).Once()
+	w.On("NewSender", mock.Anything, "orders", (*amqp.SenderOptions)(nil)).Return(nil)
+	w.On("NewSender", mock.Anything, "users", (*amqp.SenderOptions)(nil)).Return(nil)
+	w.On("Send", mock.Anything, mock.Anything, mock.Anything, (*amqp.SendOptions)(nil)).
+		Run(func(args mock.Arguments) { sent = args.Get(2).(*amqp.Message) }).
+		Return(nil)
+
+	r := n.Deliver(&model.Notification{Event: "orders", Data: map[string]any{"tenant": "acme"}})
+	assert.NoError(t, r.Error)
+	assert.Equal(t, "acme", sent.Annotations[annotationPartitionKey])
+
+	r = n.Deliver(&model.Notification{Event: "users", Data: map[string]any{"tenant": "acme"}})
+	assert.NoError(t, r.Error)
+
+	// a token per target over a single $cbs link
+	assert.Equal(t, []string{
+		"sb://example.servicebus.windows.net/orders",
+		"sb://example.servicebus.windows.net/users",
+	}, cbs.audiences())
+	assert.True(t, n.links["orders"].expiry.After(time.Now().Add(55*time.Minute)))
+
+	// annotations failing aren't sent
+	r = n.Deliver(&model.Notification{Event: "orders", Data: map[string]any{}})
+	assert.ErrorContains(t, r.Error, "annotating message: rendering partition key")
+	w.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestAMQPNotifier_DeliverServiceBusUnauthorized(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			Address:         "amqps://example.servicebus.windows.net",
+			QueueName:       "orders",
+			DeliveryTimeout: 1000,
+			ServiceBus:      &ServiceBusOptions{Key: utils.Secret{Value: "test-key"}},
+			wrapper:         w,
+		})
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	w.On("NewCBSLink", mock.Anything, mock.Anything).Return(newFakeCBS(int32(401)), nil)
+
+	r := n.Deliver(&model.Notification{Event: "orders"})
+	assert.ErrorContains(t, r.Error, "authorizing sender link: put-token rejected: 401")
+	assert.NotContains(t, n.links, "orders")
+	w.AssertNotCalled(t, "NewSender", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAMQPNotifier_renewTokens(t *testing.T) {
+	var (
+		buf = bytes.Buffer{}
+		w   = &MockInternalWrapper{}
+		cbs = newFakeCBS(int32(200))
+		n   = New(&Config{
+			Address:    "amqps://example.servicebus.windows.net",
+			ServiceBus: &ServiceBusOptions{Key: utils.Secret{Value: "test-key"}},
+			wrapper:    w,
+			Logger:     log.New(&buf, "test:", log.LstdFlags),
+		})
+		now = time.Now()
+	)
+
+	n.cbs = cbs
+	n.serviceBus.now = func() time.Time { return now }
+	n.links = map[string]*link{
+		"orders": {expiry: now.Add(time.Minute)},
+		"users":  {expiry: now.Add(30 * time.Minute)},
+	}
+
+	n.renewTokens(context.TODO(), now)
+
+	assert.Equal(t, []string{"sb://example.servicebus.windows.net/orders"}, cbs.audiences())
+	assert.Equal(t, now.Add(time.Hour), n.links["orders"].expiry)
+	assert.Equal(t, now.Add(30*time.Minute), n.links["users"].expiry)
+
+	// failures are logged, the link is kept to retry on the next tick
+	cbs.sendErr = fmt.Errorf("test-Send-error")
+	n.renewTokens(context.TODO(), now.Add(56*time.Minute))
+	assert.Contains(t, buf.String(), "renewing token for orders: sending put-token request: test-Send-error")
+	assert.Len(t, n.links, 2)
+}
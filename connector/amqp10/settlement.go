@@ -0,0 +1,65 @@
+package amqp10
+
+import (
+	"fmt"
+
+	amqp "github.com/Azure/go-amqp"
+)
+
+// Settlement is the delivery guarantee of the sender link
+type Settlement string
+
+const (
+	// SettlementDefault keeps the settlement mode set in SenderOptions and
+	// SendOptions
+	SettlementDefault Settlement = ""
+	// AtMostOnce sends messages presettled, deliveries succeed once the
+	// message is written to the link and are lost if the broker fails
+	AtMostOnce Settlement = "at-most-once"
+	// AtLeastOnce sends messages unsettled, deliveries succeed once the broker
+	// accepts the message. A delivery retried after recovering the link can
+	// be received twice
+	AtLeastOnce Settlement = "at-least-once"
+)
+
+// senderOptions returns the sender options with the settlement modes
+// required by the settlement
+func senderOptions(opts *amqp.SenderOptions, settlement Settlement) (*amqp.SenderOptions, error) {
+	var (
+		ssm amqp.SenderSettleMode
+		rsm *amqp.ReceiverSettleMode
+	)
+
+	switch settlement {
+	case SettlementDefault:
+		return opts, nil
+	case AtMostOnce:
+		ssm = amqp.SenderSettleModeSettled
+	case AtLeastOnce:
+		ssm = amqp.SenderSettleModeUnsettled
+		rsm = amqp.ReceiverSettleModeFirst.Ptr()
+	default:
+		return nil, fmt.Errorf("unsupported settlement %q", settlement)
+	}
+
+	// don't modify the options owned by the caller
+	copied := amqp.SenderOptions{}
+	if opts != nil {
+		copied = *opts
+	}
+
+	copied.SettlementMode = ssm.Ptr()
+	copied.RequestedReceiverSettleMode = rsm
+
+	return &copied, nil
+}
+
+// acknowledged tells if the broker confirms each message, which is the case
+// unless messages are sent presettled
+func acknowledged(sender *amqp.SenderOptions, send *amqp.SendOptions) bool {
+	if sender != nil && sender.SettlementMode != nil && *sender.SettlementMode == amqp.SenderSettleModeSettled {
+		return false
+	}
+
+	return send == nil || !send.Settled
+}
@@ -0,0 +1,179 @@
+package amqp10
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSenderOptions(t *testing.T) {
+	var (
+		opts = &amqp.SenderOptions{Name: "test-link"}
+
+		tests = []struct {
+			name       string
+			opts       *amqp.SenderOptions
+			settlement Settlement
+			want       *amqp.SenderOptions
+			wantErrMsg string
+		}{
+			{
+				name: "default-nil",
+				want: nil,
+			},
+			{
+				name: "default-kept",
+				opts: opts,
+				want: opts,
+			},
+			{
+				name:       "at-most-once",
+				opts:       opts,
+				settlement: AtMostOnce,
+				want: &amqp.SenderOptions{
+					Name:           "test-link",
+					SettlementMode: amqp.SenderSettleModeSettled.Ptr(),
+				},
+			},
+			{
+				name:       "at-least-once",
+				settlement: AtLeastOnce,
+				want: &amqp.SenderOptions{
+					SettlementMode:              amqp.SenderSettleModeUnsettled.Ptr(),
+					RequestedReceiverSettleMode: amqp.ReceiverSettleModeFirst.Ptr(),
+				},
+			},
+			{
+				name:       "fail-unsupported",
+				settlement: "exactly-once",
+				wantErrMsg: `unsupported settlement "exactly-once"`,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := senderOptions(tt.opts, tt.settlement)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// the options of the caller are not modified
+	assert.Nil(t, opts.SettlementMode)
+}
+
+func TestAcknowledged(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender *amqp.SenderOptions
+		send   *amqp.SendOptions
+		want   bool
+	}{
+		{name: "default", want: true},
+		{name: "unsettled", sender: &amqp.SenderOptions{SettlementMode: amqp.SenderSettleModeUnsettled.Ptr()}, want: true},
+		{name: "settled", sender: &amqp.SenderOptions{SettlementMode: amqp.SenderSettleModeSettled.Ptr()}, want: false},
+		{name: "mixed-send-settled", send: &amqp.SendOptions{Settled: true}, want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := acknowledged(tt.sender, tt.send)
+			assert.Equalf(t, tt.want, got, "acknowledged() = %t, want %t", got, tt.want)
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverDurability(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		logger  = log.New(&buf, "test:", log.LstdFlags)
+		payload = []byte("test")
+
+		tests = []struct {
+			name             string
+			durable          bool
+			settlement       Settlement
+			wantHeader       *amqp.MessageHeader
+			wantAcknowledged bool
+		}{
+			{
+				name:             "default",
+				wantAcknowledged: true,
+			},
+			{
+				name:             "durable-at-least-once",
+				durable:          true,
+				settlement:       AtLeastOnce,
+				wantHeader:       &amqp.MessageHeader{Durable: true},
+				wantAcknowledged: true,
+			},
+			{
+				name:       "at-most-once",
+				settlement: AtMostOnce,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = &MockInternalWrapper{}
+				n = New(&Config{
+					QueueName:       "test-queue",
+					DeliveryTimeout: 100,
+					Durable:         tt.durable,
+					Settlement:      tt.settlement,
+					ctx:             context.TODO(),
+					wrapper:         w,
+					Logger:          logger,
+				})
+				want = amqp.NewMessage(payload)
+			)
+
+			n.jsonMarshal = func(v any) ([]byte, error) {
+				return payload, nil
+			}
+
+			want.Header = tt.wantHeader
+			w.On("NewSender", mock.Anything, "test-queue", n.SenderOptions).Return(nil)
+			w.On("Send", mock.Anything, "test-queue", want, (*amqp.SendOptions)(nil)).Return(nil)
+
+			r := n.Deliver(&model.Notification{Data: "test"})
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.Equalf(t, tt.wantAcknowledged, r.Acknowledged, "Acknowledged = %t, want %t", r.Acknowledged, tt.wantAcknowledged)
+			w.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAMQPNotifier_ConnectSettlement(t *testing.T) {
+	var (
+		w    = &MockInternalWrapper{}
+		opts = &amqp.SenderOptions{Name: "test-link"}
+		n    = New(&Config{
+			SenderOptions: opts,
+			Settlement:    "exactly-once",
+			wrapper:       w,
+		})
+	)
+
+	assert.ErrorContains(t, n.Connect(), `unsupported settlement "exactly-once"`)
+	assert.Same(t, opts, n.SenderOptions)
+	w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything, mock.Anything)
+}
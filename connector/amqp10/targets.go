@@ -0,0 +1,165 @@
+package amqp10
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// TargetFunc chooses the address a notification is sent to
+type TargetFunc func(message *model.Notification) (string, error)
+
+// link is a sender link opened for a target
+type link struct {
+	// generation identifies this link among the ones opened for the target
+	generation uint64
+	lastUsed   time.Time
+	// expiry is when the Service Bus token of the link expires
+	expiry time.Time
+}
+
+// generation identifies the session and the link used to send a message, a
+// recovery is skipped if another delivery re-created them in the meantime
+type generation struct {
+	session uint64
+	link    uint64
+}
+
+// newTargetFunc returns the function choosing the target of notifications,
+// a TargetFunc in the config takes precedence over Targets, notifications of
+// events not in Targets are sent to QueueName, which can be a template like
+// "notifications.{{.Event}}"
+func newTargetFunc(config *Config) (TargetFunc, error) {
+	if config.TargetFunc != nil {
+		return config.TargetFunc, nil
+	}
+
+	fallback := func(*model.Notification) (string, error) { return config.QueueName, nil }
+
+	if utils.IsTemplate(config.QueueName) {
+		tpl, err := utils.ParseTemplate("target", config.QueueName)
+		if err != nil {
+			return nil, fmt.Errorf("parsing target template: %w", err)
+		}
+
+		fallback = func(message *model.Notification) (string, error) {
+			return tpl.Render(message)
+		}
+	}
+
+	if len(config.Targets) == 0 {
+		return fallback, nil
+	}
+
+	targets := make(map[model.EventType]string, len(config.Targets))
+	for event, target := range config.Targets {
+		targets[event] = target
+	}
+
+	return func(message *model.Notification) (string, error) {
+		if target, ok := targets[message.Event]; ok {
+			return target, nil
+		}
+
+		return fallback(message)
+	}, nil
+}
+
+// single tells if every notification goes to QueueName, its sender link is
+// opened when connecting
+func (n *AMQPNotifier) single() bool {
+	return n.TargetFunc == nil && len(n.Targets) == 0 && !utils.IsTemplate(n.QueueName)
+}
+
+// sender returns the generation of the link for the target, opening the link
+// if not done yet. It must be called holding the read lock
+func (n *AMQPNotifier) sender(ctx context.Context, target string) (generation, error) {
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	l, ok := n.links[target]
+	if !ok {
+		var err error
+		if l, err = n.openSender(ctx, target); err != nil {
+			return generation{session: n.generation}, err
+		}
+	}
+
+	l.lastUsed = time.Now()
+
+	return generation{session: n.generation, link: l.generation}, nil
+}
+
+// openSender opens the sender link for the target, replacing the link opened
+// before if any. It must be called holding linksLock
+func (n *AMQPNotifier) openSender(ctx context.Context, target string) (*link, error) {
+	var expiry time.Time
+
+	if n.serviceBus != nil {
+		var err error
+		if expiry, err = n.authorize(ctx, target); err != nil {
+			delete(n.links, target)
+			return nil, fmt.Errorf("authorizing sender link: %w", err)
+		}
+	}
+
+	if err := n.wrapper.NewSender(ctx, target, n.SenderOptions); err != nil {
+		delete(n.links, target)
+		return nil, fmt.Errorf("creating sender link: %w", err)
+	}
+
+	n.linkSeq++
+	l := &link{generation: n.linkSeq, lastUsed: time.Now(), expiry: expiry}
+	n.links[target] = l
+
+	return l, nil
+}
+
+// resetLinks forgets the links opened on a session that was replaced, the
+// $cbs link included
+func (n *AMQPNotifier) resetLinks() {
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	n.links = make(map[string]*link)
+	n.cbs = nil
+}
+
+// closeIdle closes the links not used since before the idle timeout
+func (n *AMQPNotifier) closeIdle(ctx context.Context, now time.Time) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	for target, l := range n.links {
+		if now.Sub(l.lastUsed) < n.LinkIdleTimeout {
+			continue
+		}
+
+		if err := n.wrapper.CloseSender(ctx, target); err != nil {
+			n.Logger.Printf("%s: closing idle sender link %s: %v", n.Name(), target, err)
+		}
+
+		delete(n.links, target)
+	}
+}
+
+// watchIdle closes idle links until the notifier is closed
+func (n *AMQPNotifier) watchIdle() {
+	ticker := time.NewTicker(n.LinkIdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case now := <-ticker.C:
+			n.closeIdle(n.ctx, now)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package amqp10
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewTargetFunc(t *testing.T) {
+	var (
+		message = &model.Notification{
+			Event: "orders.created",
+			Data:  map[string]any{"tenant": "acme"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			message    *model.Notification
+			want       string
+			wantErrMsg string
+			wantNewErr string
+		}{
+			{
+				name:    "queue-name",
+				config:  &Config{QueueName: "notifications"},
+				message: message,
+				want:    "notifications",
+			},
+			{
+				name:    "template",
+				config:  &Config{QueueName: "{{.Data.tenant}}.{{.Event}}"},
+				message: message,
+				want:    "acme.orders.created",
+			},
+			{
+				name: "targets",
+				config: &Config{
+					QueueName: "notifications",
+					Targets:   map[model.EventType]string{"orders.created": "orders"},
+				},
+				message: message,
+				want:    "orders",
+			},
+			{
+				name: "targets-fallback",
+				config: &Config{
+					QueueName: "notifications.{{.Event}}",
+					Targets:   map[model.EventType]string{"users.deleted": "users"},
+				},
+				message: message,
+				want:    "notifications.orders.created",
+			},
+			{
+				name: "func-overrides",
+				config: &Config{
+					QueueName: "notifications",
+					Targets:   map[model.EventType]string{"orders.created": "orders"},
+					TargetFunc: func(m *model.Notification) (string, error) {
+						return "/topics/" + string(m.Event), nil
+					},
+				},
+				message: message,
+				want:    "/topics/orders.created",
+			},
+			{
+				name:       "fail-render",
+				config:     &Config{QueueName: "{{.Data.region}}"},
+				message:    message,
+				wantErrMsg: `map has no entry for key "region"`,
+			},
+			{
+				name:       "fail-parse",
+				config:     &Config{QueueName: "{{.Event"},
+				wantNewErr: "parsing target template",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := newTargetFunc(tt.config)
+			if tt.wantNewErr != "" {
+				assert.ErrorContains(t, err, tt.wantNewErr)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got, err := fn(tt.message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.want, got, "target = %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestAMQPNotifier_ConnectTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		before     func(w *MockInternalWrapper)
+		wantSender bool
+		wantErrMsg string
+	}{
+		{
+			name:   "single-target",
+			config: &Config{QueueName: "notifications"},
+			before: func(w *MockInternalWrapper) {
+				w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).Return(nil)
+				w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+				w.On("NewSender", mock.Anything, "notifications", (*amqp.SenderOptions)(nil)).Return(nil)
+			},
+			wantSender: true,
+		},
+		{
+			name: "targets-opened-lazily",
+			config: &Config{
+				QueueName: "notifications",
+				Targets:   map[model.EventType]string{"orders.created": "orders"},
+			},
+			before: func(w *MockInternalWrapper) {
+				w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).Return(nil)
+				w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+			},
+		},
+		{
+			name:       "fail-template",
+			config:     &Config{QueueName: "{{.Event"},
+			wantErrMsg: "parsing target template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := &MockInternalWrapper{}
+
+			tt.config.Address = "amqp://example.com"
+			tt.config.wrapper = w
+			n := New(tt.config)
+
+			if tt.before != nil {
+				tt.before(w)
+			}
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				w.AssertNotCalled(t, "Dial", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			w.AssertExpectations(t)
+			assert.Equal(t, tt.wantSender, len(n.links) == 1)
+
+			if !tt.wantSender {
+				w.AssertNotCalled(t, "NewSender", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAMQPNotifier_DeliverTargets(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			QueueName:       "notifications",
+			Targets:         map[model.EventType]string{"orders.created": "orders"},
+			DeliveryTimeout: 100,
+			ctx:             context.TODO(),
+			wrapper:         w,
+			Logger:          log.New(&bytes.Buffer{}, "test:", log.LstdFlags),
+		})
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	w.On("NewSender", mock.Anything, "orders", (*amqp.SenderOptions)(nil)).Return(nil)
+	w.On("NewSender", mock.Anything, "notifications", (*amqp.SenderOptions)(nil)).Return(nil)
+	w.On("Send", mock.Anything, "orders", mock.Anything, (*amqp.SendOptions)(nil)).Return(nil)
+	w.On("Send", mock.Anything, "notifications", mock.Anything, (*amqp.SendOptions)(nil)).Return(nil)
+
+	// concurrent deliveries share the link of each target
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r := n.Deliver(&model.Notification{Event: "orders.created"})
+			assert.NoError(t, r.Error)
+		}()
+		go func() {
+			defer wg.Done()
+			r := n.Deliver(&model.Notification{Event: "users.deleted"})
+			assert.NoError(t, r.Error)
+		}()
+	}
+	wg.Wait()
+
+	w.AssertNumberOfCalls(t, "NewSender", 2)
+	w.AssertNumberOfCalls(t, "Send", 8)
+}
+
+func TestAMQPNotifier_DeliverTargetError(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			TargetFunc: func(m *model.Notification) (string, error) {
+				return "", fmt.Errorf("test-TargetFunc-error")
+			},
+			DeliveryTimeout: 100,
+			wrapper:         w,
+		})
+	)
+
+	r := n.Deliver(&model.Notification{Event: "orders.created"})
+	assert.ErrorContains(t, r.Error, "rendering target: test-TargetFunc-error")
+	assert.False(t, r.Success)
+	w.AssertNotCalled(t, "NewSender", mock.Anything, mock.Anything, mock.Anything)
+
+	w.On("NewSender", mock.Anything, "orders", (*amqp.SenderOptions)(nil)).Return(fmt.Errorf("test-NewSender-error"))
+	n.TargetFunc = nil
+	n.target = func(*model.Notification) (string, error) { return "orders", nil }
+
+	r = n.Deliver(&model.Notification{Event: "orders.created"})
+	assert.ErrorContains(t, r.Error, "sending message: creating sender link: test-NewSender-error")
+	assert.NotContains(t, n.links, "orders")
+}
+
+func TestAMQPNotifier_closeIdle(t *testing.T) {
+	var (
+		buf = bytes.Buffer{}
+		w   = &MockInternalWrapper{}
+		n   = New(&Config{
+			LinkIdleTimeout: time.Minute,
+			wrapper:         w,
+			Logger:          log.New(&buf, "test:", log.LstdFlags),
+		})
+		now = time.Now()
+	)
+
+	n.links = map[string]*link{
+		"orders": {lastUsed: now.Add(-2 * time.Minute)},
+		"audit":  {lastUsed: now.Add(-time.Minute)},
+		"users":  {lastUsed: now.Add(-time.Second)},
+	}
+
+	w.On("CloseSender", mock.Anything, "orders").Return(nil)
+	w.On("CloseSender", mock.Anything, "audit").Return(fmt.Errorf("test-CloseSender-error"))
+
+	n.closeIdle(context.TODO(), now)
+
+	assert.Equal(t, []string{"users"}, keys(n.links))
+	assert.Contains(t, buf.String(), "closing idle sender link audit: test-CloseSender-error")
+	w.AssertExpectations(t)
+}
+
+func TestAMQPNotifier_watchIdle(t *testing.T) {
+	var (
+		w = &MockInternalWrapper{}
+		n = New(&Config{
+			Address:         "amqp://example.com",
+			QueueName:       "{{.Event}}",
+			LinkIdleTimeout: 20 * time.Millisecond,
+			DeliveryTimeout: 100,
+			wrapper:         w,
+		})
+		closed = make(chan string, 1)
+	)
+
+	n.jsonMarshal = func(v any) ([]byte, error) {
+		return []byte("test"), nil
+	}
+
+	w.On("Dial", mock.Anything, "amqp://example.com", (*amqp.ConnOptions)(nil)).Return(nil)
+	w.On("NewSession", mock.Anything, (*amqp.SessionOptions)(nil)).Return(nil)
+	w.On("NewSender", mock.Anything, "orders", (*amqp.SenderOptions)(nil)).Return(nil)
+	w.On("Send", mock.Anything, "orders", mock.Anything, (*amqp.SendOptions)(nil)).Return(nil)
+	w.On("CloseSender", mock.Anything, "orders").
+		Run(func(args mock.Arguments) {
+			select {
+			case closed <- args.String(1):
+			default:
+			}
+		}).
+		Return(nil)
+	w.On("CloseConn").Return(nil)
+
+	assert.NoError(t, n.Connect())
+	assert.NoError(t, n.Deliver(&model.Notification{Event: "orders"}).Error)
+
+	select {
+	case target := <-closed:
+		assert.Equal(t, "orders", target)
+	case <-time.After(time.Second):
+		t.Fatal("idle link not closed")
+	}
+
+	// opened again when needed
+	assert.NoError(t, n.Deliver(&model.Notification{Event: "orders"}).Error)
+	w.AssertNumberOfCalls(t, "NewSender", 2)
+
+	assert.NoError(t, n.Close())
+	assert.NoError(t, n.Close())
+}
+
+func keys(links map[string]*link) []string {
+	var result []string
+	for k := range links {
+		result = append(result, k)
+	}
+
+	return result
+}
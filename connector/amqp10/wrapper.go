@@ -2,6 +2,8 @@ package amqp10
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	amqp "github.com/Azure/go-amqp"
 )
@@ -10,7 +12,9 @@ type internalWrapperInterface interface {
 	Dial(ctx context.Context, addr string, opts *amqp.ConnOptions) error
 	NewSession(ctx context.Context, opts *amqp.SessionOptions) error
 	NewSender(ctx context.Context, target string, opts *amqp.SenderOptions) error
-	Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error
+	Send(ctx context.Context, target string, msg *amqp.Message, opts *amqp.SendOptions) error
+	CloseSender(ctx context.Context, target string) error
+	NewCBSLink(ctx context.Context, replyTo string) (cbsLink, error)
 	CloseConn() error
 	CloseSession(ctx context.Context) error
 }
@@ -18,7 +22,8 @@ type internalWrapperInterface interface {
 type internalWrapper struct {
 	conn    *amqp.Conn
 	session *amqp.Session
-	sender  *amqp.Sender
+	lock    sync.Mutex
+	senders map[string]*amqp.Sender
 }
 
 func (w *internalWrapper) Dial(ctx context.Context, addr string, opts *amqp.ConnOptions) error {
@@ -27,16 +32,48 @@ func (w *internalWrapper) Dial(ctx context.Context, addr string, opts *amqp.Conn
 	return err
 }
 
+// NewSession creates the session, the links of the previous one are dropped
 func (w *internalWrapper) NewSession(ctx context.Context, opts *amqp.SessionOptions) error {
-	var err error
-	w.session, err = w.conn.NewSession(ctx, opts)
-	return err
+	session, err := w.conn.NewSession(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.session = session
+	w.senders = make(map[string]*amqp.Sender)
+
+	return nil
 }
 
+// NewSender opens a sender link to the target, replacing the previous one
 func (w *internalWrapper) NewSender(ctx context.Context, target string, opts *amqp.SenderOptions) error {
-	var err error
-	w.sender, err = w.session.NewSender(ctx, target, opts)
-	return err
+	sender, err := w.session.NewSender(ctx, target, opts)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.senders[target] = sender
+
+	return nil
+}
+
+func (w *internalWrapper) CloseSender(ctx context.Context, target string) error {
+	w.lock.Lock()
+	sender, ok := w.senders[target]
+	delete(w.senders, target)
+	w.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return sender.Close(ctx)
 }
 
 func (w *internalWrapper) CloseConn() error {
@@ -47,6 +84,25 @@ func (w *internalWrapper) CloseSession(ctx context.Context) error {
 	return w.session.Close(ctx)
 }
 
-func (w *internalWrapper) Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error {
-	return w.sender.Send(ctx, msg, opts)
+func (w *internalWrapper) Send(ctx context.Context, target string, msg *amqp.Message, opts *amqp.SendOptions) error {
+	w.lock.Lock()
+	sender, ok := w.senders[target]
+	w.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no sender link to %s", target)
+	}
+
+	return sender.Send(ctx, msg, opts)
+}
+
+// NewCBSLink attaches a link pair to the $cbs node of the session, responses
+// are received on the replyTo address
+func (w *internalWrapper) NewCBSLink(ctx context.Context, replyTo string) (cbsLink, error) {
+	link, err := newCBSLink(ctx, amqpSession{session: w.session}, replyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
 }
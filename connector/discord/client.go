@@ -0,0 +1,90 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/padiazg/notifier/utils"
+)
+
+// rateLimit is the body of 429 responses
+type rateLimit struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+// post executes the webhook with the payload, waiting as told by Discord when
+// rate limited
+func (n *DiscordNotifier) post(payload []byte, thread string) error {
+	endpoint, err := n.endpoint(thread)
+	if err != nil {
+		return err
+	}
+
+	return utils.RetryRateLimited(n.MaxRetries, n.sleep, func() error {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			// the webhook URL holds the token, keep it out of the error
+			return fmt.Errorf("sending request: %w", utils.UnwrapURLError(err))
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &utils.RateLimitedError{Wait: retryAfter(body, resp.Header.Get("Retry-After"))}
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("discord webhook returned non-OK status: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		return nil
+	})
+}
+
+// endpoint adds the query parameters to the webhook URL
+func (n *DiscordNotifier) endpoint(thread string) (string, error) {
+	u, err := url.Parse(n.WebhookURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing WebhookURL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("wait", "true")
+	if thread != "" {
+		q.Set("thread_id", thread)
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// retryAfter returns how long to wait before retrying, from the retry_after
+// seconds of the body, or else the Retry-After header
+func retryAfter(body []byte, header string) time.Duration {
+	var r rateLimit
+	if err := json.Unmarshal(body, &r); err == nil && r.RetryAfter > 0 {
+		return time.Duration(r.RetryAfter * float64(time.Second))
+	}
+
+	return utils.RetryAfter(header)
+}
@@ -0,0 +1,271 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// MetadataSeverity is the metadata key holding the severity of notifications
+// whose template has no Severity
+const MetadataSeverity = "severity"
+
+// DefaultColors are the embed colors of the usual severities
+var DefaultColors = map[string]int{
+	"debug":    0x95a5a6,
+	"info":     0x3498db,
+	"success":  0x2ecc71,
+	"warning":  0xf1c40f,
+	"error":    0xe74c3c,
+	"critical": 0x992d22,
+}
+
+// Mention types parsed from the content of messages
+const (
+	MentionRoles    = "roles"
+	MentionUsers    = "users"
+	MentionEveryone = "everyone"
+)
+
+// AllowedMentions are the mentions in the content of messages that notify
+// their targets
+type AllowedMentions struct {
+	// Parse lists the mention types notified, any of MentionRoles,
+	// MentionUsers and MentionEveryone
+	Parse []string `json:"parse"`
+	// Users are the IDs of the users notified, not allowed with MentionUsers
+	Users []string `json:"users,omitempty"`
+	// Roles are the IDs of the roles notified, not allowed with MentionRoles
+	Roles []string `json:"roles,omitempty"`
+}
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// WebhookURL is the Discord webhook, https://discord.com/api/webhooks/{id}/{token}
+	WebhookURL string
+	// Username overrides the name of the webhook
+	Username string
+	// AvatarURL overrides the avatar of the webhook
+	AvatarURL string
+	// Threads maps event types to the thread their messages are posted to
+	Threads map[model.EventType]string
+	// ThreadID is the thread of events not in Threads, messages are posted to
+	// the channel of the webhook if not set
+	ThreadID string
+	// Templates maps event types to the template of their messages
+	Templates map[model.EventType]*Template
+	// Default is the template of events not in Templates, if not set the
+	// message is an embed holding the notification data as JSON
+	Default *Template
+	// AllowedMentions are the mentions that notify, none if not set so
+	// rendered data can't ping @everyone
+	AllowedMentions *AllowedMentions
+	// Colors maps severities to embed colors, DefaultColors if not set
+	Colors map[string]int
+	// MaxRetries is how many times a rate limited message is retried, 3 if
+	// not set, negative to never retry
+	MaxRetries int
+	// Timeout limits each request, 10 seconds if not set
+	Timeout time.Duration
+}
+
+type DiscordNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	client      *http.Client
+	templates   map[model.EventType]*template
+	fallback    *template
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+	sleep       func(d time.Duration)
+}
+
+var _ model.Notifier = (*DiscordNotifier)(nil)
+
+func New(config *Config) *DiscordNotifier {
+	return (&DiscordNotifier{}).New(config)
+}
+
+func (n *DiscordNotifier) New(config *Config) *DiscordNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.Colors == nil {
+		config.Colors = DefaultColors
+	}
+
+	if config.AllowedMentions == nil {
+		config.AllowedMentions = &AllowedMentions{}
+	}
+
+	if config.AllowedMentions.Parse == nil {
+		// Discord parses every mention when parse is missing
+		config.AllowedMentions.Parse = []string{}
+	}
+
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.client = &http.Client{Timeout: config.Timeout}
+	n.jsonMarshal = json.Marshal
+	n.sleep = time.Sleep
+	n.configErr = n.parseConfig()
+
+	return n
+}
+
+// parseConfig checks the webhook URL and parses the templates
+func (n *DiscordNotifier) parseConfig() error {
+	var err error
+
+	if n.WebhookURL == "" {
+		return fmt.Errorf("WebhookURL must be set")
+	}
+
+	if u, err := url.Parse(n.WebhookURL); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid WebhookURL")
+	}
+
+	if err = n.AllowedMentions.validate(); err != nil {
+		return err
+	}
+
+	n.templates = make(map[model.EventType]*template, len(n.Templates))
+	for event, t := range n.Templates {
+		if n.templates[event], err = t.parse(string(event)); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if n.fallback, err = n.Default.parse("default"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks the mention types, and that they aren't given with IDs of
+// the same type as Discord rejects it
+func (m *AllowedMentions) validate() error {
+	for _, parse := range m.Parse {
+		switch {
+		case parse == MentionRoles && len(m.Roles) > 0:
+			return fmt.Errorf("AllowedMentions parses %s and lists Roles", parse)
+		case parse == MentionUsers && len(m.Users) > 0:
+			return fmt.Errorf("AllowedMentions parses %s and lists Users", parse)
+		case parse != MentionRoles && parse != MentionUsers && parse != MentionEveryone:
+			return fmt.Errorf("unsupported mention type %q", parse)
+		}
+	}
+
+	return nil
+}
+
+func (n *DiscordNotifier) Type() string {
+	return "discord"
+}
+
+func (n *DiscordNotifier) Name() string {
+	return n.Config.Name
+}
+
+func (n *DiscordNotifier) Connect() error {
+	return n.configErr
+}
+
+func (n *DiscordNotifier) Close() error {
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *DiscordNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *DiscordNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *DiscordNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver posts a notification to the Discord webhook
+func (n *DiscordNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	msg, err := n.render(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	msg.Username = n.Username
+	msg.AvatarURL = n.AvatarURL
+	msg.AllowedMentions = n.AllowedMentions
+
+	payload, err := n.jsonMarshal(msg)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	if err := n.post(payload, n.thread(message.Event)); err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	// with wait=true Discord answers once the message is created
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+// thread returns the thread of the event
+func (n *DiscordNotifier) thread(event model.EventType) string {
+	if thread, ok := n.Threads[event]; ok {
+		return thread
+	}
+
+	return n.ThreadID
+}
@@ -0,0 +1,246 @@
+package discord
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeDiscord answers like a webhook executed with wait=true once the
+// queued responses are used
+func newFakeDiscord(t *testing.T, responses ...func(w http.ResponseWriter)) *utils.TestServer {
+	t.Helper()
+
+	return utils.NewTestServer(t, func(w http.ResponseWriter, count int) {
+		fmt.Fprintf(w, `{"id": "%d", "type": 0}`, count)
+	}, responses...)
+}
+
+func TestDiscordNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "success",
+			config: &Config{WebhookURL: "https://discord.com/api/webhooks/1/test"},
+		},
+		{
+			name:       "fail-webhook",
+			config:     &Config{},
+			wantErrMsg: "WebhookURL must be set",
+		},
+		{
+			name:       "fail-webhook-invalid",
+			config:     &Config{WebhookURL: "discord"},
+			wantErrMsg: "invalid WebhookURL",
+		},
+		{
+			name: "fail-template",
+			config: &Config{
+				WebhookURL: "https://discord.com/api/webhooks/1/test",
+				Templates:  map[model.EventType]*Template{"test": {Title: "{{.Event"}},
+			},
+			wantErrMsg: "parsing test title template",
+		},
+		{
+			name: "fail-field",
+			config: &Config{
+				WebhookURL: "https://discord.com/api/webhooks/1/test",
+				Default:    &Template{Fields: []Field{{Name: "id", Value: "{{.ID"}}},
+			},
+			wantErrMsg: "parsing default field template",
+		},
+		{
+			name: "fail-mention-type",
+			config: &Config{
+				WebhookURL:      "https://discord.com/api/webhooks/1/test",
+				AllowedMentions: &AllowedMentions{Parse: []string{"here"}},
+			},
+			wantErrMsg: `unsupported mention type "here"`,
+		},
+		{
+			name: "fail-mention-users",
+			config: &Config{
+				WebhookURL:      "https://discord.com/api/webhooks/1/test",
+				AllowedMentions: &AllowedMentions{Parse: []string{MentionUsers}, Users: []string{"1"}},
+			},
+			wantErrMsg: "AllowedMentions parses users and lists Users",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^discord[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "discord", n.Type())
+			assert.Equal(t, DefaultColors, n.Colors)
+			assert.Equal(t, 3, n.MaxRetries)
+			assert.NotNil(t, n.AllowedMentions.Parse)
+			assert.NotNil(t, n.GetChannel())
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestDiscordNotifier_Deliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *Config
+		responses    []func(w http.ResponseWriter)
+		message      *model.Notification
+		wantThread   string
+		wantMentions any
+		wantSleeps   []time.Duration
+		wantErrMsg   string
+	}{
+		{
+			name:         "overrides",
+			config:       &Config{Username: "Releases", AvatarURL: "https://example.com/avatar.png"},
+			message:      &model.Notification{Event: "release.published"},
+			wantMentions: map[string]any{"parse": []any{}},
+		},
+		{
+			name:         "mentions",
+			config:       &Config{AllowedMentions: &AllowedMentions{Parse: []string{MentionUsers}, Roles: []string{"300"}}},
+			message:      &model.Notification{Event: "release.published"},
+			wantMentions: map[string]any{"parse": []any{"users"}, "roles": []any{"300"}},
+		},
+		{
+			name:       "thread-routed",
+			config:     &Config{ThreadID: "100", Threads: map[model.EventType]string{"incident.opened": "200"}},
+			message:    &model.Notification{Event: "incident.opened"},
+			wantThread: "200",
+		},
+		{
+			name:       "thread-default",
+			config:     &Config{ThreadID: "100", Threads: map[model.EventType]string{"incident.opened": "200"}},
+			message:    &model.Notification{Event: "release.published"},
+			wantThread: "100",
+		},
+		{
+			name:   "rate-limited",
+			config: &Config{},
+			responses: []func(w http.ResponseWriter){
+				utils.TestRateLimited("1", `{"message": "You are being rate limited.", "retry_after": 0.25, "global": false}`),
+				utils.TestRateLimited("2", ""),
+				utils.TestRateLimited("", ""),
+			},
+			message:    &model.Notification{Event: "release.published"},
+			wantSleeps: []time.Duration{250 * time.Millisecond, 2 * time.Second, time.Second},
+		},
+		{
+			name:       "fail-rate-limited",
+			config:     &Config{MaxRetries: 1},
+			responses:  []func(w http.ResponseWriter){utils.TestRateLimited("", `{"retry_after": 1}`), utils.TestRateLimited("", `{"retry_after": 1}`)},
+			message:    &model.Notification{Event: "release.published"},
+			wantSleeps: []time.Duration{time.Second},
+			wantErrMsg: "rate limited, gave up after 1 retries",
+		},
+		{
+			name:       "fail-no-retries",
+			config:     &Config{MaxRetries: -1},
+			responses:  []func(w http.ResponseWriter){utils.TestRateLimited("", `{"retry_after": 1}`)},
+			message:    &model.Notification{Event: "release.published"},
+			wantErrMsg: "rate limited, gave up after 0 retries",
+		},
+		{
+			name:   "fail-status",
+			config: &Config{},
+			responses: []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"message": "Cannot send an empty message", "code": 50006}`)
+			}},
+			message:    &model.Notification{Event: "release.published"},
+			wantErrMsg: `discord webhook returned non-OK status: 400 {"message": "Cannot send an empty message", "code": 50006}`,
+		},
+		{
+			name:       "fail-template",
+			config:     &Config{Default: &Template{Title: "{{.Data.version}}"}},
+			message:    &model.Notification{Event: "release.published", Data: map[string]any{}},
+			wantErrMsg: "rendering title",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				server = newFakeDiscord(t, tt.responses...)
+				sleeps []time.Duration
+			)
+
+			tt.config.WebhookURL = server.URL + "/api/webhooks/1/test"
+
+			n := New(tt.config)
+			n.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			r := n.Deliver(tt.message)
+			assert.Equal(t, tt.wantSleeps, sleeps)
+
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.True(t, r.Acknowledged)
+
+			var (
+				requests = server.Requests()
+				request  = requests[len(requests)-1]
+				body     map[string]any
+			)
+
+			assert.NoError(t, server.DecodeBody(-1, &body))
+
+			assert.Equal(t, "/api/webhooks/1/test", request.URL.Path)
+			assert.Equal(t, "true", request.URL.Query().Get("wait"))
+			assert.Equal(t, tt.wantThread, request.URL.Query().Get("thread_id"))
+
+			if tt.wantMentions != nil {
+				assert.Equal(t, tt.wantMentions, body["allowed_mentions"])
+			}
+
+			if tt.config.Username != "" {
+				assert.Equal(t, tt.config.Username, body["username"])
+				assert.Equal(t, tt.config.AvatarURL, body["avatar_url"])
+			} else {
+				assert.NotContains(t, body, "username")
+				assert.NotContains(t, body, "avatar_url")
+			}
+		})
+	}
+}
+
+func TestDiscordNotifier_DeliverUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	n := New(&Config{WebhookURL: server.URL + "/api/webhooks/1/secret"})
+
+	r := n.Deliver(&model.Notification{Event: "release.published"})
+	assert.ErrorContains(t, r.Error, "sending request:")
+	assert.NotContains(t, r.Error.Error(), "secret", "webhook URL leaked in the error")
+}
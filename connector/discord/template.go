@@ -0,0 +1,202 @@
+package discord
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Template holds the templates rendered against a notification to build its
+// message, the embed is left out when Title, Description and Fields are empty
+type Template struct {
+	// Content is the text of the message, outside the embed
+	Content     string
+	Title       string
+	Description string
+	// URL is the link of the title
+	URL    string
+	Fields []Field
+	// Severity selects the color of the embed from Colors, if not set the
+	// severity is taken from the "severity" metadata of the notification
+	Severity string
+}
+
+// Field is a name and value pair of the embed, both can be templates
+type Field struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// template is a parsed Template
+type template struct {
+	content     *utils.Template
+	title       *utils.Template
+	description *utils.Template
+	url         *utils.Template
+	fields      []field
+	severity    *utils.Template
+	embed       bool
+}
+
+type field struct {
+	name   *utils.Template
+	value  *utils.Template
+	inline bool
+}
+
+// message is the payload of webhooks
+type message struct {
+	Content   string  `json:"content,omitempty"`
+	Username  string  `json:"username,omitempty"`
+	AvatarURL string  `json:"avatar_url,omitempty"`
+	Embeds    []embed `json:"embeds,omitempty"`
+
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+type embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+	Fields      []embedField `json:"fields,omitempty"`
+}
+
+type embedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+func (t *Template) parse(name string) (*template, error) {
+	var (
+		result = &template{embed: t.Title != "" || t.Description != "" || len(t.Fields) > 0}
+		err    error
+	)
+
+	for _, s := range []struct {
+		field string
+		text  string
+		dest  **utils.Template
+	}{
+		{"content", t.Content, &result.content},
+		{"title", t.Title, &result.title},
+		{"description", t.Description, &result.description},
+		{"url", t.URL, &result.url},
+		{"severity", t.Severity, &result.severity},
+	} {
+		if *s.dest, err = utils.ParseTemplate(name+"."+s.field, s.text); err != nil {
+			return nil, fmt.Errorf("parsing %s %s template: %w", name, s.field, err)
+		}
+	}
+
+	for i, f := range t.Fields {
+		var parsed = field{inline: f.Inline}
+
+		if parsed.name, err = utils.ParseTemplate(fmt.Sprintf("%s.fields[%d].name", name, i), f.Name); err != nil {
+			return nil, fmt.Errorf("parsing %s field template: %w", name, err)
+		}
+
+		if parsed.value, err = utils.ParseTemplate(fmt.Sprintf("%s.fields[%d].value", name, i), f.Value); err != nil {
+			return nil, fmt.Errorf("parsing %s field template: %w", name, err)
+		}
+
+		result.fields = append(result.fields, parsed)
+	}
+
+	return result, nil
+}
+
+func (t *template) render(notification *model.Notification) (*message, string, error) {
+	var (
+		result   = &message{}
+		e        embed
+		severity string
+		err      error
+	)
+
+	for _, s := range []struct {
+		field string
+		tmpl  *utils.Template
+		dest  *string
+	}{
+		{"content", t.content, &result.Content},
+		{"title", t.title, &e.Title},
+		{"description", t.description, &e.Description},
+		{"url", t.url, &e.URL},
+		{"severity", t.severity, &severity},
+	} {
+		if *s.dest, err = s.tmpl.Render(notification); err != nil {
+			return nil, "", fmt.Errorf("rendering %s: %w", s.field, err)
+		}
+	}
+
+	for _, f := range t.fields {
+		var rendered = embedField{Inline: f.inline}
+
+		if rendered.Name, err = f.name.Render(notification); err != nil {
+			return nil, "", fmt.Errorf("rendering field: %w", err)
+		}
+
+		if rendered.Value, err = f.value.Render(notification); err != nil {
+			return nil, "", fmt.Errorf("rendering field: %w", err)
+		}
+
+		e.Fields = append(e.Fields, rendered)
+	}
+
+	if t.embed {
+		result.Embeds = []embed{e}
+	}
+
+	return result, severity, nil
+}
+
+// render builds the message of the notification with the template of its
+// event, the data is sent as a JSON code block in an embed if there is none.
+// Embeds are colored by severity and timestamped
+func (n *DiscordNotifier) render(notification *model.Notification) (*message, error) {
+	var (
+		msg      *message
+		severity string
+		err      error
+	)
+
+	t, ok := n.templates[notification.Event]
+	if !ok {
+		t = n.fallback
+	}
+
+	if t != nil {
+		if msg, severity, err = t.render(notification); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := n.jsonMarshal(notification.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		msg = &message{Embeds: []embed{{
+			Title:       string(notification.Event),
+			Description: fmt.Sprintf("```json\n%s\n```", data),
+		}}}
+	}
+
+	if severity == "" {
+		severity = notification.Metadata[MetadataSeverity]
+	}
+
+	for i := range msg.Embeds {
+		msg.Embeds[i].Color = n.Colors[severity]
+		if !notification.Timestamp.IsZero() {
+			msg.Embeds[i].Timestamp = notification.Timestamp.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return msg, nil
+}
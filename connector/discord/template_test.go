@@ -0,0 +1,131 @@
+package discord
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscordNotifier_render(t *testing.T) {
+	var (
+		notification = &model.Notification{
+			ID:        "abc",
+			Event:     "incident.opened",
+			Data:      map[string]any{"summary": "API down", "service": "api", "level": "critical"},
+			Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Metadata:  map[string]string{"severity": "warning"},
+		}
+
+		tests = []struct {
+			name       string
+			templates  map[model.EventType]*Template
+			fallback   *Template
+			colors     map[string]int
+			marshal    func(v any) ([]byte, error)
+			want       *message
+			wantErrMsg string
+		}{
+			{
+				name: "embed",
+				templates: map[model.EventType]*Template{
+					"incident.opened": {
+						Content:     "Incident {{.ID}}",
+						Title:       "{{.Data.summary}}",
+						Description: "Service {{.Data.service}} is down",
+						URL:         "https://status.example.com/{{.ID}}",
+						Fields: []Field{
+							{Name: "Service", Value: "{{.Data.service}}", Inline: true},
+							{Name: "ID", Value: "{{.ID}}"},
+						},
+						Severity: "{{.Data.level}}",
+					},
+				},
+				want: &message{
+					Content: "Incident abc",
+					Embeds: []embed{{
+						Title:       "API down",
+						Description: "Service api is down",
+						URL:         "https://status.example.com/abc",
+						Color:       DefaultColors["critical"],
+						Timestamp:   "2024-01-02T03:04:05Z",
+						Fields: []embedField{
+							{Name: "Service", Value: "api", Inline: true},
+							{Name: "ID", Value: "abc"},
+						},
+					}},
+				},
+			},
+			{
+				name:     "content-only",
+				fallback: &Template{Content: "{{.Event}}: {{.Data.summary}}"},
+				want:     &message{Content: "incident.opened: API down"},
+			},
+			{
+				name:     "metadata-severity",
+				fallback: &Template{Title: "{{.Data.summary}}"},
+				colors:   map[string]int{"warning": 0xffaa00},
+				want: &message{Embeds: []embed{{
+					Title:     "API down",
+					Color:     0xffaa00,
+					Timestamp: "2024-01-02T03:04:05Z",
+				}}},
+			},
+			{
+				name:    "json",
+				marshal: func(v any) ([]byte, error) { return []byte("test-json"), nil },
+				want: &message{Embeds: []embed{{
+					Title:       "incident.opened",
+					Description: "```json\ntest-json\n```",
+					Color:       DefaultColors["warning"],
+					Timestamp:   "2024-01-02T03:04:05Z",
+				}}},
+			},
+			{
+				name:       "fail-json",
+				marshal:    func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+				wantErrMsg: "test-Marshal-error",
+			},
+			{
+				name:       "fail-severity",
+				fallback:   &Template{Title: "test", Severity: "{{.Data.region}}"},
+				wantErrMsg: "rendering severity",
+			},
+			{
+				name:       "fail-field",
+				fallback:   &Template{Fields: []Field{{Name: "Region", Value: "{{.Data.region}}"}}},
+				wantErrMsg: "rendering field",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(&Config{
+				WebhookURL: "https://discord.com/api/webhooks/1/test",
+				Templates:  tt.templates,
+				Default:    tt.fallback,
+				Colors:     tt.colors,
+			})
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			got, err := n.render(notification)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// testCluster is an in-process Kafka cluster speaking enough of the protocol
+// for producers: API versions, metadata, producer IDs and produce requests.
+// Its brokers can be told to refuse requests or to lose the responses to
+// produce requests they applied
+type testCluster struct {
+	listeners []net.Listener
+
+	lock       sync.Mutex
+	topics     map[string][]*testPartition
+	faults     []*testFault
+	producerID int64
+	conns      map[net.Conn]bool
+	// drops is how many produce responses are still to be lost, dropped how
+	// many were
+	drops   int
+	dropped atomic.Int32
+}
+
+// testPartition is the log of a partition, with the next sequence number
+// expected from each idempotent producer
+type testPartition struct {
+	leader    int32
+	epoch     int32
+	records   []testRecord
+	sequences map[int64]int32
+}
+
+// testRecord is a record written to the test cluster
+type testRecord struct {
+	Partition   int32
+	Key         []byte
+	Value       []byte
+	Headers     map[string]string
+	ProducerID  int64
+	Compression uint8
+}
+
+// testFault refuses the produce requests to a topic with err, or only counts
+// them without err. It applies to count requests, all of them if 0, and only
+// to those when accepts if set
+type testFault struct {
+	topic   string
+	err     *kerr.Error
+	count   int
+	when    func(req *kmsg.ProduceRequest) bool
+	cluster *testCluster
+	hits    int
+	removed bool
+}
+
+// newTestCluster starts brokers brokers with the topics, given as name and
+// number of partitions. The leaders of the partitions alternate between the
+// brokers
+func newTestCluster(t *testing.T, brokers int, topics map[string]int32) *testCluster {
+	t.Helper()
+
+	c := &testCluster{topics: make(map[string][]*testPartition), conns: make(map[net.Conn]bool)}
+	for name, partitions := range topics {
+		for i := int32(0); i < partitions; i++ {
+			c.topics[name] = append(c.topics[name], &testPartition{
+				leader:    i % int32(brokers),
+				sequences: make(map[int64]int32),
+			})
+		}
+	}
+
+	for i := 0; i < brokers; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.listeners = append(c.listeners, l)
+		go c.serve(int32(i), l)
+	}
+
+	t.Cleanup(c.close)
+
+	return c
+}
+
+// Addr returns the address of the first broker, to bootstrap from
+func (c *testCluster) Addr() string {
+	return c.listeners[0].Addr().String()
+}
+
+func (c *testCluster) close() {
+	for _, l := range c.listeners {
+		l.Close()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for conn := range c.conns {
+		conn.Close()
+	}
+}
+
+// fault adds f to the faults applied to produce requests
+func (c *testCluster) fault(f *testFault) *testFault {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	f.cluster = c
+	c.faults = append(c.faults, f)
+
+	return f
+}
+
+// observe counts the produce requests the brokers receive
+func (c *testCluster) observe() *testFault {
+	return c.fault(&testFault{})
+}
+
+func (f *testFault) Hits() int {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+
+	return f.hits
+}
+
+func (f *testFault) Remove() {
+	f.cluster.lock.Lock()
+	defer f.cluster.lock.Unlock()
+
+	f.removed = true
+}
+
+// dropResponses closes the connection instead of answering the next n produce
+// requests, after the brokers applied them
+func (c *testCluster) dropResponses(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.drops = n
+}
+
+// LeaderFor returns the broker leading a partition
+func (c *testCluster) LeaderFor(topic string, partition int32) int32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.topics[topic][partition].leader
+}
+
+// MoveTopicPartition makes broker the leader of a partition, the previous
+// leader refuses the requests to it from then on
+func (c *testCluster) MoveTopicPartition(topic string, partition, broker int32) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	partitions := c.topics[topic]
+	if int(partition) >= len(partitions) || int(broker) >= len(c.listeners) {
+		return errors.New("unknown partition or broker")
+	}
+
+	partitions[partition].leader = broker
+	partitions[partition].epoch++
+
+	return nil
+}
+
+// records returns the records of a topic, waiting until there are want of
+// them
+func (c *testCluster) records(t *testing.T, topic string, want int) []testRecord {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.lock.Lock()
+		var result []testRecord
+		for _, p := range c.topics[topic] {
+			result = append(result, p.records...)
+		}
+		c.lock.Unlock()
+
+		if len(result) >= want || time.Now().After(deadline) {
+			return result
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serve accepts the connections to broker node
+func (c *testCluster) serve(node int32, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c.lock.Lock()
+		c.conns[conn] = true
+		c.lock.Unlock()
+
+		go c.handle(node, conn)
+	}
+}
+
+// handle answers the requests read from conn, they're a size followed by the
+// key, version, correlation ID and client ID then the body
+func (c *testCluster) handle(node int32, conn net.Conn) {
+	defer func() {
+		conn.Close()
+
+		c.lock.Lock()
+		delete(c.conns, conn)
+		c.lock.Unlock()
+	}()
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+
+		body := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, body); err != nil || len(body) < 10 {
+			return
+		}
+
+		var (
+			key       = int16(binary.BigEndian.Uint16(body))
+			version   = int16(binary.BigEndian.Uint16(body[2:]))
+			id        = body[4:8]
+			clientLen = int(int16(binary.BigEndian.Uint16(body[8:])))
+			rest      = body[10:]
+		)
+
+		if clientLen > 0 {
+			rest = rest[clientLen:]
+		}
+
+		req := kmsg.RequestForKey(key)
+		if req == nil {
+			return
+		}
+		req.SetVersion(version)
+
+		if req.IsFlexible() {
+			rest = skipTags(rest)
+		}
+
+		if err := req.ReadFrom(rest); err != nil {
+			return
+		}
+
+		resp, drop := c.answer(node, req)
+		if drop {
+			return
+		}
+
+		if resp == nil {
+			continue
+		}
+
+		// the header of ApiVersions responses is never flexible
+		out := append(make([]byte, 4), id...)
+		if resp.IsFlexible() && key != kmsg.ApiVersions.Int16() {
+			out = append(out, 0)
+		}
+
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// answer handles a request, the response is nil when none is expected and
+// drop tells to close the connection instead of answering
+func (c *testCluster) answer(node int32, req kmsg.Request) (kmsg.Response, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	resp := req.ResponseKind()
+	resp.SetVersion(req.GetVersion())
+
+	switch req := req.(type) {
+	case *kmsg.ApiVersionsRequest:
+		resp := resp.(*kmsg.ApiVersionsResponse)
+		for _, key := range []kmsg.Key{kmsg.Produce, kmsg.Metadata, kmsg.ApiVersions, kmsg.InitProducerID} {
+			k := kmsg.NewApiVersionsResponseApiKey()
+			k.ApiKey = key.Int16()
+			k.MaxVersion = kmsg.RequestForKey(key.Int16()).MaxVersion()
+			resp.ApiKeys = append(resp.ApiKeys, k)
+		}
+
+	case *kmsg.MetadataRequest:
+		c.metadata(req, resp.(*kmsg.MetadataResponse))
+
+	case *kmsg.InitProducerIDRequest:
+		resp := resp.(*kmsg.InitProducerIDResponse)
+		resp.ProducerID = c.producerID
+		c.producerID++
+
+	case *kmsg.ProduceRequest:
+		c.produce(node, req, resp.(*kmsg.ProduceResponse))
+
+		if c.drops > 0 {
+			c.drops--
+			c.dropped.Add(1)
+			return nil, true
+		}
+
+		if req.Acks == 0 {
+			return nil, false
+		}
+
+	default:
+		return nil, true
+	}
+
+	return resp, false
+}
+
+func (c *testCluster) metadata(req *kmsg.MetadataRequest, resp *kmsg.MetadataResponse) {
+	for i, l := range c.listeners {
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		p, _ := strconv.Atoi(port)
+
+		b := kmsg.NewMetadataResponseBroker()
+		b.NodeID = int32(i)
+		b.Host = host
+		b.Port = int32(p)
+		resp.Brokers = append(resp.Brokers, b)
+	}
+
+	var names []string
+	if req.Topics == nil {
+		for name := range c.topics {
+			names = append(names, name)
+		}
+	}
+
+	for _, t := range req.Topics {
+		if t.Topic != nil {
+			names = append(names, *t.Topic)
+		}
+	}
+
+	replicas := make([]int32, len(c.listeners))
+	for i := range replicas {
+		replicas[i] = int32(i)
+	}
+
+	for _, name := range names {
+		name := name
+
+		t := kmsg.NewMetadataResponseTopic()
+		t.Topic = &name
+
+		partitions, ok := c.topics[name]
+		if !ok {
+			t.ErrorCode = kerr.UnknownTopicOrPartition.Code
+		}
+
+		for i, p := range partitions {
+			mp := kmsg.NewMetadataResponseTopicPartition()
+			mp.Partition = int32(i)
+			mp.Leader = p.leader
+			mp.LeaderEpoch = p.epoch
+			mp.Replicas = replicas
+			mp.ISR = replicas
+			t.Partitions = append(t.Partitions, mp)
+		}
+
+		resp.Topics = append(resp.Topics, t)
+	}
+}
+
+func (c *testCluster) produce(node int32, req *kmsg.ProduceRequest, resp *kmsg.ProduceResponse) {
+	// the faults apply to the whole request, they're counted once
+	refused := map[string]*kerr.Error{}
+	for _, f := range c.faults {
+		if f.removed || (f.when != nil && !f.when(req)) {
+			continue
+		}
+
+		for _, t := range req.Topics {
+			if f.topic != "" && f.topic != t.Topic {
+				continue
+			}
+
+			if f.err != nil && refused[t.Topic] == nil {
+				refused[t.Topic] = f.err
+			}
+
+			f.hits++
+			if f.count > 0 && f.hits >= f.count {
+				f.removed = true
+			}
+
+			break
+		}
+	}
+
+	for _, t := range req.Topics {
+		rt := kmsg.NewProduceResponseTopic()
+		rt.Topic = t.Topic
+
+		for _, p := range t.Partitions {
+			rp := kmsg.NewProduceResponseTopicPartition()
+			rp.Partition = p.Partition
+
+			partitions := c.topics[t.Topic]
+			switch {
+			case int(p.Partition) >= len(partitions):
+				rp.ErrorCode = kerr.UnknownTopicOrPartition.Code
+			case partitions[p.Partition].leader != node:
+				rp.ErrorCode = kerr.NotLeaderForPartition.Code
+			case refused[t.Topic] != nil:
+				rp.ErrorCode = refused[t.Topic].Code
+			default:
+				rp.BaseOffset, rp.ErrorCode = partitions[p.Partition].append(p.Partition, p.Records)
+			}
+
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+
+		resp.Topics = append(resp.Topics, rt)
+	}
+}
+
+// append writes the record batch to the log, batches of idempotent producers
+// already written are acknowledged again without writing them twice
+func (p *testPartition) append(partition int32, raw []byte) (int64, int16) {
+	var batch kmsg.RecordBatch
+	if err := batch.ReadFrom(raw); err != nil {
+		return 0, kerr.CorruptMessage.Code
+	}
+
+	offset := int64(len(p.records))
+
+	if batch.ProducerID >= 0 {
+		next := p.sequences[batch.ProducerID]
+
+		switch {
+		case batch.FirstSequence < next:
+			return offset - int64(batch.NumRecords), 0
+		case batch.FirstSequence > next:
+			return 0, kerr.OutOfOrderSequenceNumber.Code
+		}
+
+		p.sequences[batch.ProducerID] = next + batch.NumRecords
+	}
+
+	compression := uint8(batch.Attributes & 0x07)
+
+	records, err := decompress(compression, batch.Records)
+	if err != nil {
+		return 0, kerr.CorruptMessage.Code
+	}
+
+	// each record is preceded by its length as a varint
+	for len(records) > 0 {
+		length, n := binary.Varint(records)
+		if n <= 0 || int(length)+n > len(records) {
+			return 0, kerr.CorruptMessage.Code
+		}
+
+		var r kmsg.Record
+		if err := r.ReadFrom(records[:n+int(length)]); err != nil {
+			return 0, kerr.CorruptMessage.Code
+		}
+		records = records[n+int(length):]
+
+		headers := map[string]string{}
+		for _, h := range r.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+
+		p.records = append(p.records, testRecord{
+			Partition:   partition,
+			Key:         r.Key,
+			Value:       r.Value,
+			Headers:     headers,
+			ProducerID:  batch.ProducerID,
+			Compression: compression,
+		})
+	}
+
+	return offset, 0
+}
+
+// decompress inflates the records of a batch compressed with codec
+func decompress(codec uint8, records []byte) ([]byte, error) {
+	switch codec {
+	case 0:
+		return records, nil
+	case 1:
+		r, err := gzip.NewReader(bytes.NewReader(records))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	case 2:
+		return s2.Decode(nil, records)
+	case 3:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(records)))
+	case 4:
+		r, err := zstd.NewReader(bytes.NewReader(records))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return io.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("unknown codec %d", codec)
+}
+
+// skipTags skips the tagged fields of flexible request headers
+func skipTags(b []byte) []byte {
+	count, n := binary.Uvarint(b)
+	b = b[n:]
+
+	for i := uint64(0); i < count; i++ {
+		_, n := binary.Uvarint(b)
+		b = b[n:]
+
+		size, n := binary.Uvarint(b)
+		b = b[n+int(size):]
+	}
+
+	return b
+}
@@ -0,0 +1,544 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Acknowledgements required from the brokers to consider a record written
+const (
+	// AcksAll waits for every in-sync replica
+	AcksAll = "all"
+	// AcksLeader waits for the leader only
+	AcksLeader = "1"
+	// AcksNone doesn't wait, deliveries can't be acknowledged
+	AcksNone = "0"
+)
+
+// Codecs compressing the record batches
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLZ4    = "lz4"
+	CompressionZstd   = "zstd"
+)
+
+// Compression configures the codec of record batches, brokers keep batches
+// as produced so consumers must support it
+type Compression struct {
+	// Codec is one of the Compression constants, CompressionNone if empty
+	Codec string
+	// Level is the zstd encoder level, from zstd.SpeedFastest to
+	// zstd.SpeedBestCompression, the default if nil. Use
+	// utils.CompressionLevel to set it, other codecs only take their default
+	Level *int
+}
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// Brokers are the bootstrap addresses, host:port, the rest of the cluster
+	// is discovered from them
+	Brokers []string
+	// Topic is where notifications are produced, it can be a template like
+	// "notifications.{{.Event}}"
+	Topic string
+	// Key is the record key, it can be a template like "{{.CorrelationID}}".
+	// Records with the same key land in the same partition, those without one
+	// are spread round robin
+	Key string
+	// KeyFunc derives the key of each notification, overrides Key
+	KeyFunc KeyFunc
+	// Acks is the acknowledgement required, AcksAll if not set
+	Acks string
+	// Idempotent makes retries write each batch exactly once, it requires
+	// AcksAll. After a batch fails the client is replaced to get a new
+	// producer ID, so the next batches aren't taken for retries of it
+	Idempotent bool
+	// Compression compresses batches, they aren't compressed if not set
+	Compression *Compression
+	// BatchSize is the maximum size of batches in bytes, records that don't
+	// fit alone fail, 1048576 if not set
+	BatchSize int
+	// Linger is how long a batch waits for more records, records queued while
+	// the previous batch of the partition is in flight are batched regardless
+	Linger time.Duration
+	// MaxRetries is how many times a batch is retried on retriable errors, 3
+	// if not set, negative to never retry. Idempotent producers keep retrying
+	// batches whose response was lost, to learn whether they were written
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled on each one,
+	// 100 milliseconds if not set
+	RetryBackoff time.Duration
+	// Timeout limits connections and requests, 30 seconds if not set
+	Timeout time.Duration
+	// ClientID identifies the producer in the broker logs, Name if not set
+	ClientID string
+	// TLS configures encrypted connections to the brokers
+	TLS *utils.TLSOptions
+}
+
+type KafkaNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	options     []kgo.Opt
+	producer    *producer
+	topic       KeyFunc
+	key         KeyFunc
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+	lock        sync.RWMutex
+	closed      bool
+	background  sync.WaitGroup
+}
+
+var _ model.Notifier = (*KafkaNotifier)(nil)
+
+func New(config *Config) *KafkaNotifier {
+	return (&KafkaNotifier{}).New(config)
+}
+
+func (n *KafkaNotifier) New(config *Config) *KafkaNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.Acks == "" {
+		config.Acks = AcksAll
+	}
+
+	if config.BatchSize == 0 {
+		config.BatchSize = 1 << 20
+	}
+
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = 100 * time.Millisecond
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	if config.ClientID == "" {
+		config.ClientID = config.Name
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.Marshal
+	n.configErr = n.parseConfig()
+
+	return n
+}
+
+// parseConfig checks the options, parses the templates and sets up the
+// client, it doesn't connect until the first request
+func (n *KafkaNotifier) parseConfig() error {
+	var err error
+
+	if len(n.Brokers) == 0 {
+		return fmt.Errorf("Brokers must be set")
+	}
+
+	if n.Topic == "" {
+		return fmt.Errorf("Topic must be set")
+	}
+
+	metadataAge := n.RetryBackoff
+	if metadataAge < 10*time.Millisecond {
+		metadataAge = 10 * time.Millisecond
+	}
+
+	options := []kgo.Opt{
+		kgo.SeedBrokers(n.Brokers...),
+		kgo.ClientID(n.ClientID),
+		kgo.DialTimeout(n.Timeout),
+		kgo.ProduceRequestTimeout(n.Timeout),
+		kgo.ProducerBatchMaxBytes(int32(n.BatchSize)),
+		kgo.ProducerLinger(n.Linger),
+		kgo.RetryBackoffFn(n.backoff),
+		// like the Java client, retries refresh the metadata as often as
+		// they back off, within the client limits
+		kgo.MetadataMinAge(metadataAge),
+		kgo.RecordPartitioner(newPartitioner()),
+	}
+
+	switch n.Acks {
+	case AcksAll:
+		options = append(options, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case AcksLeader:
+		options = append(options, kgo.RequiredAcks(kgo.LeaderAck()))
+	case AcksNone:
+		options = append(options, kgo.RequiredAcks(kgo.NoAck()))
+	default:
+		return fmt.Errorf("unsupported acks %q", n.Acks)
+	}
+
+	if n.Idempotent && n.Acks != AcksAll {
+		return fmt.Errorf("the idempotent producer requires acks %s", AcksAll)
+	}
+
+	if !n.Idempotent {
+		options = append(options, kgo.DisableIdempotentWrite())
+	}
+
+	// the client limits the tries, the first one included
+	if n.MaxRetries > 0 {
+		options = append(options, kgo.RecordRetries(n.MaxRetries+1))
+	} else {
+		options = append(options, kgo.RecordRetries(1))
+	}
+
+	// the client compresses with snappy unless told otherwise
+	compression := n.Compression
+	if compression == nil {
+		compression = &Compression{}
+	}
+
+	codec, err := compression.codec()
+	if err != nil {
+		return err
+	}
+
+	options = append(options, kgo.ProducerBatchCompression(codec))
+
+	if n.topic, err = newTextFunc("topic", n.Topic); err != nil {
+		return err
+	}
+
+	if n.key = n.KeyFunc; n.key == nil {
+		if n.key, err = newTextFunc("key", n.Key); err != nil {
+			return err
+		}
+	}
+
+	tlsConfig, err := n.TLS.Config()
+	if err != nil {
+		return fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	if tlsConfig != nil {
+		options = append(options, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	n.options = options
+	if n.producer, err = newProducer(options); err != nil {
+		return fmt.Errorf("creating kafka client: %w", err)
+	}
+
+	return nil
+}
+
+// codec returns the client codec of the compression
+func (c *Compression) codec() (kgo.CompressionCodec, error) {
+	var codec kgo.CompressionCodec
+
+	switch c.Codec {
+	case "", CompressionNone:
+		codec = kgo.NoCompression()
+	case CompressionGzip:
+		codec = kgo.GzipCompression()
+	case CompressionSnappy:
+		codec = kgo.SnappyCompression()
+	case CompressionLZ4:
+		codec = kgo.Lz4Compression()
+	case CompressionZstd:
+		codec = kgo.ZstdCompression()
+	default:
+		return codec, fmt.Errorf("unsupported compression %q", c.Codec)
+	}
+
+	if c.Level == nil {
+		return codec, nil
+	}
+
+	// the client falls back to the default on the levels it can't apply
+	if c.Codec != CompressionZstd {
+		return codec, fmt.Errorf("compression level not supported by %s", c.Codec)
+	}
+
+	if level := zstd.EncoderLevel(*c.Level); level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+		return codec, fmt.Errorf("invalid zstd compression level %d", *c.Level)
+	}
+
+	return codec.WithLevel(*c.Level), nil
+}
+
+// backoff is the wait before a retry, RetryBackoff doubled on each one up to
+// Timeout
+func (n *KafkaNotifier) backoff(tries int) time.Duration {
+	var (
+		b    = utils.Backoff{Initial: n.RetryBackoff, Max: n.Timeout}
+		wait = b.Next()
+	)
+
+	for i := 1; i < tries; i++ {
+		wait = b.Next()
+	}
+
+	return wait
+}
+
+func (n *KafkaNotifier) Type() string {
+	return "kafka"
+}
+
+func (n *KafkaNotifier) Name() string {
+	return n.Config.Name
+}
+
+// Connect checks the brokers can be reached and, for idempotent producers,
+// gets the producer ID
+func (n *KafkaNotifier) Connect() error {
+	if n.configErr != nil {
+		return n.configErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	if err := n.producer.client.Ping(ctx); err != nil {
+		return fmt.Errorf("connecting to kafka: %w", err)
+	}
+
+	if n.Idempotent {
+		if _, _, err := n.producer.client.ProducerID(ctx); err != nil {
+			return fmt.Errorf("initializing producer ID: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close waits for the queued records to be produced and closes the
+// connections
+func (n *KafkaNotifier) Close() error {
+	n.lock.Lock()
+	if n.closed {
+		n.lock.Unlock()
+		return nil
+	}
+	n.closed = true
+	p := n.producer
+	n.lock.Unlock()
+
+	if p == nil {
+		return nil
+	}
+
+	err := p.client.Flush(context.Background())
+	p.client.Close()
+	n.background.Wait()
+
+	return err
+}
+
+// Run starts receiving notifications, they are produced without waiting for
+// the previous ones so they can be batched
+func (n *KafkaNotifier) Run() {
+	for notification := range n.Channel {
+		n.produce(notification, func(r *model.Result) {
+			if !r.Success {
+				n.Logger.Printf("%s: %+v", n.Name(), r)
+			}
+		})
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *KafkaNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *KafkaNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver produces a notification, waiting for the batch it's sent in
+func (n *KafkaNotifier) Deliver(message *model.Notification) *model.Result {
+	done := make(chan *model.Result, 1)
+	n.produce(message, func(r *model.Result) { done <- r })
+
+	return <-done
+}
+
+// produce queues the record of the notification, done is called with the
+// result once its batch is sent or on failure
+func (n *KafkaNotifier) produce(message *model.Notification, done func(r *model.Result)) {
+	if n.configErr != nil {
+		done(&model.Result{Success: false, Error: n.configErr})
+		return
+	}
+
+	r, err := n.record(message)
+	if err != nil {
+		done(&model.Result{Success: false, Error: err})
+		return
+	}
+
+	n.send(r, done)
+}
+
+// send produces a record, done is called with the result
+func (n *KafkaNotifier) send(r *kgo.Record, done func(r *model.Result)) {
+	p, err := n.acquire()
+	if err != nil {
+		done(&model.Result{Success: false, Error: err})
+		return
+	}
+	defer n.lock.RUnlock()
+
+	p.client.Produce(context.Background(), r, func(r *kgo.Record, err error) {
+		if err != nil {
+			if n.Idempotent {
+				p.fail(r)
+			}
+
+			done(&model.Result{Success: false, Error: fmt.Errorf("producing to %s: %w", r.Topic, err)})
+			return
+		}
+
+		// promises must not block, the record is produced again from
+		// another goroutine
+		if p.suspect(r) {
+			n.background.Add(1)
+			go func() {
+				defer n.background.Done()
+				n.send(&kgo.Record{Topic: r.Topic, Key: r.Key, Value: r.Value, Headers: r.Headers, Timestamp: r.Timestamp}, done)
+			}()
+			return
+		}
+
+		// with acks 0 the write isn't waited for
+		done(&model.Result{Success: true, Acknowledged: n.Acks != AcksNone})
+	})
+}
+
+// acquire returns the producer to use, replacing it if a batch failed. The
+// read lock is held on success, so Close waits for the record to be queued
+func (n *KafkaNotifier) acquire() (*producer, error) {
+	n.lock.RLock()
+	for {
+		if n.closed {
+			n.lock.RUnlock()
+			return nil, fmt.Errorf("notifier closed")
+		}
+
+		if !n.producer.failing() {
+			return n.producer, nil
+		}
+
+		n.lock.RUnlock()
+		n.lock.Lock()
+		err := n.replace()
+		n.lock.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		n.lock.RLock()
+	}
+}
+
+// replace swaps a failing producer for a new one, the old one is closed once
+// its queued records are produced. The lock must be held
+func (n *KafkaNotifier) replace() error {
+	if n.closed || !n.producer.failing() {
+		return nil
+	}
+
+	p, err := newProducer(n.options)
+	if err != nil {
+		return fmt.Errorf("creating kafka client: %w", err)
+	}
+
+	old := n.producer
+	n.producer = p
+
+	n.background.Add(1)
+	go func() {
+		defer n.background.Done()
+		old.client.Flush(context.Background())
+		old.client.Close()
+	}()
+
+	return nil
+}
+
+// record builds the record of the notification, the partition is picked by
+// the client
+func (n *KafkaNotifier) record(message *model.Notification) (*kgo.Record, error) {
+	topic, err := n.topic(message)
+	if err != nil {
+		return nil, fmt.Errorf("rendering topic: %w", err)
+	}
+
+	key, err := n.key(message)
+	if err != nil {
+		return nil, fmt.Errorf("rendering key: %w", err)
+	}
+
+	value, err := n.jsonMarshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &kgo.Record{Topic: topic, Value: value, Timestamp: message.Timestamp, Headers: headers(message.Metadata)}
+	if key != "" {
+		r.Key = []byte(key)
+	}
+
+	return r, nil
+}
+
+// headers maps the notification metadata to record headers, sorted by key
+func headers(metadata map[string]string) []kgo.RecordHeader {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	result := make([]kgo.RecordHeader, 0, len(metadata))
+	for k, v := range metadata {
+		result = append(result, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+
+	return result
+}
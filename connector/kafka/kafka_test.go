@@ -0,0 +1,516 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestKafkaNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "success",
+			config: &Config{Brokers: []string{"localhost:9092"}, Topic: "notifications.{{.Event}}", Key: "{{.CorrelationID}}"},
+		},
+		{
+			name:       "fail-brokers",
+			config:     &Config{Topic: "notifications"},
+			wantErrMsg: "Brokers must be set",
+		},
+		{
+			name:       "fail-topic",
+			config:     &Config{Brokers: []string{"localhost:9092"}},
+			wantErrMsg: "Topic must be set",
+		},
+		{
+			name:       "fail-topic-template",
+			config:     &Config{Brokers: []string{"localhost:9092"}, Topic: "{{.Event"},
+			wantErrMsg: "parsing topic template",
+		},
+		{
+			name:       "fail-key-template",
+			config:     &Config{Brokers: []string{"localhost:9092"}, Topic: "notifications", Key: "{{.ID"},
+			wantErrMsg: "parsing key template",
+		},
+		{
+			name:       "fail-acks",
+			config:     &Config{Brokers: []string{"localhost:9092"}, Topic: "notifications", Acks: "-1"},
+			wantErrMsg: `unsupported acks "-1"`,
+		},
+		{
+			name:       "fail-idempotent-acks",
+			config:     &Config{Brokers: []string{"localhost:9092"}, Topic: "notifications", Acks: AcksLeader, Idempotent: true},
+			wantErrMsg: "the idempotent producer requires acks all",
+		},
+		{
+			name: "fail-compression",
+			config: &Config{
+				Brokers:     []string{"localhost:9092"},
+				Topic:       "notifications",
+				Compression: &Compression{Codec: "deflate"},
+			},
+			wantErrMsg: `unsupported compression "deflate"`,
+		},
+		{
+			name: "fail-compression-level",
+			config: &Config{
+				Brokers:     []string{"localhost:9092"},
+				Topic:       "notifications",
+				Compression: &Compression{Codec: CompressionGzip, Level: utils.CompressionLevel(9)},
+			},
+			wantErrMsg: "compression level not supported by gzip",
+		},
+		{
+			name: "fail-zstd-level",
+			config: &Config{
+				Brokers:     []string{"localhost:9092"},
+				Topic:       "notifications",
+				Compression: &Compression{Codec: CompressionZstd, Level: utils.CompressionLevel(9)},
+			},
+			wantErrMsg: "invalid zstd compression level 9",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^kafka[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "kafka", n.Type())
+			assert.Equal(t, n.Name(), n.ClientID)
+			assert.Equal(t, 1<<20, n.BatchSize)
+			assert.Equal(t, 3, n.MaxRetries)
+			assert.NotNil(t, n.GetChannel())
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, n.Connect(), tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.Equal(t, AcksAll, n.Acks)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestKafkaNotifier_Deliver(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:            "abc",
+			Event:         "orders.created",
+			CorrelationID: "order-1",
+			Metadata:      map[string]string{"tenant": "acme", "region": "eu"},
+			// batches that don't shrink are sent uncompressed
+			Data: strings.Repeat("compressible ", 20),
+		}
+
+		// the partition the Java client picks for order-1 among 3
+		partition int32 = 1
+
+		tests = []struct {
+			name             string
+			config           *Config
+			fault            *testFault
+			wantTopic        string
+			wantCompression  uint8
+			wantAcknowledged bool
+			wantProduces     int
+			wantErrMsg       string
+		}{
+			{
+				name:             "keyed",
+				config:           &Config{Topic: "notifications", Key: "{{.CorrelationID}}"},
+				wantTopic:        "notifications",
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name:             "topic-template",
+				config:           &Config{Topic: "{{.Event}}", Key: "{{.CorrelationID}}", Acks: AcksLeader},
+				wantTopic:        "orders.created",
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name:         "acks-none",
+				config:       &Config{Topic: "notifications", Key: "{{.CorrelationID}}", Acks: AcksNone},
+				wantTopic:    "notifications",
+				wantProduces: 1,
+			},
+			{
+				name: "none",
+				config: &Config{
+					Topic:       "notifications",
+					Key:         "{{.CorrelationID}}",
+					Compression: &Compression{Codec: CompressionNone},
+				},
+				wantTopic:        "notifications",
+				wantCompression:  0,
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name: "gzip",
+				config: &Config{
+					Topic:       "notifications",
+					Key:         "{{.CorrelationID}}",
+					Compression: &Compression{Codec: CompressionGzip},
+				},
+				wantTopic:        "notifications",
+				wantCompression:  1,
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name: "snappy",
+				config: &Config{
+					Topic:       "notifications",
+					Key:         "{{.CorrelationID}}",
+					Compression: &Compression{Codec: CompressionSnappy},
+				},
+				wantTopic:        "notifications",
+				wantCompression:  2,
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name: "lz4",
+				config: &Config{
+					Topic:       "notifications",
+					Key:         "{{.CorrelationID}}",
+					Compression: &Compression{Codec: CompressionLZ4},
+				},
+				wantTopic:        "notifications",
+				wantCompression:  3,
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name: "zstd",
+				config: &Config{
+					Topic:       "notifications",
+					Key:         "{{.CorrelationID}}",
+					Compression: &Compression{Codec: CompressionZstd, Level: utils.CompressionLevel(int(zstd.SpeedBestCompression))},
+				},
+				wantTopic:        "notifications",
+				wantCompression:  4,
+				wantAcknowledged: true,
+				wantProduces:     1,
+			},
+			{
+				name:             "retried",
+				config:           &Config{Topic: "notifications", Key: "{{.CorrelationID}}"},
+				fault:            &testFault{topic: "notifications", err: kerr.NotEnoughReplicas, count: 2},
+				wantTopic:        "notifications",
+				wantAcknowledged: true,
+				wantProduces:     3,
+			},
+			{
+				name:         "fail-retries",
+				config:       &Config{Topic: "notifications", Key: "{{.CorrelationID}}", MaxRetries: 1},
+				fault:        &testFault{topic: "notifications", err: kerr.NotEnoughReplicas, count: 2},
+				wantProduces: 2,
+				wantErrMsg:   "producing to notifications: NOT_ENOUGH_REPLICAS",
+			},
+			{
+				name:         "fail-no-retries",
+				config:       &Config{Topic: "notifications", Key: "{{.CorrelationID}}", MaxRetries: -1},
+				fault:        &testFault{topic: "notifications", err: kerr.NotEnoughReplicas},
+				wantProduces: 1,
+				wantErrMsg:   "producing to notifications: NOT_ENOUGH_REPLICAS",
+			},
+			{
+				name:         "fail-not-retriable",
+				config:       &Config{Topic: "notifications", Key: "{{.CorrelationID}}"},
+				fault:        &testFault{topic: "notifications", err: kerr.TopicAuthorizationFailed},
+				wantProduces: 1,
+				wantErrMsg:   "producing to notifications: TOPIC_AUTHORIZATION_FAILED",
+			},
+			{
+				name:       "fail-unknown-topic",
+				config:     &Config{Topic: "missing"},
+				wantErrMsg: "producing to missing: no partitions available",
+			},
+			{
+				name:       "fail-key",
+				config:     &Config{Topic: "notifications", Key: "{{.Data.region}}"},
+				wantErrMsg: "rendering key",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				cluster  = newTestCluster(t, 2, map[string]int32{"notifications": 3, "orders.created": 3})
+				produces = cluster.observe()
+			)
+
+			tt.config.Brokers = []string{cluster.Addr()}
+			tt.config.RetryBackoff = 10 * time.Millisecond
+			n := New(tt.config)
+			defer n.Close()
+
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.fault != nil {
+				cluster.fault(tt.fault)
+			}
+
+			r := n.Deliver(message)
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				assert.Equal(t, tt.wantProduces, produces.Hits())
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.Equal(t, tt.wantAcknowledged, r.Acknowledged)
+
+			// with acks 0 the write isn't waited for
+			records := cluster.records(t, tt.wantTopic, 1)
+			if !assert.Len(t, records, 1) {
+				return
+			}
+
+			assert.Equal(t, tt.wantProduces, produces.Hits())
+
+			record := records[0]
+
+			assert.Equal(t, partition, record.Partition)
+			assert.Equal(t, tt.wantCompression, record.Compression)
+			assert.Equal(t, int64(-1), record.ProducerID)
+			assert.Equal(t, "order-1", string(record.Key))
+			assert.Equal(t, map[string]string{"tenant": "acme", "region": "eu"}, record.Headers)
+
+			var got model.Notification
+			assert.NoError(t, json.Unmarshal(record.Value, &got))
+			assert.Equal(t, "abc", got.ID)
+		})
+	}
+}
+
+func TestKafkaNotifier_DeliverRoundRobin(t *testing.T) {
+	cluster := newTestCluster(t, 2, map[string]int32{"notifications": 3})
+
+	n := New(&Config{Brokers: []string{cluster.Addr()}, Topic: "notifications"})
+	defer n.Close()
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, n.Deliver(&model.Notification{Event: "orders.created"}).Error)
+	}
+
+	partitions := map[int32]int{}
+	for _, r := range cluster.records(t, "notifications", 6) {
+		assert.Nil(t, r.Key)
+		partitions[r.Partition]++
+	}
+
+	assert.Equal(t, map[int32]int{0: 2, 1: 2, 2: 2}, partitions)
+}
+
+func TestKafkaNotifier_DeliverLeaderMoved(t *testing.T) {
+	var (
+		cluster = newTestCluster(t, 2, map[string]int32{"notifications": 1})
+		n       = New(&Config{Brokers: []string{cluster.Addr()}, Topic: "notifications", RetryBackoff: 10 * time.Millisecond})
+	)
+
+	defer n.Close()
+
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "1"}).Error)
+
+	// the old leader refuses the batch, it's sent to the new one once the
+	// metadata is refreshed
+	leader := cluster.LeaderFor("notifications", 0)
+	if err := cluster.MoveTopicPartition("notifications", 0, 1-leader); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "2"}).Error)
+	assert.Len(t, cluster.records(t, "notifications", 2), 2)
+}
+
+func TestKafkaNotifier_DeliverIdempotent(t *testing.T) {
+	var (
+		cluster = newTestCluster(t, 1, map[string]int32{"notifications": 1})
+		n       = New(&Config{
+			Brokers:      []string{cluster.Addr()},
+			Topic:        "notifications",
+			Idempotent:   true,
+			RetryBackoff: 10 * time.Millisecond,
+		})
+	)
+
+	defer n.Close()
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "1"}).Error)
+
+	// the batch is written but the response lost, the retry is recognized as
+	// a duplicate by its sequence number
+	cluster.dropResponses(1)
+
+	r := n.Deliver(&model.Notification{ID: "2"})
+	assert.NoError(t, r.Error)
+	assert.True(t, r.Acknowledged)
+	assert.Equal(t, int32(1), cluster.dropped.Load())
+
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "3"}).Error)
+
+	var ids []string
+	for _, r := range cluster.records(t, "notifications", 3) {
+		var got model.Notification
+		assert.NoError(t, json.Unmarshal(r.Value, &got))
+		assert.GreaterOrEqual(t, r.ProducerID, int64(0))
+		ids = append(ids, got.ID)
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+}
+
+func TestKafkaNotifier_DeliverIdempotentLost(t *testing.T) {
+	var (
+		cluster = newTestCluster(t, 1, map[string]int32{"notifications": 1})
+		n       = New(&Config{
+			Brokers:      []string{cluster.Addr()},
+			Topic:        "notifications",
+			Idempotent:   true,
+			MaxRetries:   2,
+			RetryBackoff: 10 * time.Millisecond,
+		})
+		first *kmsg.ProduceRequest
+	)
+
+	defer n.Close()
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "1"}).Error)
+
+	// the batch is written but the response lost, then the retries are
+	// refused until they run out
+	cluster.dropResponses(1)
+	refused := cluster.fault(&testFault{
+		err: kerr.NotEnoughReplicas,
+		when: func(req *kmsg.ProduceRequest) bool {
+			if first == nil {
+				first = req
+			}
+			return req != first
+		},
+	})
+
+	r := n.Deliver(&model.Notification{ID: "2"})
+	assert.ErrorContains(t, r.Error, "NOT_ENOUGH_REPLICAS")
+	assert.Equal(t, int32(1), cluster.dropped.Load())
+	assert.Equal(t, 2, refused.Hits())
+
+	refused.Remove()
+
+	// the next batch isn't taken for a retry of the failed one
+	assert.NoError(t, n.Deliver(&model.Notification{ID: "3"}).Error)
+
+	var (
+		records = cluster.records(t, "notifications", 3)
+		ids     []string
+	)
+
+	for _, r := range records {
+		var got model.Notification
+		assert.NoError(t, json.Unmarshal(r.Value, &got))
+		ids = append(ids, got.ID)
+	}
+
+	if assert.Equal(t, []string{"1", "2", "3"}, ids) {
+		assert.NotEqual(t, records[0].ProducerID, records[2].ProducerID)
+	}
+}
+
+func TestKafkaNotifier_DeliverBatched(t *testing.T) {
+	var (
+		cluster  = newTestCluster(t, 1, map[string]int32{"notifications": 1})
+		produces = cluster.observe()
+		n        = New(&Config{
+			Brokers: []string{cluster.Addr()},
+			Topic:   "notifications",
+			Linger:  200 * time.Millisecond,
+		})
+		wg sync.WaitGroup
+	)
+
+	defer n.Close()
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, n.Deliver(&model.Notification{Event: "orders.created"}).Error)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Len(t, cluster.records(t, "notifications", 10), 10)
+	assert.Less(t, produces.Hits(), 10, "records not batched")
+}
+
+func TestKafkaNotifier_Run(t *testing.T) {
+	var (
+		cluster = newTestCluster(t, 1, map[string]int32{"notifications": 1})
+		buf     bytes.Buffer
+		n       = New(&Config{
+			Brokers: []string{cluster.Addr()},
+			Topic:   "notifications",
+			Key:     "{{.Data.id}}",
+			Logger:  log.New(&buf, "", 0),
+		})
+		done = make(chan struct{})
+	)
+
+	go func() {
+		n.Run()
+		close(done)
+	}()
+
+	for i := 0; i < 5; i++ {
+		n.Notify(&model.Notification{Event: "orders.created", Data: map[string]any{"id": i}})
+	}
+	n.Notify(&model.Notification{Event: "orders.created", Data: map[string]any{}})
+
+	close(n.Channel)
+	<-done
+
+	// Close waits for the queued records
+	assert.NoError(t, n.Close())
+	assert.Len(t, cluster.records(t, "notifications", 5), 5)
+	assert.Contains(t, buf.String(), "rendering key")
+	assert.ErrorContains(t, n.Deliver(&model.Notification{Data: map[string]any{"id": 1}}).Error, "notifier closed")
+}
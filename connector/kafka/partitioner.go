@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// KeyFunc derives the record key of a notification, records with the same
+// key are produced to the same partition
+type KeyFunc func(message *model.Notification) (string, error)
+
+// newTextFunc returns a function rendering text against notifications, text
+// can be a template like "{{.CorrelationID}}"
+func newTextFunc(name, text string) (KeyFunc, error) {
+	if !utils.IsTemplate(text) {
+		return func(*model.Notification) (string, error) { return text, nil }, nil
+	}
+
+	tpl, err := utils.ParseTemplate(name, text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s template: %w", name, err)
+	}
+
+	return func(message *model.Notification) (string, error) {
+		return tpl.Render(message)
+	}, nil
+}
+
+// partitioner picks the partition of keyed records the way the Java client
+// does, so records keyed alike land together whatever client produced them.
+// Records without key are spread round robin
+type partitioner struct {
+	keyed   kgo.Partitioner
+	unkeyed kgo.Partitioner
+}
+
+func newPartitioner() kgo.Partitioner {
+	return &partitioner{keyed: kgo.StickyKeyPartitioner(nil), unkeyed: kgo.RoundRobinPartitioner()}
+}
+
+func (p *partitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	return &topicPartitioner{keyed: p.keyed.ForTopic(topic), unkeyed: p.unkeyed.ForTopic(topic)}
+}
+
+type topicPartitioner struct {
+	keyed   kgo.TopicPartitioner
+	unkeyed kgo.TopicPartitioner
+}
+
+// RequiresConsistency keeps keyed records on their partition even while it's
+// unavailable
+func (p *topicPartitioner) RequiresConsistency(r *kgo.Record) bool {
+	return r.Key != nil
+}
+
+func (p *topicPartitioner) Partition(r *kgo.Record, n int) int {
+	if r.Key != nil {
+		return p.keyed.Partition(r, n)
+	}
+
+	return p.unkeyed.Partition(r, n)
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// topicPartition identifies a partition, records failed before being
+// assigned one have partition -1
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// producer is a client with its producer ID. Once an idempotent batch fails,
+// the client rewinds the sequence numbers of the partition to the failed
+// batch, if that was written after all the next batch is taken for a retry
+// of it and dropped. So the producer is replaced, the new one gets another
+// producer ID and starts the sequences from 0
+type producer struct {
+	client *kgo.Client
+	lock   sync.Mutex
+	failed map[topicPartition]bool
+}
+
+func newProducer(options []kgo.Opt) (*producer, error) {
+	client, err := kgo.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &producer{client: client, failed: make(map[topicPartition]bool)}, nil
+}
+
+// fail records a batch of the partition of r failed
+func (p *producer) fail(r *kgo.Record) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.failed[topicPartition{r.Topic, r.Partition}] = true
+}
+
+// failing returns whether a batch failed, the producer must be replaced
+func (p *producer) failing() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.failed) > 0
+}
+
+// suspect returns whether r was produced after a batch of its partition
+// failed, it may have been dropped as a duplicate
+func (p *producer) suspect(r *kgo.Record) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.failed[topicPartition{r.Topic, r.Partition}]
+}
@@ -0,0 +1,268 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/rs/zerolog"
+)
+
+// received is a message published to the test broker
+type received struct {
+	clientID      string
+	version       Version
+	topic         string
+	qos           QoS
+	retain        bool
+	dup           bool
+	payload       []byte
+	contentType   string
+	correlation   string
+	messageExpiry uint32
+	user          [][2]string
+}
+
+// testBroker is an in-process mochi-mqtt broker, its hook checks the
+// credentials, records the publishings and misbehaves as configured
+type testBroker struct {
+	*mochi.Server
+	listener net.Listener
+	// username and password are required from clients when set
+	username string
+	password string
+	// maxQoS is announced to MQTT 5 clients, noRetain tells them retained
+	// messages aren't supported
+	maxQoS   *QoS
+	noRetain bool
+	// rejectCode is answered to MQTT 5 publishings instead of success
+	rejectCode byte
+	// deny answers publishings with not authorized
+	deny bool
+	// silent leaves publishings unacknowledged
+	silent bool
+	// dropFirst closes the connection on the first QoS 1 or 2 publishing
+	// without processing it
+	dropFirst bool
+	// dropTaken closes the connection on the first QoS 1 or 2 publishing
+	// after taking it, before acknowledging it
+	dropTaken bool
+	// dropRelease closes the connection on the first PUBREL
+	dropRelease bool
+	// forgetSessions discards the session of clients once disconnected
+	forgetSessions bool
+
+	lock        sync.Mutex
+	messages    []received
+	connections int
+	pings       int
+	dropped     bool
+}
+
+// newTestBroker starts b, configured with its credentials and behaviour
+func newTestBroker(t *testing.T, b *testBroker) *testBroker {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities := *mochi.DefaultServerCapabilities
+	if b.maxQoS != nil {
+		capabilities.MaximumQos = byte(*b.maxQoS)
+	}
+
+	logger := zerolog.Nop()
+
+	b.listener = l
+	b.Server = mochi.New(&mochi.Options{
+		Capabilities: &capabilities,
+		Logger:       &logger,
+	})
+
+	if err := b.AddHook(&testHook{broker: b}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.AddListener(listeners.NewNet("test", l)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func (b *testBroker) Address() string {
+	return b.listener.Addr().String()
+}
+
+func (b *testBroker) received() []received {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]received(nil), b.messages...)
+}
+
+func (b *testBroker) stats() (connections, pings int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.connections, b.pings
+}
+
+// testHook hooks the test broker into the mochi-mqtt server
+type testHook struct {
+	mochi.HookBase
+	broker *testBroker
+}
+
+func (h *testHook) ID() string {
+	return "test"
+}
+
+func (h *testHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnSessionEstablished,
+		mochi.OnPacketRead,
+		mochi.OnPacketEncode,
+		mochi.OnPublish,
+		mochi.OnDisconnect,
+	}, []byte{b})
+}
+
+func (h *testHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	if h.broker.username == "" {
+		return true
+	}
+
+	return string(pk.Connect.Username) == h.broker.username && string(pk.Connect.Password) == h.broker.password
+}
+
+func (h *testHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	return true
+}
+
+func (h *testHook) OnSessionEstablished(cl *mochi.Client, pk packets.Packet) {
+	h.broker.lock.Lock()
+	defer h.broker.lock.Unlock()
+
+	h.broker.connections++
+}
+
+func (h *testHook) OnPacketRead(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	b := h.broker
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch pk.FixedHeader.Type {
+	case packets.Pingreq:
+		b.pings++
+	case packets.Pubrel:
+		if b.dropRelease && !b.dropped {
+			b.dropped = true
+			cl.Stop(errors.New("dropped by test broker"))
+			return pk, packets.ErrRejectPacket
+		}
+	}
+
+	return pk, nil
+}
+
+func (h *testHook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	if !h.broker.forgetSessions {
+		return
+	}
+
+	if existing, ok := h.broker.Clients.Get(cl.ID); ok && existing == cl {
+		h.broker.Clients.Delete(cl.ID)
+	}
+}
+
+// OnPacketEncode tells MQTT 5 clients retained messages aren't supported,
+// mochi-mqtt doesn't announce it
+func (h *testHook) OnPacketEncode(cl *mochi.Client, pk packets.Packet) packets.Packet {
+	if h.broker.noRetain && pk.FixedHeader.Type == packets.Connack {
+		pk.Properties.RetainAvailable = 0
+		pk.Properties.RetainAvailableFlag = true
+	}
+
+	return pk
+}
+
+func (h *testHook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	b := h.broker
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.dropFirst && pk.FixedHeader.Qos > 0 && !b.dropped {
+		b.dropped = true
+		cl.Stop(errors.New("dropped by test broker"))
+		return pk, packets.ErrRejectPacket
+	}
+
+	if b.silent {
+		return pk, packets.ErrRejectPacket
+	}
+
+	if b.deny {
+		// mochi-mqtt drops publishings failing the ACL check without
+		// answering, the acknowledgement is sent here instead
+		ack := packets.Puback
+		if pk.FixedHeader.Qos == 2 {
+			ack = packets.Pubrec
+		}
+
+		cl.WritePacket(packets.Packet{
+			FixedHeader: packets.FixedHeader{Type: ack},
+			PacketID:    pk.PacketID,
+			ReasonCode:  packets.ErrNotAuthorized.Code,
+		})
+
+		return pk, packets.ErrRejectPacket
+	}
+
+	if b.rejectCode != 0 {
+		return pk, packets.Code{Code: b.rejectCode}
+	}
+
+	m := received{
+		clientID:      cl.ID,
+		version:       Version(cl.Properties.ProtocolVersion),
+		topic:         pk.TopicName,
+		qos:           QoS(pk.FixedHeader.Qos),
+		retain:        pk.FixedHeader.Retain,
+		dup:           pk.FixedHeader.Dup,
+		payload:       pk.Payload,
+		contentType:   pk.Properties.ContentType,
+		correlation:   string(pk.Properties.CorrelationData),
+		messageExpiry: pk.Properties.MessageExpiryInterval,
+	}
+
+	for _, p := range pk.Properties.User {
+		m.user = append(m.user, [2]string{p.Key, p.Val})
+	}
+
+	b.messages = append(b.messages, m)
+
+	if b.dropTaken && pk.FixedHeader.Qos > 0 && !b.dropped {
+		b.dropped = true
+		cl.Stop(errors.New("dropped by test broker"))
+		return pk, packets.ErrRejectPacket
+	}
+
+	return pk, nil
+}
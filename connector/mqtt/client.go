@@ -0,0 +1,304 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/padiazg/notifier/utils"
+)
+
+// reason codes returned by MQTT 5 brokers
+var reasonNames = map[byte]string{
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8a: "banned",
+	0x8b: "server shutting down",
+	0x8d: "keep alive timeout",
+	0x8e: "session taken over",
+	0x90: "topic name invalid",
+	0x92: "packet identifier not found",
+	0x93: "receive maximum exceeded",
+	0x95: "packet too large",
+	0x97: "quota exceeded",
+	0x99: "payload format invalid",
+	0x9a: "retain not supported",
+	0x9b: "QoS not supported",
+	0x9c: "use another server",
+	0x9d: "server moved",
+	0x9f: "connection rate exceeded",
+}
+
+// return codes of MQTT 3.1.1 CONNACK packets
+var returnCodeNames = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// reasonText describes a reason code, with the reason string sent by the
+// broker if any
+func reasonText(names map[byte]string, code byte, reason string) string {
+	text, ok := names[code]
+	if !ok {
+		text = fmt.Sprintf("reason code 0x%02x", code)
+	}
+
+	if reason != "" {
+		text += ": " + reason
+	}
+
+	return text
+}
+
+// publish is an application message
+type publish struct {
+	topic      string
+	qos        QoS
+	retain     bool
+	payload    []byte
+	properties *paho.PublishProperties
+}
+
+// connection is a session established with the broker by the client of the
+// protocol version
+type connection interface {
+	// check returns why the broker can't take p, nil if it can
+	check(p *publish) error
+	// publish sends p, with QoS 1 and 2 it waits for the acknowledgement
+	// until ctx is done. It fails right away when all the packet identifiers
+	// are in use by unacknowledged publishings
+	publish(ctx context.Context, p *publish) error
+	// resumed returns whether the broker resumed the previous session
+	resumed() bool
+	// disconnect ends the session gracefully
+	disconnect() error
+	// closed is closed once the connection is lost, err returns why
+	closed() <-chan struct{}
+	err() error
+}
+
+// link is closed once a connection is lost, keeping the first cause
+type link struct {
+	once  sync.Once
+	lost  chan struct{}
+	cause error
+}
+
+func newLink() *link {
+	return &link{lost: make(chan struct{})}
+}
+
+func (l *link) fail(cause error) {
+	l.once.Do(func() {
+		l.cause = cause
+		close(l.lost)
+	})
+}
+
+func (l *link) closed() <-chan struct{} {
+	return l.lost
+}
+
+func (l *link) err() error {
+	return l.cause
+}
+
+// connect opens a connection with the client of the protocol version
+func (n *MQTTNotifier) connect() error {
+	var (
+		c   connection
+		err error
+	)
+
+	if n.Version == Version5 {
+		c, err = n.openV5()
+	} else {
+		c, err = n.openV311()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	n.lock.Lock()
+
+	select {
+	case <-n.done:
+		n.lock.Unlock()
+		c.disconnect()
+		return errors.New("notifier closed")
+	case <-c.closed():
+		n.lock.Unlock()
+		return fmt.Errorf("connection lost: %w", c.err())
+	default:
+	}
+
+	n.conn = c
+	if !c.resumed() {
+		// the unacknowledged publishings went with the previous session, the
+		// clients don't send them into a new one
+		n.failWaiting(errors.New("session not resumed by the broker, the message may not have been delivered"))
+	}
+	n.lock.Unlock()
+
+	return nil
+}
+
+// credentials resolves the username and password
+func (n *MQTTNotifier) credentials() (string, string, error) {
+	if n.SASL == nil {
+		return "", "", nil
+	}
+
+	mechanism, username, password, err := n.SASL.Credentials()
+	if err != nil {
+		return "", "", fmt.Errorf("resolving credentials: %w", err)
+	}
+
+	if mechanism != utils.SASLPlain {
+		return "", "", fmt.Errorf("unsupported SASL mechanism %s", mechanism)
+	}
+
+	return username, password, nil
+}
+
+// open dials the broker, the clients establish the session over it
+func (n *MQTTNotifier) open() (net.Conn, error) {
+	tlsConfig, err := n.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	conn, err := n.dial("tcp", n.Address, n.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("dialing MQTT broker: %w", err)
+	}
+
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(n.Address)
+		}
+
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	return conn, nil
+}
+
+// wait returns the context a publishing waits for acknowledgement on, it's
+// cancelled with the cause when the publishing can't be acknowledged anymore
+func (n *MQTTNotifier) wait(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	n.lock.Lock()
+	n.sequence++
+	id := n.sequence
+	n.waiting[id] = cancel
+	n.lock.Unlock()
+
+	return ctx, func() {
+		n.lock.Lock()
+		delete(n.waiting, id)
+		n.lock.Unlock()
+
+		cancel(nil)
+	}
+}
+
+// failWaiting ends every publishing waiting for acknowledgement with an
+// error, the lock must be held
+func (n *MQTTNotifier) failWaiting(err error) {
+	for id, cancel := range n.waiting {
+		cancel(err)
+		delete(n.waiting, id)
+	}
+}
+
+// keepsWaiting returns whether the publishings waiting for acknowledgement
+// survive a lost connection, they do when an MQTT 5 broker keeps the session
+// until reconnecting. The MQTT 3.1.1 client doesn't follow them across
+// connections
+func (n *MQTTNotifier) keepsWaiting() bool {
+	return n.Version == Version5 && n.Reconnect != nil && !n.CleanSession && n.SessionExpiry > 0
+}
+
+// lost handles a broken connection, with Reconnect set it's recovered in the
+// background
+func (n *MQTTNotifier) lost(c connection, cause error) {
+	n.lock.Lock()
+	if n.conn != c {
+		// closed, already handled or not established yet
+		n.lock.Unlock()
+		return
+	}
+
+	n.conn = nil
+	n.lock.Unlock()
+
+	n.handleError(fmt.Errorf("%s: connection lost: %v", n.Name(), cause))
+
+	if !n.keepsWaiting() {
+		n.lock.Lock()
+		n.failWaiting(fmt.Errorf("connection lost: %w", cause))
+		n.lock.Unlock()
+	}
+
+	if n.Reconnect != nil {
+		go n.recover()
+	}
+}
+
+// recover reconnects retrying with backoff until it succeeds, the notifier
+// is closed or MaxAttempts is reached
+func (n *MQTTNotifier) recover() {
+	backoff := &utils.Backoff{
+		Initial: n.Reconnect.InitialInterval,
+		Max:     n.Reconnect.MaxInterval,
+	}
+
+	for {
+		if n.Reconnect.MaxAttempts > 0 && backoff.Attempts() >= n.Reconnect.MaxAttempts {
+			n.handleError(fmt.Errorf("%s: giving up reconnecting after %d attempts", n.Name(), backoff.Attempts()))
+
+			n.lock.Lock()
+			n.failWaiting(ErrNotConnected)
+			n.lock.Unlock()
+
+			return
+		}
+
+		timer := time.NewTimer(backoff.Next())
+		select {
+		case <-n.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := n.connect()
+		if err == nil {
+			break
+		}
+
+		n.handleError(fmt.Errorf("%s: reconnecting, attempt %d: %w", n.Name(), backoff.Attempts(), err))
+	}
+
+	n.Logger.Printf("%s: connection recovered", n.Name())
+}
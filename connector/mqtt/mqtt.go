@@ -0,0 +1,400 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	paho311 "github.com/eclipse/paho.mqtt.golang"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Version is the protocol level sent on CONNECT
+type Version byte
+
+const (
+	Version311 Version = 4
+	Version5   Version = 5
+)
+
+// QoS is the delivery guarantee of the publishings
+type QoS byte
+
+const (
+	// AtMostOnce publishes without acknowledgement
+	AtMostOnce QoS = 0
+	// AtLeastOnce waits for a PUBACK, the broker may get duplicates
+	AtLeastOnce QoS = 1
+	// ExactlyOnce completes the PUBREC, PUBREL, PUBCOMP exchange
+	ExactlyOnce QoS = 2
+)
+
+const (
+	defaultAddress = "localhost:1883"
+	defaultTopic   = "notify/{{.Event}}"
+)
+
+// ErrNotConnected is reported for notifications delivered while the connection is down
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+// TopicFunc derives the topic of a notification
+type TopicFunc func(message *model.Notification) (string, error)
+
+// ReconnectOptions enables the recovery of the connection when it's lost.
+// Publishings waiting for acknowledgement fail with the connection unless an
+// MQTT 5 broker keeps the session (SessionExpiry without CleanSession), then
+// they're sent again once recovered. They fail too if the broker didn't keep
+// the session after all, nothing is sent again into a new session
+type ReconnectOptions struct {
+	// InitialInterval is the wait before the first attempt, doubled after each failure
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between attempts
+	MaxInterval time.Duration
+	// MaxAttempts gives up after the given number of failed attempts, 0 retries forever
+	MaxAttempts int
+}
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// Address is the host:port of the broker, localhost:1883 if not set
+	Address string
+	// Version is the protocol version, MQTT 3.1.1 if not set
+	Version Version
+	// ClientID identifies the session on the broker, the Name if not set
+	ClientID string
+	// Topic is where notifications are published, it can be a template,
+	// notify/{{.Event}} if not set, e.g. devices/{{.Data.device}}/{{.Event}}
+	Topic string
+	// TopicFunc derives the topic of each notification, overrides Topic
+	TopicFunc TopicFunc
+	// QoS of the publishings, deliveries with QoS 1 and 2 succeed once
+	// acknowledged by the broker
+	QoS QoS
+	// Retain asks the broker to keep the last notification of each topic for
+	// new subscribers
+	Retain bool
+	// CleanSession discards the session state on the broker when connecting,
+	// otherwise unacknowledged publishings survive a reconnection as long as
+	// the broker resumes the session
+	CleanSession bool
+	// SessionExpiry is how long an MQTT 5 broker keeps the session after
+	// disconnecting, 0 ends it with the connection
+	SessionExpiry time.Duration
+	// MessageExpiry is how long an MQTT 5 broker keeps a publishing for
+	// subscribers, 0 keeps it indefinitely
+	MessageExpiry time.Duration
+	// KeepAlive is the interval between pings in whole seconds, 30 seconds if
+	// not set
+	KeepAlive time.Duration
+	// Timeout limits connecting and waiting for acknowledgements, 10 seconds
+	// if not set
+	Timeout time.Duration
+	// SASL sets the username and password, only PLAIN is supported
+	SASL *utils.SASL
+	// TLS configures encrypted connections
+	TLS       *utils.TLSOptions
+	Reconnect *ReconnectOptions
+	OnError   func(error)
+}
+
+// MQTTNotifier implements the Notifier interface for MQTT brokers, it
+// publishes with the Eclipse Paho clients
+type MQTTNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	topic       TopicFunc
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+	dial        func(network, address string, timeout time.Duration) (net.Conn, error)
+	// store and session keep the unacknowledged publishings across the
+	// connections of the MQTT 3.1.1 and 5 clients
+	store   *sessionStore
+	session *state.State
+
+	lock      sync.Mutex
+	conn      connection
+	sequence  uint64
+	waiting   map[uint64]context.CancelCauseFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ model.Notifier = (*MQTTNotifier)(nil)
+
+func New(config *Config) *MQTTNotifier {
+	return (&MQTTNotifier{}).New(config)
+}
+
+func (n *MQTTNotifier) New(config *Config) *MQTTNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+
+	if config.Version == 0 {
+		config.Version = Version311
+	}
+
+	if config.ClientID == "" {
+		config.ClientID = config.Name
+	}
+
+	if config.Topic == "" {
+		config.Topic = defaultTopic
+	}
+
+	if config.KeepAlive == 0 {
+		config.KeepAlive = 30 * time.Second
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.Marshal
+	n.dial = net.DialTimeout
+	n.store = &sessionStore{MemoryStore: paho311.NewMemoryStore()}
+	n.session = state.NewInMemory()
+	n.waiting = make(map[uint64]context.CancelCauseFunc)
+	n.done = make(chan struct{})
+	n.topic, n.configErr = newTopicFunc(config)
+
+	if n.configErr == nil {
+		n.configErr = config.validate()
+	}
+
+	return n
+}
+
+// validate checks the options the broker can't be asked for
+func (c *Config) validate() error {
+	if c.Version != Version311 && c.Version != Version5 {
+		return fmt.Errorf("unsupported protocol version %d", c.Version)
+	}
+
+	if c.QoS > ExactlyOnce {
+		return fmt.Errorf("invalid QoS %d", c.QoS)
+	}
+
+	return nil
+}
+
+// newTopicFunc returns the function deriving topics, a TopicFunc takes
+// precedence over the Topic
+func newTopicFunc(config *Config) (TopicFunc, error) {
+	if config.TopicFunc != nil {
+		return config.TopicFunc, nil
+	}
+
+	if !utils.IsTemplate(config.Topic) {
+		topic := config.Topic
+		return func(*model.Notification) (string, error) { return topic, nil }, nil
+	}
+
+	tpl, err := utils.ParseTemplate("topic", config.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("parsing topic template: %w", err)
+	}
+
+	return func(message *model.Notification) (string, error) {
+		return tpl.Render(message)
+	}, nil
+}
+
+func (n *MQTTNotifier) Type() string {
+	return "mqtt"
+}
+
+func (n *MQTTNotifier) Name() string {
+	return n.Config.Name
+}
+
+// Connect connects to the broker, with Reconnect set the connection is
+// recovered in the background when lost
+func (n *MQTTNotifier) Connect() error {
+	if n.configErr != nil {
+		return n.configErr
+	}
+
+	return n.connect()
+}
+
+// Close disconnects from the broker and fails the publishings waiting for
+// acknowledgement
+func (n *MQTTNotifier) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
+
+	n.lock.Lock()
+	conn := n.conn
+	n.conn = nil
+	n.failWaiting(errors.New("connection closed"))
+	n.lock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.disconnect()
+}
+
+// Run starts receiving notifications
+func (n *MQTTNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *MQTTNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *MQTTNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver publishes a notification, with QoS 1 and 2 it waits for the broker
+// to acknowledge it
+func (n *MQTTNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	topic, err := n.topic(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("rendering topic: %w", err)}
+	}
+
+	if topic == "" || len(topic) > 65535 || strings.ContainsAny(topic, "+#\x00") {
+		return &model.Result{Success: false, Error: fmt.Errorf("invalid topic %q", topic)}
+	}
+
+	payload, err := n.jsonMarshal(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	n.lock.Lock()
+	c := n.conn
+	n.lock.Unlock()
+
+	if c == nil {
+		return &model.Result{Success: false, Error: ErrNotConnected}
+	}
+
+	p := &publish{
+		topic:      topic,
+		qos:        n.QoS,
+		retain:     n.Retain,
+		payload:    payload,
+		properties: n.properties(message),
+	}
+
+	if err := c.check(p); err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	ctx, done := n.wait(ctx)
+	defer done()
+
+	if err := c.publish(ctx, p); err != nil {
+		// the cause tells why the wait was interrupted
+		switch cause := context.Cause(ctx); {
+		case cause == context.DeadlineExceeded:
+			err = errors.New("timed out waiting for acknowledgement")
+		case cause != nil:
+			err = cause
+		}
+
+		return &model.Result{Success: false, Error: err}
+	}
+
+	return &model.Result{Success: true, Acknowledged: n.QoS > AtMostOnce}
+}
+
+// properties returns the MQTT 5 properties of a publishing, the metadata is
+// sent as user properties
+func (n *MQTTNotifier) properties(message *model.Notification) *paho.PublishProperties {
+	if n.Version != Version5 {
+		return nil
+	}
+
+	format := byte(1)
+	props := &paho.PublishProperties{PayloadFormat: &format, ContentType: "application/json"}
+
+	if n.MessageExpiry > 0 {
+		expiry := uint32(n.MessageExpiry / time.Second)
+		props.MessageExpiry = &expiry
+	}
+
+	if message.CorrelationID != "" {
+		props.CorrelationData = []byte(message.CorrelationID)
+	}
+
+	for _, k := range sortedKeys(message.Metadata) {
+		props.User = append(props.User, paho.UserProperty{Key: k, Value: message.Metadata[k]})
+	}
+
+	return props
+}
+
+// handleError reports an error through the logger and the OnError hook
+func (n *MQTTNotifier) handleError(err error) {
+	n.Logger.Print(err)
+
+	if n.OnError != nil {
+		n.OnError(err)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,592 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantTopic  string
+		wantErrMsg string
+	}{
+		{
+			name:      "default-topic",
+			config:    &Config{},
+			wantTopic: "notify/orders.created",
+		},
+		{
+			name:      "topic-template",
+			config:    &Config{Topic: "devices/{{.Data.device}}/{{.Event}}"},
+			wantTopic: "devices/d-1/orders.created",
+		},
+		{
+			name:      "topic-func",
+			config:    &Config{Topic: "ignored", TopicFunc: func(m *model.Notification) (string, error) { return "custom", nil }},
+			wantTopic: "custom",
+		},
+		{
+			name:       "fail-topic",
+			config:     &Config{Topic: "{{.Event"},
+			wantErrMsg: "parsing topic template",
+		},
+		{
+			name:       "fail-version",
+			config:     &Config{Version: 3},
+			wantErrMsg: "unsupported protocol version 3",
+		},
+		{
+			name:       "fail-qos",
+			config:     &Config{QoS: 3},
+			wantErrMsg: "invalid QoS 3",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^mqtt[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "mqtt", n.Type())
+			assert.Equal(t, "localhost:1883", n.Address)
+			assert.Equal(t, n.Name(), n.ClientID)
+			assert.Equal(t, 30*time.Second, n.KeepAlive)
+			assert.Equal(t, 10*time.Second, n.Timeout)
+			assert.NotNil(t, n.GetChannel())
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, n.Connect(), tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.Equal(t, Version311, n.Version)
+
+			topic, err := n.topic(&model.Notification{Event: "orders.created", Data: map[string]any{"device": "d-1"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTopic, topic)
+		})
+	}
+}
+
+func TestMQTTNotifier_Connect(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "v311",
+			config: &Config{SASL: &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "secret"}}},
+		},
+		{
+			name:   "v5",
+			config: &Config{Version: Version5, SASL: &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "secret"}}},
+		},
+		{
+			name:       "fail-v311-credentials",
+			config:     &Config{SASL: &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "wrong"}}},
+			wantErrMsg: "connection refused: not authorized",
+		},
+		{
+			name:       "fail-v5-credentials",
+			config:     &Config{Version: Version5},
+			wantErrMsg: "connection refused: bad user name or password",
+		},
+		{
+			name:       "fail-mechanism",
+			config:     &Config{SASL: &utils.SASL{Mechanism: utils.SASLExternal}},
+			wantErrMsg: "unsupported SASL mechanism EXTERNAL",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newTestBroker(t, &testBroker{username: "user", password: "secret"})
+
+			tt.config.Address = broker.Address()
+			n := New(tt.config)
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+
+	t.Run("fail-dial", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		l.Close()
+
+		n := New(&Config{Address: l.Addr().String()})
+		assert.ErrorContains(t, n.Connect(), "dialing MQTT broker")
+		assert.ErrorIs(t, n.Deliver(&model.Notification{Event: "orders.created"}).Error, ErrNotConnected)
+	})
+}
+
+func TestMQTTNotifier_Deliver(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:            "abc",
+			Event:         "orders.created",
+			Data:          map[string]any{"device": "d-1"},
+			CorrelationID: "req-1",
+			Metadata:      map[string]string{"tenant": "acme", "region": "eu"},
+		}
+
+		tests = []struct {
+			name             string
+			broker           *testBroker
+			config           *Config
+			want             received
+			wantAcknowledged bool
+			wantErrMsg       string
+		}{
+			{
+				name:   "v311-qos0",
+				broker: &testBroker{},
+				config: &Config{},
+				want:   received{version: Version311, topic: "notify/orders.created"},
+			},
+			{
+				name:             "v311-qos1",
+				broker:           &testBroker{},
+				config:           &Config{QoS: AtLeastOnce},
+				want:             received{version: Version311, topic: "notify/orders.created", qos: AtLeastOnce},
+				wantAcknowledged: true,
+			},
+			{
+				name:             "v311-qos2-retained",
+				broker:           &testBroker{},
+				config:           &Config{QoS: ExactlyOnce, Retain: true},
+				want:             received{version: Version311, topic: "notify/orders.created", qos: ExactlyOnce, retain: true},
+				wantAcknowledged: true,
+			},
+			{
+				name:   "v5-qos0",
+				broker: &testBroker{},
+				config: &Config{Version: Version5, Topic: "devices/{{.Data.device}}/{{.Event}}", MessageExpiry: time.Minute},
+				want: received{
+					version:       Version5,
+					topic:         "devices/d-1/orders.created",
+					contentType:   "application/json",
+					correlation:   "req-1",
+					messageExpiry: 60,
+					user:          [][2]string{{"region", "eu"}, {"tenant", "acme"}},
+				},
+			},
+			{
+				name:   "v5-qos2",
+				broker: &testBroker{},
+				config: &Config{Version: Version5, QoS: ExactlyOnce},
+				want: received{
+					version:     Version5,
+					topic:       "notify/orders.created",
+					qos:         ExactlyOnce,
+					contentType: "application/json",
+					correlation: "req-1",
+					user:        [][2]string{{"region", "eu"}, {"tenant", "acme"}},
+				},
+				wantAcknowledged: true,
+			},
+			{
+				name:       "fail-v5-rejected",
+				broker:     &testBroker{rejectCode: 0x97},
+				config:     &Config{Version: Version5, QoS: AtLeastOnce},
+				wantErrMsg: "publishing rejected by broker: quota exceeded",
+			},
+			{
+				name:       "fail-v5-qos2-rejected",
+				broker:     &testBroker{deny: true},
+				config:     &Config{Version: Version5, QoS: ExactlyOnce},
+				wantErrMsg: "publishing rejected by broker: not authorized",
+			},
+			{
+				name:       "fail-v5-max-qos",
+				broker:     &testBroker{maxQoS: new(QoS)},
+				config:     &Config{Version: Version5, QoS: AtLeastOnce},
+				wantErrMsg: "broker supports QoS up to 0",
+			},
+			{
+				name:       "fail-v5-retain",
+				broker:     &testBroker{noRetain: true},
+				config:     &Config{Version: Version5, Retain: true},
+				wantErrMsg: "broker doesn't support retained messages",
+			},
+			{
+				name:       "fail-timeout",
+				broker:     &testBroker{silent: true},
+				config:     &Config{QoS: AtLeastOnce, Timeout: 100 * time.Millisecond},
+				wantErrMsg: "timed out waiting for acknowledgement",
+			},
+			{
+				name:       "fail-topic",
+				broker:     &testBroker{},
+				config:     &Config{Topic: "notify/{{.Data.missing}}"},
+				wantErrMsg: "rendering topic",
+			},
+			{
+				name:       "fail-topic-invalid",
+				broker:     &testBroker{},
+				config:     &Config{TopicFunc: func(m *model.Notification) (string, error) { return "notify/#", nil }},
+				wantErrMsg: `invalid topic "notify/#"`,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newTestBroker(t, tt.broker)
+
+			tt.config.Address = broker.Address()
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+			defer n.Close()
+
+			r := n.Deliver(message)
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.Equal(t, tt.wantAcknowledged, r.Acknowledged)
+
+			got := waitReceived(t, broker, 1)
+			if !assert.Len(t, got, 1) {
+				return
+			}
+
+			var data model.Notification
+			assert.NoError(t, json.Unmarshal(got[0].payload, &data))
+			assert.Equal(t, "abc", data.ID)
+
+			tt.want.clientID = n.ClientID
+			tt.want.payload = got[0].payload
+			assert.Equal(t, tt.want, got[0])
+		})
+	}
+}
+
+func TestMQTTNotifier_DeliverExactlyOnce(t *testing.T) {
+	var (
+		broker = newTestBroker(t, &testBroker{})
+		n      = New(&Config{Address: broker.Address(), QoS: ExactlyOnce})
+	)
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+	defer n.Close()
+
+	for i := 0; i < 3; i++ {
+		r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+		assert.NoError(t, r.Error)
+		assert.True(t, r.Acknowledged)
+	}
+
+	assert.Len(t, broker.received(), 3)
+	assert.Empty(t, n.waiting)
+}
+
+func TestMQTTNotifier_Reconnect(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{name: "v5-qos1", config: &Config{Version: Version5, QoS: AtLeastOnce, SessionExpiry: time.Minute}},
+		{name: "v5-qos2", config: &Config{Version: Version5, QoS: ExactlyOnce, SessionExpiry: time.Minute}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				buf    bytes.Buffer
+				lock   sync.Mutex
+				errs   []error
+				broker = newTestBroker(t, &testBroker{dropFirst: true})
+			)
+
+			tt.config.Address = broker.Address()
+			tt.config.Timeout = 2 * time.Second
+			tt.config.Logger = log.New(&buf, "", 0)
+			tt.config.Reconnect = &ReconnectOptions{InitialInterval: 10 * time.Millisecond}
+			tt.config.OnError = func(err error) {
+				lock.Lock()
+				defer lock.Unlock()
+				errs = append(errs, err)
+			}
+
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+			defer n.Close()
+
+			// the broker drops the connection, it keeps the session so the
+			// publishing is sent again once reconnected
+			r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Acknowledged)
+
+			got := broker.received()
+			if assert.Len(t, got, 1) {
+				assert.True(t, got[0].dup)
+			}
+
+			r = n.Deliver(&model.Notification{ID: "def", Event: "orders.created"})
+			assert.NoError(t, r.Error)
+			assert.Len(t, broker.received(), 2)
+
+			connections, _ := broker.stats()
+			assert.Equal(t, 2, connections)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if assert.NotEmpty(t, errs) {
+				assert.ErrorContains(t, errs[0], "connection lost")
+			}
+		})
+	}
+
+	// the MQTT 3.1.1 client doesn't follow publishings across connections,
+	// they fail but are sent again in the resumed session
+	t.Run("v311", func(t *testing.T) {
+		var (
+			buf    bytes.Buffer
+			broker = newTestBroker(t, &testBroker{dropFirst: true})
+			n      = New(&Config{
+				Address:   broker.Address(),
+				QoS:       AtLeastOnce,
+				Logger:    log.New(&buf, "", 0),
+				Reconnect: &ReconnectOptions{InitialInterval: 10 * time.Millisecond},
+			})
+		)
+
+		if !assert.NoError(t, n.Connect()) {
+			return
+		}
+		defer n.Close()
+
+		r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+		assert.ErrorContains(t, r.Error, "connection lost")
+
+		got := waitReceived(t, broker, 1)
+		if assert.Len(t, got, 1) {
+			assert.True(t, got[0].dup)
+		}
+
+		r = n.Deliver(&model.Notification{ID: "def", Event: "orders.created"})
+		assert.NoError(t, r.Error)
+		assert.Len(t, broker.received(), 2)
+	})
+}
+
+func TestMQTTNotifier_SessionNotResumed(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		broker     *testBroker
+		wantErrMsg string
+	}{
+		{
+			name:       "v311",
+			config:     &Config{Version: Version311},
+			broker:     &testBroker{dropTaken: true, forgetSessions: true},
+			wantErrMsg: "connection lost",
+		},
+		{
+			name:       "v311-clean",
+			config:     &Config{Version: Version311, CleanSession: true},
+			broker:     &testBroker{dropTaken: true},
+			wantErrMsg: "connection lost",
+		},
+		{
+			name:       "v5",
+			config:     &Config{Version: Version5, SessionExpiry: time.Minute},
+			broker:     &testBroker{dropTaken: true, forgetSessions: true},
+			wantErrMsg: "session not resumed",
+		},
+		{
+			name:       "v5-release",
+			config:     &Config{Version: Version5, SessionExpiry: time.Minute},
+			broker:     &testBroker{dropRelease: true, forgetSessions: true},
+			wantErrMsg: "session not resumed",
+		},
+		{
+			name:       "v5-clean",
+			config:     &Config{Version: Version5, CleanSession: true},
+			broker:     &testBroker{dropTaken: true},
+			wantErrMsg: "connection lost",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				buf    bytes.Buffer
+				broker = newTestBroker(t, tt.broker)
+			)
+
+			tt.config.Address = broker.Address()
+			tt.config.QoS = ExactlyOnce
+			tt.config.Timeout = 2 * time.Second
+			tt.config.Logger = log.New(&buf, "", 0)
+			tt.config.Reconnect = &ReconnectOptions{InitialInterval: 10 * time.Millisecond}
+
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+			defer n.Close()
+
+			// the broker took the publishing but the new session doesn't know
+			// it, sending it again would deliver it twice
+			r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+			assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+
+			waitConnected(t, n)
+
+			r = n.Deliver(&model.Notification{ID: "def", Event: "orders.created"})
+			assert.NoError(t, r.Error)
+
+			got := broker.received()
+			if assert.Len(t, got, 2) {
+				assert.False(t, got[0].dup)
+				assert.False(t, got[1].dup)
+			}
+		})
+	}
+}
+
+func TestMQTTNotifier_ConnectionLost(t *testing.T) {
+	for _, version := range []Version{Version311, Version5} {
+		version := version
+		t.Run(map[Version]string{Version311: "v311", Version5: "v5"}[version], func(t *testing.T) {
+			var (
+				buf    bytes.Buffer
+				broker = newTestBroker(t, &testBroker{dropFirst: true})
+				n      = New(&Config{Address: broker.Address(), Version: version, QoS: AtLeastOnce, Logger: log.New(&buf, "", 0)})
+			)
+
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+			defer n.Close()
+
+			r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+			assert.ErrorContains(t, r.Error, "connection lost")
+
+			r = n.Deliver(&model.Notification{ID: "def", Event: "orders.created"})
+			assert.ErrorIs(t, r.Error, ErrNotConnected)
+			assert.Contains(t, buf.String(), "connection lost")
+		})
+	}
+}
+
+func TestMQTTNotifier_KeepAlive(t *testing.T) {
+	for _, version := range []Version{Version311, Version5} {
+		version := version
+		t.Run(map[Version]string{Version311: "v311", Version5: "v5"}[version], func(t *testing.T) {
+			// keep alive is in whole seconds, mochi-mqtt drops clients silent
+			// for one and a half of them rounded down
+			var (
+				broker = newTestBroker(t, &testBroker{})
+				n      = New(&Config{Address: broker.Address(), Version: version, KeepAlive: 2 * time.Second})
+			)
+
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			assert.Eventually(t, func() bool {
+				_, pings := broker.stats()
+				return pings >= 1
+			}, 4*time.Second, 50*time.Millisecond)
+
+			assert.NoError(t, n.Close())
+			assert.ErrorIs(t, n.Deliver(&model.Notification{Event: "orders.created"}).Error, ErrNotConnected)
+		})
+	}
+}
+
+func TestMQTTNotifier_Run(t *testing.T) {
+	var (
+		broker = newTestBroker(t, &testBroker{})
+		n      = New(&Config{Address: broker.Address(), QoS: AtLeastOnce})
+		done   = make(chan struct{})
+	)
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+	defer n.Close()
+
+	go func() {
+		n.Run()
+		close(done)
+	}()
+
+	n.Notify(&model.Notification{ID: "abc", Event: "orders.created"})
+	n.Notify(&model.Notification{ID: "def", Event: "orders.shipped"})
+	close(n.Channel)
+	<-done
+
+	var topics []string
+	for _, m := range broker.received() {
+		topics = append(topics, m.topic)
+	}
+
+	assert.Equal(t, []string{"notify/orders.created", "notify/orders.shipped"}, topics)
+}
+
+// waitReceived waits for QoS 0 publishings to reach the broker
+func waitReceived(t *testing.T, broker *testBroker, count int) []received {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		return len(broker.received()) >= count
+	}, time.Second, 5*time.Millisecond)
+
+	return broker.received()
+}
+
+// waitConnected waits for n to recover the connection
+func waitConnected(t *testing.T, n *MQTTNotifier) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		n.lock.Lock()
+		defer n.lock.Unlock()
+
+		return n.conn != nil
+	}, time.Second, 5*time.Millisecond)
+}
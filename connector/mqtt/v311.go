@@ -0,0 +1,183 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	paho311 "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// v311Connection publishes with the Eclipse Paho MQTT 3.1.1 client. A client
+// is created for every connection, they share the store so the publishings
+// left unacknowledged are sent again when the session is resumed
+type v311Connection struct {
+	*link
+	client  paho311.Client
+	timeout time.Duration
+	store   *sessionStore
+}
+
+// sessionStore keeps the unacknowledged publishings of the MQTT 3.1.1
+// clients. The client sends them again on connecting without CleanSession,
+// the store drops them instead when the broker started a new session
+type sessionStore struct {
+	*paho311.MemoryStore
+
+	lock sync.Mutex
+	// present is nil until the CONNACK is read
+	present *bool
+}
+
+func (s *sessionStore) connecting() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.present = nil
+}
+
+func (s *sessionStore) connected(present bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.present = &present
+}
+
+func (s *sessionStore) resumed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.present != nil && *s.present
+}
+
+func (s *sessionStore) All() []string {
+	s.lock.Lock()
+	dropped := s.present != nil && !*s.present
+	s.lock.Unlock()
+
+	if dropped {
+		s.Reset()
+		return nil
+	}
+
+	return s.MemoryStore.All()
+}
+
+// connackConn reads the session present flag from the CONNACK, the first
+// packet sent by the broker: type, remaining length, flags and return code
+type connackConn struct {
+	net.Conn
+	store  *sessionStore
+	header []byte
+}
+
+func (c *connackConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	if missing := 4 - len(c.header); missing > 0 {
+		if n < missing {
+			missing = n
+		}
+
+		c.header = append(c.header, b[:missing]...)
+		if len(c.header) == 4 && c.header[0] == packets.Connack<<4 && c.header[3] == packets.Accepted {
+			c.store.connected(c.header[2]&0x01 == 1)
+		}
+	}
+
+	return n, err
+}
+
+func (n *MQTTNotifier) openV311() (connection, error) {
+	username, password, err := n.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		c       = &v311Connection{link: newLink(), timeout: n.Timeout, store: n.store}
+		openErr error
+	)
+
+	options := paho311.NewClientOptions().
+		AddBroker("tcp://" + n.Address).
+		SetClientID(n.ClientID).
+		SetProtocolVersion(uint(Version311)).
+		SetCleanSession(n.CleanSession).
+		SetUsername(username).
+		SetPassword(password).
+		SetKeepAlive(n.KeepAlive).
+		SetPingTimeout(n.Timeout).
+		SetConnectTimeout(n.Timeout).
+		SetWriteTimeout(n.Timeout).
+		SetAutoReconnect(false).
+		SetStore(n.store).
+		SetCustomOpenConnectionFn(func(*url.URL, paho311.ClientOptions) (net.Conn, error) {
+			conn, err := n.open()
+			if err != nil {
+				openErr = err
+				return nil, err
+			}
+
+			return &connackConn{Conn: conn, store: n.store}, nil
+		}).
+		SetConnectionLostHandler(func(_ paho311.Client, err error) {
+			c.fail(err)
+			n.lost(c, err)
+		})
+
+	c.client = paho311.NewClient(options)
+	n.store.connecting()
+
+	token := c.client.Connect()
+	token.Wait()
+
+	if err := token.Error(); err != nil {
+		if openErr != nil {
+			return nil, openErr
+		}
+
+		if code := token.(*paho311.ConnectToken).ReturnCode(); code != packets.Accepted && code != packets.ErrNetworkError {
+			return nil, fmt.Errorf("connection refused: %s", reasonText(returnCodeNames, code, ""))
+		}
+
+		return nil, fmt.Errorf("connecting to MQTT broker: %w", err)
+	}
+
+	return c, nil
+}
+
+// check lets the broker decide, MQTT 3.1.1 brokers don't announce limits
+func (c *v311Connection) check(*publish) error {
+	return nil
+}
+
+func (c *v311Connection) publish(ctx context.Context, p *publish) error {
+	token := c.client.Publish(p.topic, byte(p.qos), p.retain, p.payload)
+
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("publishing message: %w", err)
+	}
+
+	return nil
+}
+
+func (c *v311Connection) resumed() bool {
+	return c.store.resumed()
+}
+
+func (c *v311Connection) disconnect() error {
+	c.client.Disconnect(uint(c.timeout / time.Millisecond))
+
+	return nil
+}
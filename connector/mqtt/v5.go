@@ -0,0 +1,162 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// v5Connection publishes with the Eclipse Paho MQTT 5 client. A client is
+// created for every connection, they share the session state so the
+// publishings left unacknowledged are sent again when the session is resumed
+type v5Connection struct {
+	*link
+	client        *paho.Client
+	maxQoS        QoS
+	retain        bool
+	maxPacketSize uint32
+	// sessionPresent is set in the CONNACK when the session is resumed, the
+	// client discards the unacknowledged publishings otherwise
+	sessionPresent bool
+}
+
+func (n *MQTTNotifier) openV5() (connection, error) {
+	username, password, err := n.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &v5Connection{link: newLink(), maxQoS: ExactlyOnce, retain: true}
+	lost := func(err error) {
+		c.fail(err)
+		n.lost(c, err)
+	}
+
+	c.client = paho.NewClient(paho.ClientConfig{
+		ClientID:      n.ClientID,
+		Conn:          packets.NewThreadSafeConn(conn),
+		Session:       n.session,
+		PacketTimeout: n.Timeout,
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			var reason string
+			if d.Properties != nil {
+				reason = d.Properties.ReasonString
+			}
+
+			lost(fmt.Errorf("disconnected by broker: %s", reasonText(reasonNames, d.ReasonCode, reason)))
+		},
+		OnClientError: lost,
+	})
+
+	connect := &paho.Connect{
+		ClientID:     n.ClientID,
+		KeepAlive:    uint16(n.KeepAlive / time.Second),
+		CleanStart:   n.CleanSession,
+		Username:     username,
+		UsernameFlag: username != "",
+		Password:     []byte(password),
+		PasswordFlag: password != "",
+	}
+
+	if n.SessionExpiry > 0 {
+		expiry := uint32(n.SessionExpiry / time.Second)
+		connect.Properties = &paho.ConnectProperties{SessionExpiryInterval: &expiry}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	connack, err := c.client.Connect(ctx, connect)
+	if connack != nil && connack.ReasonCode >= 0x80 {
+		var reason string
+		if connack.Properties != nil {
+			reason = connack.Properties.ReasonString
+		}
+
+		return nil, fmt.Errorf("connection refused: %s", reasonText(reasonNames, connack.ReasonCode, reason))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("connecting to MQTT broker: %w", err)
+	}
+
+	c.sessionPresent = connack.SessionPresent
+
+	if props := connack.Properties; props != nil {
+		if props.MaximumQoS != nil {
+			c.maxQoS = QoS(*props.MaximumQoS)
+		}
+
+		if props.MaximumPacketSize != nil {
+			c.maxPacketSize = *props.MaximumPacketSize
+		}
+
+		c.retain = props.RetainAvailable
+	}
+
+	return c, nil
+}
+
+// check applies the limits announced by the broker
+func (c *v5Connection) check(p *publish) error {
+	if p.qos > c.maxQoS {
+		return fmt.Errorf("broker supports QoS up to %d", c.maxQoS)
+	}
+
+	if p.retain && !c.retain {
+		return errors.New("broker doesn't support retained messages")
+	}
+
+	return nil
+}
+
+func (c *v5Connection) publish(ctx context.Context, p *publish) error {
+	pub := &paho.Publish{
+		QoS:        byte(p.qos),
+		Retain:     p.retain,
+		Topic:      p.topic,
+		Properties: p.properties,
+		Payload:    p.payload,
+	}
+
+	if c.maxPacketSize > 0 {
+		if size, _ := pub.Packet().WriteTo(io.Discard); size > int64(c.maxPacketSize) {
+			return fmt.Errorf("message exceeds the maximum packet size of %d bytes", c.maxPacketSize)
+		}
+	}
+
+	// a PUBREC or PUBCOMP with an error reason code isn't returned as an error
+	response, err := c.client.Publish(ctx, pub)
+	if response != nil && response.ReasonCode >= 0x80 {
+		var reason string
+		if response.Properties != nil {
+			reason = response.Properties.ReasonString
+		}
+
+		return fmt.Errorf("publishing rejected by broker: %s", reasonText(reasonNames, response.ReasonCode, reason))
+	}
+
+	if err != nil {
+		return fmt.Errorf("publishing message: %w", err)
+	}
+
+	return nil
+}
+
+func (c *v5Connection) resumed() bool {
+	return c.sessionPresent
+}
+
+func (c *v5Connection) disconnect() error {
+	return c.client.Disconnect(&paho.Disconnect{})
+}
@@ -0,0 +1,240 @@
+package msteams
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+const cardSchema = "http://adaptivecards.io/schemas/adaptive-card.json"
+
+// Template holds the templates rendered against a notification to build its
+// Adaptive Card
+type Template struct {
+	// Body renders a JSON array of card elements, the json function quotes
+	// values, e.g. [{"type": "TextBlock", "text": {{json .Data.summary}}, "wrap": true}]
+	Body string
+	// Actions are buttons opening a URL
+	Actions []Action
+	// Mentions notify users, those not mentioned in the body with
+	// <at>Name</at> are mentioned in a text block added at the end
+	Mentions []Mention
+}
+
+// Action is an Action.OpenUrl button, URL can be a template
+type Action struct {
+	Title string
+	URL   string
+}
+
+// Mention is a user mentioned in the card, both fields can be templates
+type Mention struct {
+	// Name is the text shown for the mention
+	Name string
+	// ID is the Microsoft Entra object ID or the user principal name
+	ID string
+}
+
+// template is a parsed Template
+type template struct {
+	body     *utils.Template
+	actions  []action
+	mentions []mention
+}
+
+type action struct {
+	title string
+	url   *utils.Template
+}
+
+type mention struct {
+	name *utils.Template
+	id   *utils.Template
+}
+
+// teamsMessage is the payload of workflow and incoming webhooks
+type teamsMessage struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	ContentType string  `json:"contentType"`
+	ContentURL  *string `json:"contentUrl"`
+	Content     *card   `json:"content"`
+}
+
+type card struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []json.RawMessage `json:"body"`
+	Actions []cardAction      `json:"actions,omitempty"`
+	MSTeams *cardTeams        `json:"msteams,omitempty"`
+}
+
+type cardAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type cardTeams struct {
+	Width    string   `json:"width,omitempty"`
+	Entities []entity `json:"entities,omitempty"`
+}
+
+type entity struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text"`
+	Mentioned mentioned `json:"mentioned"`
+}
+
+type mentioned struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (t *Template) parse(name string) (*template, error) {
+	var (
+		result = &template{}
+		err    error
+	)
+
+	if result.body, err = utils.ParseTemplate(name+".body", t.Body); err != nil {
+		return nil, fmt.Errorf("parsing %s body template: %w", name, err)
+	}
+
+	for i, a := range t.Actions {
+		url, err := utils.ParseTemplate(fmt.Sprintf("%s.actions[%d]", name, i), a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s action %s template: %w", name, a.Title, err)
+		}
+
+		result.actions = append(result.actions, action{title: a.Title, url: url})
+	}
+
+	for i, m := range t.Mentions {
+		var parsed mention
+
+		if parsed.name, err = utils.ParseTemplate(fmt.Sprintf("%s.mentions[%d].name", name, i), m.Name); err != nil {
+			return nil, fmt.Errorf("parsing %s mention template: %w", name, err)
+		}
+
+		if parsed.id, err = utils.ParseTemplate(fmt.Sprintf("%s.mentions[%d].id", name, i), m.ID); err != nil {
+			return nil, fmt.Errorf("parsing %s mention template: %w", name, err)
+		}
+
+		result.mentions = append(result.mentions, parsed)
+	}
+
+	return result, nil
+}
+
+// render builds the body, actions and mentions of the card
+func (t *template) render(message *model.Notification, c *card) error {
+	body, err := t.body.Render(message)
+	if err != nil {
+		return fmt.Errorf("rendering body: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(body), &c.Body); err != nil {
+		return fmt.Errorf("body isn't a JSON array: %w", err)
+	}
+
+	for _, a := range t.actions {
+		url, err := a.url.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering action %s: %w", a.title, err)
+		}
+
+		c.Actions = append(c.Actions, cardAction{Type: "Action.OpenUrl", Title: a.title, URL: url})
+	}
+
+	var missing []string
+	for _, m := range t.mentions {
+		name, err := m.name.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering mention: %w", err)
+		}
+
+		id, err := m.id.Render(message)
+		if err != nil {
+			return fmt.Errorf("rendering mention: %w", err)
+		}
+
+		text := "<at>" + name + "</at>"
+		if !strings.Contains(body, text) {
+			missing = append(missing, text)
+		}
+
+		if c.MSTeams == nil {
+			c.MSTeams = &cardTeams{}
+		}
+
+		c.MSTeams.Entities = append(c.MSTeams.Entities, entity{
+			Type:      "mention",
+			Text:      text,
+			Mentioned: mentioned{ID: id, Name: name},
+		})
+	}
+
+	// Teams only notifies the users mentioned in the text of the card
+	if len(missing) > 0 {
+		block, err := json.Marshal(map[string]any{"type": "TextBlock", "text": strings.Join(missing, " "), "wrap": true})
+		if err != nil {
+			return err
+		}
+
+		c.Body = append(c.Body, block)
+	}
+
+	return nil
+}
+
+// card builds the card of the notification with the template of its event,
+// the data is shown as JSON if there is none
+func (n *MSTeamsNotifier) card(message *model.Notification) (*card, error) {
+	c := &card{Schema: cardSchema, Type: "AdaptiveCard", Version: n.CardVersion, Body: []json.RawMessage{}}
+
+	t, ok := n.templates[message.Event]
+	if !ok {
+		t = n.fallback
+	}
+
+	if t != nil {
+		if err := t.render(message, c); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := n.jsonMarshal(message.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range []map[string]any{
+			{"type": "TextBlock", "text": string(message.Event), "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "TextBlock", "text": string(data), "fontType": "Monospace", "wrap": true},
+		} {
+			raw, err := json.Marshal(block)
+			if err != nil {
+				return nil, err
+			}
+
+			c.Body = append(c.Body, raw)
+		}
+	}
+
+	if n.FullWidth {
+		if c.MSTeams == nil {
+			c.MSTeams = &cardTeams{}
+		}
+
+		c.MSTeams.Width = "Full"
+	}
+
+	return c, nil
+}
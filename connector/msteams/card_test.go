@@ -0,0 +1,139 @@
+package msteams
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/padiazg/notifier/connector/webhook"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMSTeamsNotifier_card(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:    "abc",
+			Event: "orders.created",
+			Data:  map[string]any{"customer": "Alice \"A\"", "owner": "bob@example.com"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			marshal    func(v any) ([]byte, error)
+			want       string
+			wantErrMsg string
+		}{
+			{
+				name: "event-template",
+				config: &Config{
+					Templates: map[model.EventType]*Template{
+						"orders.created": {
+							Body:    `[{"type": "TextBlock", "text": {{json .Data.customer}}}]`,
+							Actions: []Action{{Title: "Open", URL: "https://example.com/orders/{{.ID}}"}},
+						},
+					},
+					Default: &Template{Body: `[]`},
+				},
+				want: `{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json", "type": "AdaptiveCard", "version": "1.4",
+					"body": [{"type": "TextBlock", "text": "Alice \"A\""}],
+					"actions": [{"type": "Action.OpenUrl", "title": "Open", "url": "https://example.com/orders/abc"}]
+				}`,
+			},
+			{
+				name: "mentions",
+				config: &Config{
+					Default: &Template{
+						Body:     `[{"type": "TextBlock", "text": "Hi <at>Alice</at>"}]`,
+						Mentions: []Mention{{Name: "Alice", ID: "alice@example.com"}, {Name: "Bob", ID: "{{.Data.owner}}"}},
+					},
+					CardVersion: "1.5",
+					FullWidth:   true,
+				},
+				want: `{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json", "type": "AdaptiveCard", "version": "1.5",
+					"body": [
+						{"type": "TextBlock", "text": "Hi <at>Alice</at>"},
+						{"type": "TextBlock", "text": "<at>Bob</at>", "wrap": true}
+					],
+					"msteams": {
+						"width": "Full",
+						"entities": [
+							{"type": "mention", "text": "<at>Alice</at>", "mentioned": {"id": "alice@example.com", "name": "Alice"}},
+							{"type": "mention", "text": "<at>Bob</at>", "mentioned": {"id": "bob@example.com", "name": "Bob"}}
+						]
+					}
+				}`,
+			},
+			{
+				name:    "json",
+				config:  &Config{},
+				marshal: func(v any) ([]byte, error) { return []byte("test-json"), nil },
+				want: `{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json", "type": "AdaptiveCard", "version": "1.4",
+					"body": [
+						{"type": "TextBlock", "text": "orders.created", "weight": "Bolder", "size": "Medium", "wrap": true},
+						{"type": "TextBlock", "text": "test-json", "fontType": "Monospace", "wrap": true}
+					]
+				}`,
+			},
+			{
+				name:       "fail-json",
+				config:     &Config{},
+				marshal:    func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+				wantErrMsg: "test-Marshal-error",
+			},
+			{
+				name:       "fail-body",
+				config:     &Config{Default: &Template{Body: `[{{json .Data.region}}]`}},
+				wantErrMsg: "rendering body",
+			},
+			{
+				name:       "fail-body-array",
+				config:     &Config{Default: &Template{Body: `{"type": "TextBlock"}`}},
+				wantErrMsg: "body isn't a JSON array",
+			},
+			{
+				name:       "fail-action",
+				config:     &Config{Default: &Template{Body: `[]`, Actions: []Action{{Title: "Open", URL: "{{.Data.region}}"}}}},
+				wantErrMsg: "rendering action Open",
+			},
+			{
+				name:       "fail-mention",
+				config:     &Config{Default: &Template{Body: `[]`, Mentions: []Mention{{Name: "Alice", ID: "{{.Data.region}}"}}}},
+				wantErrMsg: "rendering mention",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Config = webhook.Config{Endpoint: "https://example.webhook.office.com/webhookb2/test"}
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			got, err := n.card(message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(data))
+		})
+	}
+}
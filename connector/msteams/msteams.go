@@ -0,0 +1,175 @@
+package msteams
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/padiazg/notifier/connector/webhook"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+type Config struct {
+	// Config sets the requests like for the webhook connector, Endpoint is
+	// the workflow or incoming webhook URL
+	webhook.Config
+	// Templates maps event types to the template of their cards
+	Templates map[model.EventType]*Template
+	// Default is the template of events not in Templates, if not set the card
+	// holds the notification data as JSON
+	Default *Template
+	// CardVersion is the Adaptive Card schema version, 1.4 if not set
+	CardVersion string
+	// FullWidth stretches cards to the width of the conversation
+	FullWidth bool
+}
+
+type MSTeamsNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	webhook     *webhook.WebhookNotifier
+	templates   map[model.EventType]*template
+	fallback    *template
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+}
+
+var _ model.Notifier = (*MSTeamsNotifier)(nil)
+
+func New(config *Config) *MSTeamsNotifier {
+	return (&MSTeamsNotifier{}).New(config)
+}
+
+func (n *MSTeamsNotifier) New(config *Config) *MSTeamsNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.CardVersion == "" {
+		config.CardVersion = "1.4"
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.webhook = webhook.New(&config.Config)
+	n.jsonMarshal = json.Marshal
+	n.configErr = n.parseTemplates()
+
+	return n
+}
+
+func (n *MSTeamsNotifier) parseTemplates() error {
+	var err error
+
+	n.templates = make(map[model.EventType]*template, len(n.Templates))
+	for event, t := range n.Templates {
+		if n.templates[event], err = t.parse(string(event)); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if n.fallback, err = n.Default.parse("default"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *MSTeamsNotifier) Type() string {
+	return "msteams"
+}
+
+func (n *MSTeamsNotifier) Name() string {
+	return n.Config.Name
+}
+
+func (n *MSTeamsNotifier) Connect() error {
+	if n.configErr != nil {
+		return n.configErr
+	}
+
+	return n.webhook.Connect()
+}
+
+func (n *MSTeamsNotifier) Close() error {
+	return n.webhook.Close()
+}
+
+// Run starts receiving notifications
+func (n *MSTeamsNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *MSTeamsNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *MSTeamsNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver posts the card of a notification to the webhook
+func (n *MSTeamsNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	c, err := n.card(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	payload, err := n.jsonMarshal(&teamsMessage{
+		Type: "message",
+		Attachments: []attachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     c,
+		}},
+	})
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("encoding card: %w", err)}
+	}
+
+	resp, err := n.webhook.Request(message, payload)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+	defer resp.Body.Close()
+
+	// workflows answer 202 Accepted, incoming webhooks 200 OK
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return &model.Result{Success: false, Error: fmt.Errorf("webhook returned non-OK status: %d", resp.StatusCode)}
+	}
+
+	return &model.Result{Success: true}
+}
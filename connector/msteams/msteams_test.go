@@ -0,0 +1,161 @@
+package msteams
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/padiazg/notifier/connector/webhook"
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMSTeamsNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "success",
+			config: &Config{Config: webhook.Config{Endpoint: "https://example.webhook.office.com/webhookb2/test"}},
+		},
+		{
+			name:       "fail-endpoint",
+			config:     &Config{Config: webhook.Config{Endpoint: "https://{{.Data.tenant"}},
+			wantErrMsg: "parsing endpoint template",
+		},
+		{
+			name: "fail-template",
+			config: &Config{
+				Config:    webhook.Config{Endpoint: "https://example.webhook.office.com/webhookb2/test"},
+				Templates: map[model.EventType]*Template{"test": {Body: "[{{.Event"}},
+			},
+			wantErrMsg: "parsing test body template",
+		},
+		{
+			name: "fail-action",
+			config: &Config{
+				Config:  webhook.Config{Endpoint: "https://example.webhook.office.com/webhookb2/test"},
+				Default: &Template{Body: "[]", Actions: []Action{{Title: "Open", URL: "{{.ID"}}},
+			},
+			wantErrMsg: "parsing default action Open template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^msteams[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "msteams", n.Type())
+			assert.Equal(t, "1.4", n.CardVersion)
+			assert.NotNil(t, n.GetChannel())
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestMSTeamsNotifier_Deliver(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		headers    map[string]string
+		marshal    func(v any) ([]byte, error)
+		wantErrMsg string
+	}{
+		{
+			name:   "workflow",
+			status: http.StatusAccepted,
+		},
+		{
+			name:    "incoming-webhook",
+			status:  http.StatusOK,
+			headers: map[string]string{"X-Test": "test"},
+		},
+		{
+			name:       "fail-status",
+			status:     http.StatusBadRequest,
+			wantErrMsg: "webhook returned non-OK status: 400",
+		},
+		{
+			name:       "fail-marshal",
+			status:     http.StatusOK,
+			marshal:    func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+			wantErrMsg: "test-Marshal-error",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				request *http.Request
+				body    map[string]any
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(data, &body)
+				request = r
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			n := New(&Config{
+				Config:  webhook.Config{Endpoint: server.URL + "/workflows/test", Headers: tt.headers},
+				Default: &Template{Body: `[{"type": "TextBlock", "text": {{json .Data.summary}}}]`},
+			})
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			r := n.Deliver(&model.Notification{Event: "orders.created", Data: map[string]any{"summary": "new order"}})
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			if !assert.NoError(t, r.Error) {
+				return
+			}
+
+			assert.True(t, r.Success)
+			assert.Equal(t, "/workflows/test", request.URL.Path)
+			assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+
+			for k, v := range tt.headers {
+				assert.Equal(t, v, request.Header.Get(k))
+			}
+
+			assert.Equal(t, map[string]any{
+				"type": "message",
+				"attachments": []any{map[string]any{
+					"contentType": "application/vnd.microsoft.card.adaptive",
+					"contentUrl":  nil,
+					"content": map[string]any{
+						"$schema": cardSchema,
+						"type":    "AdaptiveCard",
+						"version": "1.4",
+						"body":    []any{map[string]any{"type": "TextBlock", "text": "new order"}},
+					},
+				}},
+			}, body)
+		})
+	}
+}
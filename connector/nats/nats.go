@@ -0,0 +1,353 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+const defaultSubject = "notify.{{.Event}}"
+
+// SubjectFunc derives the subject of a notification
+type SubjectFunc func(message *model.Notification) (string, error)
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// URL is the server address, a comma separated list for a cluster
+	URL string
+	// Subject is where notifications are published, it can be a template,
+	// notify.{{.Event}} if not set so orders.created is published to
+	// notify.orders.created
+	Subject string
+	// SubjectFunc derives the subject of each notification, overrides Subject
+	SubjectFunc SubjectFunc
+	// JetStream publishes to a stream, deliveries succeed once the stream
+	// acknowledges them. The notification ID is sent as Nats-Msg-Id so the
+	// stream drops duplicates
+	JetStream bool
+	// Stream is the stream expected to store the notifications, optional
+	Stream string
+	// AckTimeout limits the wait for JetStream acknowledgements and the
+	// connection, 5 seconds if not set
+	AckTimeout time.Duration
+	// Compression compresses payloads, the encoding is sent in the
+	// Content-Encoding header
+	Compression *utils.Compression
+	// SASL sets the username and password, only PLAIN is supported
+	SASL *utils.SASL
+	// Token authenticates with a token instead
+	Token utils.Secret
+	// TLS configures encrypted connections
+	TLS *utils.TLSOptions
+	// Options are passed to nats.Connect after the ones built from the Config
+	Options []nats.Option
+}
+
+type NATSNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	conn        *nats.Conn
+	js          jetstream.JetStream
+	subject     SubjectFunc
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+}
+
+var _ model.Notifier = (*NATSNotifier)(nil)
+
+func New(config *Config) *NATSNotifier {
+	return (&NATSNotifier{}).New(config)
+}
+
+func (n *NATSNotifier) New(config *Config) *NATSNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.URL == "" {
+		config.URL = nats.DefaultURL
+	}
+
+	if config.Subject == "" {
+		config.Subject = defaultSubject
+	}
+
+	if config.AckTimeout == 0 {
+		config.AckTimeout = 5 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.Marshal
+	n.subject, n.configErr = newSubjectFunc(config)
+
+	return n
+}
+
+// newSubjectFunc returns the function deriving subjects, a SubjectFunc takes
+// precedence over the Subject
+func newSubjectFunc(config *Config) (SubjectFunc, error) {
+	if config.SubjectFunc != nil {
+		return config.SubjectFunc, nil
+	}
+
+	if !utils.IsTemplate(config.Subject) {
+		subject := config.Subject
+		return func(*model.Notification) (string, error) { return subject, nil }, nil
+	}
+
+	tpl, err := utils.ParseTemplate("subject", config.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("parsing subject template: %w", err)
+	}
+
+	return func(message *model.Notification) (string, error) {
+		return tpl.Render(message)
+	}, nil
+}
+
+func (n *NATSNotifier) Type() string {
+	return "nats"
+}
+
+func (n *NATSNotifier) Name() string {
+	return n.Config.Name
+}
+
+// Connect connects to the server and checks JetStream is enabled when used
+func (n *NATSNotifier) Connect() error {
+	if n.configErr != nil {
+		return n.configErr
+	}
+
+	options, err := n.options()
+	if err != nil {
+		return err
+	}
+
+	conn, err := nats.Connect(n.URL, options...)
+	if err != nil {
+		return fmt.Errorf("connecting to NATS: %w", err)
+	}
+
+	if n.JetStream {
+		js, err := n.jetStream(conn)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+
+		n.js = js
+	}
+
+	n.conn = conn
+
+	return nil
+}
+
+// jetStream returns the JetStream context, asking the server for the account
+// information to check JetStream is enabled
+func (n *NATSNotifier) jetStream(conn *nats.Conn) (jetstream.JetStream, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("getting JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.AckTimeout)
+	defer cancel()
+
+	if _, err := js.AccountInfo(ctx); err != nil {
+		return nil, fmt.Errorf("getting JetStream account information: %w", err)
+	}
+
+	return js, nil
+}
+
+// options builds the connection options
+func (n *NATSNotifier) options() ([]nats.Option, error) {
+	options := []nats.Option{nats.Name(n.Name()), nats.Timeout(n.AckTimeout)}
+
+	if n.SASL != nil {
+		mechanism, username, password, err := n.SASL.Credentials()
+		if err != nil {
+			return nil, fmt.Errorf("resolving credentials: %w", err)
+		}
+
+		if mechanism != utils.SASLPlain {
+			return nil, fmt.Errorf("unsupported SASL mechanism %s", mechanism)
+		}
+
+		options = append(options, nats.UserInfo(username, password))
+	}
+
+	token, err := n.Token.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolving token: %w", err)
+	}
+
+	if token != "" {
+		options = append(options, nats.Token(token))
+	}
+
+	tlsConfig, err := n.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	if tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
+	return append(options, n.Options...), nil
+}
+
+// Close flushes the pending messages and closes the connection
+func (n *NATSNotifier) Close() error {
+	if n.conn == nil {
+		return nil
+	}
+
+	err := n.conn.FlushTimeout(n.AckTimeout)
+	n.conn.Close()
+
+	if err != nil && err != nats.ErrConnectionClosed {
+		return fmt.Errorf("flushing messages: %w", err)
+	}
+
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *NATSNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *NATSNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *NATSNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver publishes a notification, with JetStream it waits for the stream
+// to acknowledge it
+func (n *NATSNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	if n.conn == nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("not connected")}
+	}
+
+	msg, err := n.message(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	if !n.JetStream {
+		if err := n.conn.PublishMsg(msg); err != nil {
+			return &model.Result{Success: false, Error: fmt.Errorf("publishing message: %w", err)}
+		}
+
+		return &model.Result{Success: true}
+	}
+
+	var options []jetstream.PublishOpt
+	if message.ID != "" {
+		options = append(options, jetstream.WithMsgID(message.ID))
+	}
+
+	if n.Stream != "" {
+		options = append(options, jetstream.WithExpectStream(n.Stream))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.AckTimeout)
+	defer cancel()
+
+	if _, err := n.js.PublishMsg(ctx, msg, options...); err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("publishing to JetStream: %w", err)}
+	}
+
+	// duplicates are acknowledged too, the stream already holds the notification
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+// message builds the message of the notification, the metadata is sent as
+// headers
+func (n *NATSNotifier) message(message *model.Notification) (*nats.Msg, error) {
+	subject, err := n.subject(message)
+	if err != nil {
+		return nil, fmt.Errorf("rendering subject: %w", err)
+	}
+
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid subject %q", subject)
+	}
+
+	payload, err := n.jsonMarshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, encoding, err := n.Compression.Compress(payload)
+	if err != nil {
+		return nil, fmt.Errorf("compressing payload: %w", err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = payload
+
+	keys := make([]string, 0, len(message.Metadata))
+	for k := range message.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		msg.Header.Set(k, message.Metadata[k])
+	}
+
+	if encoding != "" {
+		msg.Header.Set("Content-Encoding", encoding)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,305 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNATSNotifier_New(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		wantSubject string
+		wantErrMsg  string
+	}{
+		{
+			name:        "default-subject",
+			config:      &Config{},
+			wantSubject: "notify.orders.created",
+		},
+		{
+			name:        "subject-template",
+			config:      &Config{Subject: "events.{{.Data.tenant}}.{{.Event}}"},
+			wantSubject: "events.acme.orders.created",
+		},
+		{
+			name:        "subject-func",
+			config:      &Config{Subject: "ignored", SubjectFunc: func(m *model.Notification) (string, error) { return "custom", nil }},
+			wantSubject: "custom",
+		},
+		{
+			name:       "fail-subject",
+			config:     &Config{Subject: "{{.Event"},
+			wantErrMsg: "parsing subject template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^nats[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "nats", n.Type())
+			assert.Equal(t, "nats://127.0.0.1:4222", n.URL)
+			assert.Equal(t, 5*time.Second, n.AckTimeout)
+			assert.NotNil(t, n.GetChannel())
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, n.Connect(), tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			subject, err := n.subject(&model.Notification{Event: "orders.created", Data: map[string]any{"tenant": "acme"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSubject, subject)
+		})
+	}
+}
+
+func TestNATSNotifier_Connect(t *testing.T) {
+	tests := []struct {
+		name       string
+		jetStream  bool
+		token      string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "core",
+			config: &Config{},
+		},
+		{
+			name:      "jetstream",
+			jetStream: true,
+			config:    &Config{JetStream: true},
+		},
+		{
+			name:   "token",
+			token:  "s3cr3t",
+			config: &Config{Token: utils.Secret{Value: "s3cr3t"}},
+		},
+		{
+			name:       "fail-token",
+			token:      "s3cr3t",
+			config:     &Config{Token: utils.Secret{Value: "wrong"}},
+			wantErrMsg: "connecting to NATS: nats: Authorization Violation",
+		},
+		{
+			name:       "fail-jetstream-disabled",
+			config:     &Config{JetStream: true},
+			wantErrMsg: "getting JetStream account information: nats: API error: code=503 err_code=10076 description=jetstream not enabled",
+		},
+		{
+			name:       "fail-sasl-mechanism",
+			config:     &Config{SASL: &utils.SASL{Mechanism: utils.SASLExternal}},
+			wantErrMsg: "unsupported SASL mechanism EXTERNAL",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.jetStream, tt.token)
+
+			tt.config.URL = server.URL()
+			tt.config.AckTimeout = time.Second
+			n := New(tt.config)
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{Event: "test"}).Error, "not connected")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestNATSNotifier_Deliver(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:       "abc",
+			Event:    "orders.created",
+			Data:     map[string]any{"total": 10},
+			Metadata: map[string]string{"Tenant": "acme"},
+		}
+
+		tests = []struct {
+			name             string
+			config           *Config
+			stream           jetstream.StreamConfig
+			before           func(t *testing.T, server *testServer)
+			wantHeaders      map[string]string
+			wantAcknowledged bool
+			wantErrMsg       string
+		}{
+			{
+				name:        "core",
+				config:      &Config{},
+				wantHeaders: map[string]string{"Tenant": "acme"},
+			},
+			{
+				name:        "core-compressed",
+				config:      &Config{Compression: &utils.Compression{Encoding: utils.EncodingGzip}},
+				wantHeaders: map[string]string{"Tenant": "acme", "Content-Encoding": "gzip"},
+			},
+			{
+				name:             "jetstream",
+				config:           &Config{JetStream: true, Stream: "NOTIFY"},
+				wantHeaders:      map[string]string{"Tenant": "acme", "Nats-Msg-Id": "abc", "Nats-Expected-Stream": "NOTIFY"},
+				wantAcknowledged: true,
+			},
+			{
+				name:   "fail-jetstream-full",
+				config: &Config{JetStream: true},
+				stream: jetstream.StreamConfig{Name: "NOTIFY", Subjects: []string{"notify.>"}, MaxMsgs: 1, Discard: jetstream.DiscardNew},
+				before: func(t *testing.T, server *testServer) {
+					if err := server.connect(t).Publish("notify.orders.created", nil); err != nil {
+						t.Fatal(err)
+					}
+				},
+				wantErrMsg: "err_code=10077 description=maximum messages exceeded",
+			},
+			{
+				name:       "fail-jetstream-stream",
+				config:     &Config{JetStream: true, Stream: "OTHER"},
+				wantErrMsg: "err_code=10060 description=expected stream does not match",
+			},
+			{
+				name:       "fail-jetstream-no-stream",
+				config:     &Config{JetStream: true, Subject: "unbound.{{.Event}}"},
+				wantErrMsg: "publishing to JetStream: nats: no response from stream",
+			},
+			{
+				name:       "fail-subject",
+				config:     &Config{Subject: "notify.{{.Data.missing}}"},
+				wantErrMsg: "rendering subject",
+			},
+			{
+				name:       "fail-subject-invalid",
+				config:     &Config{SubjectFunc: func(m *model.Notification) (string, error) { return "notify.*", nil }},
+				wantErrMsg: `invalid subject "notify.*"`,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				server = newTestServer(t, true, "")
+				sub    = server.subscribe(t, "notify.>")
+			)
+
+			if tt.stream.Name == "" {
+				tt.stream = jetstream.StreamConfig{Name: "NOTIFY", Subjects: []string{"notify.>"}}
+			}
+			server.addStream(t, tt.stream)
+
+			if tt.before != nil {
+				tt.before(t, server)
+				if _, err := sub.NextMsg(time.Second); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.config.URL = server.URL()
+			tt.config.AckTimeout = time.Second
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			r := n.Deliver(message)
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				assert.NoError(t, n.Close())
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.Equal(t, tt.wantAcknowledged, r.Acknowledged)
+
+			// Close flushes core publishes
+			assert.NoError(t, n.Close())
+
+			received, err := sub.NextMsg(time.Second)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, "notify.orders.created", received.Subject)
+
+			headers := map[string]string{}
+			for k := range received.Header {
+				headers[k] = received.Header.Get(k)
+			}
+			assert.Equal(t, tt.wantHeaders, headers)
+
+			data, err := utils.Decompress(headers["Content-Encoding"], received.Data)
+			assert.NoError(t, err)
+
+			var got model.Notification
+			assert.NoError(t, json.Unmarshal(data, &got))
+			assert.Equal(t, "abc", got.ID)
+		})
+	}
+}
+
+func TestNATSNotifier_DeliverDuplicate(t *testing.T) {
+	var (
+		server = newTestServer(t, true, "")
+		stream = server.addStream(t, jetstream.StreamConfig{Name: "NOTIFY", Subjects: []string{"notify.>"}})
+		n      = New(&Config{URL: server.URL(), JetStream: true, AckTimeout: time.Second})
+	)
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+	defer n.Close()
+
+	// the stream keeps one copy of notifications with the same ID
+	for i := 0; i < 3; i++ {
+		r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created"})
+		assert.NoError(t, r.Error)
+		assert.True(t, r.Acknowledged)
+	}
+
+	r := n.Deliver(&model.Notification{ID: "def", Event: "orders.created"})
+	assert.NoError(t, r.Error)
+
+	var ids []string
+	for seq := uint64(1); seq <= 3; seq++ {
+		m, err := stream.GetMsg(context.Background(), seq)
+		if err != nil {
+			break
+		}
+		ids = append(ids, m.Header.Get("Nats-Msg-Id"))
+	}
+
+	assert.Equal(t, []string{"abc", "def"}, ids)
+}
+
+func TestNATSNotifier_message(t *testing.T) {
+	n := New(&Config{})
+	n.jsonMarshal = func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") }
+
+	_, err := n.message(&model.Notification{Event: "orders.created"})
+	assert.ErrorContains(t, err, "test-Marshal-error")
+}
@@ -0,0 +1,108 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// testServer is an in-process NATS server, with JetStream storing its
+// streams in a temporary directory when enabled
+type testServer struct {
+	*server.Server
+	token string
+}
+
+func newTestServer(t *testing.T, jetStream bool, token string) *testServer {
+	t.Helper()
+
+	options := &server.Options{
+		Host:          "127.0.0.1",
+		Port:          server.RANDOM_PORT,
+		NoLog:         true,
+		NoSigs:        true,
+		JetStream:     jetStream,
+		Authorization: token,
+	}
+
+	if jetStream {
+		options.StoreDir = t.TempDir()
+	}
+
+	s, err := server.NewServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("server not ready")
+	}
+
+	t.Cleanup(func() {
+		s.Shutdown()
+		s.WaitForShutdown()
+	})
+
+	return &testServer{Server: s, token: token}
+}
+
+func (s *testServer) URL() string {
+	return s.ClientURL()
+}
+
+// connect opens a connection to check what the notifier published
+func (s *testServer) connect(t *testing.T) *nats.Conn {
+	t.Helper()
+
+	conn, err := nats.Connect(s.URL(), nats.Token(s.token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+// addStream creates a stream, the server must have JetStream enabled
+func (s *testServer) addStream(t *testing.T, config jetstream.StreamConfig) jetstream.Stream {
+	t.Helper()
+
+	js, err := jetstream.New(s.connect(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := js.CreateStream(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stream
+}
+
+// subscribe receives the messages published to subject
+func (s *testServer) subscribe(t *testing.T, subject string) *nats.Subscription {
+	t.Helper()
+
+	conn := s.connect(t)
+
+	sub, err := conn.SubscribeSync(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the subscription is registered before the notifier publishes
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return sub
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+)
+
+// Fields names the fields of the stream entries, the defaults are used for
+// the empty ones and "-" leaves a field out
+type Fields struct {
+	// ID is id if not set
+	ID string
+	// Event is event if not set
+	Event string
+	// Data holds the JSON of the data, data if not set
+	Data string
+	// Timestamp holds the RFC 3339 timestamp, timestamp if not set
+	Timestamp string
+	// CorrelationID is correlation_id if not set
+	CorrelationID string
+	// Metadata prefixes the metadata keys, each one added as a field,
+	// meta. if not set
+	Metadata string
+}
+
+// omit is the field name leaving a field out of the entries
+const omit = "-"
+
+func field(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+
+	return name
+}
+
+// values returns the field value pairs of the entry of a notification, empty
+// values are left out
+func (f Fields) values(message *model.Notification, marshal func(v any) ([]byte, error)) ([]string, error) {
+	var values []string
+
+	add := func(name, fallback, value string) {
+		if name = field(name, fallback); name != omit && value != "" {
+			values = append(values, name, value)
+		}
+	}
+
+	add(f.ID, "id", message.ID)
+	add(f.Event, "event", string(message.Event))
+
+	if field(f.Data, "data") != omit {
+		data, err := marshal(message.Data)
+		if err != nil {
+			return nil, fmt.Errorf("encoding data: %w", err)
+		}
+
+		add(f.Data, "data", string(data))
+	}
+
+	if !message.Timestamp.IsZero() {
+		add(f.Timestamp, "timestamp", message.Timestamp.Format(time.RFC3339Nano))
+	}
+
+	add(f.CorrelationID, "correlation_id", message.CorrelationID)
+
+	if prefix := field(f.Metadata, "meta."); prefix != omit {
+		keys := make([]string, 0, len(message.Metadata))
+		for k := range message.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			values = append(values, prefix+k, message.Metadata[k])
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no fields for the entry")
+	}
+
+	return values, nil
+}
@@ -0,0 +1,343 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Mode selects the command used to deliver notifications
+type Mode string
+
+const (
+	// ModeStream appends notifications to a stream with XADD
+	ModeStream Mode = "stream"
+	// ModePubSub publishes notifications to a channel with PUBLISH
+	ModePubSub Mode = "pubsub"
+)
+
+const (
+	defaultAddress       = "localhost:6379"
+	defaultStream        = "notifications"
+	defaultPubSubChannel = "notify:{{.Event}}"
+)
+
+// KeyFunc derives the stream or channel of a notification
+type KeyFunc func(message *model.Notification) (string, error)
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// Address is the host:port of the server, localhost:6379 if not set
+	Address string
+	// DB is the database selected after connecting
+	DB int
+	// Mode is how notifications are delivered, ModeStream if not set
+	Mode Mode
+	// Stream is the key of the stream notifications are added to, it can be
+	// a template, notifications if not set
+	Stream string
+	// MaxLen trims the stream to about the given number of entries, 0 keeps
+	// every entry
+	MaxLen int64
+	// ExactMaxLen trims the stream to exactly MaxLen entries, which is
+	// slower than letting the server trim whole nodes
+	ExactMaxLen bool
+	// Fields names the fields of stream entries
+	Fields Fields
+	// PubSubChannel is where notifications are published in ModePubSub, it
+	// can be a template, notify:{{.Event}} if not set
+	PubSubChannel string
+	// KeyFunc derives the stream or channel of each notification, overrides
+	// Stream and PubSubChannel
+	KeyFunc KeyFunc
+	// Timeout limits connecting and each command, 5 seconds if not set
+	Timeout time.Duration
+	// SASL sets the username and password for AUTH, only PLAIN is supported
+	SASL *utils.SASL
+	// TLS configures encrypted connections
+	TLS *utils.TLSOptions
+	// Client is used instead of connecting to Address, it's not closed by Close
+	Client redis.UniversalClient
+}
+
+// RedisNotifier implements the Notifier interface for Redis streams and Pub/Sub
+type RedisNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	client      redis.UniversalClient
+	key         KeyFunc
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+}
+
+var _ model.Notifier = (*RedisNotifier)(nil)
+
+func New(config *Config) *RedisNotifier {
+	return (&RedisNotifier{}).New(config)
+}
+
+func (n *RedisNotifier) New(config *Config) *RedisNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+
+	if config.Mode == "" {
+		config.Mode = ModeStream
+	}
+
+	if config.Stream == "" {
+		config.Stream = defaultStream
+	}
+
+	if config.PubSubChannel == "" {
+		config.PubSubChannel = defaultPubSubChannel
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.Marshal
+	n.key, n.configErr = newKeyFunc(config)
+
+	return n
+}
+
+// newKeyFunc returns the function deriving the stream or channel of the
+// mode, a KeyFunc takes precedence over the templates
+func newKeyFunc(config *Config) (KeyFunc, error) {
+	if config.KeyFunc != nil {
+		return config.KeyFunc, nil
+	}
+
+	var name, text string
+
+	switch config.Mode {
+	case ModeStream:
+		name, text = "stream", config.Stream
+	case ModePubSub:
+		name, text = "channel", config.PubSubChannel
+	default:
+		return nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+
+	if !utils.IsTemplate(text) {
+		return func(*model.Notification) (string, error) { return text, nil }, nil
+	}
+
+	tpl, err := utils.ParseTemplate(name, text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s template: %w", name, err)
+	}
+
+	return func(message *model.Notification) (string, error) {
+		return tpl.Render(message)
+	}, nil
+}
+
+func (n *RedisNotifier) Type() string {
+	return "redis"
+}
+
+func (n *RedisNotifier) Name() string {
+	return n.Config.Name
+}
+
+// Connect creates the client unless one was given and checks the server
+// answers
+func (n *RedisNotifier) Connect() error {
+	if n.configErr != nil {
+		return n.configErr
+	}
+
+	client := n.Client
+	if client == nil {
+		options, err := n.options()
+		if err != nil {
+			return err
+		}
+
+		client = redis.NewClient(options)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		if n.Client == nil {
+			client.Close()
+		}
+		return fmt.Errorf("connecting to Redis: %w", err)
+	}
+
+	n.client = client
+
+	return nil
+}
+
+// options builds the client options
+func (n *RedisNotifier) options() (*redis.Options, error) {
+	options := &redis.Options{
+		Addr:         n.Address,
+		DB:           n.DB,
+		ClientName:   n.Name(),
+		DialTimeout:  n.Timeout,
+		ReadTimeout:  n.Timeout,
+		WriteTimeout: n.Timeout,
+	}
+
+	if n.SASL != nil {
+		mechanism, username, password, err := n.SASL.Credentials()
+		if err != nil {
+			return nil, fmt.Errorf("resolving credentials: %w", err)
+		}
+
+		if mechanism != utils.SASLPlain {
+			return nil, fmt.Errorf("unsupported SASL mechanism %s", mechanism)
+		}
+
+		options.Username, options.Password = username, password
+	}
+
+	tlsConfig, err := n.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	options.TLSConfig = tlsConfig
+
+	return options, nil
+}
+
+// Close closes the client created by Connect
+func (n *RedisNotifier) Close() error {
+	if n.client == nil || n.Client != nil {
+		return nil
+	}
+
+	err := n.client.Close()
+	n.client = nil
+
+	if err != nil && !errors.Is(err, redis.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *RedisNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *RedisNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *RedisNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver adds a notification to the stream, acknowledged once the server
+// stored it, or publishes it to the channel
+func (n *RedisNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	if n.client == nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("not connected")}
+	}
+
+	key, err := n.key(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("rendering %s: %w", n.keyName(), err)}
+	}
+
+	if key == "" {
+		return &model.Result{Success: false, Error: fmt.Errorf("empty %s", n.keyName())}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	if n.Mode == ModePubSub {
+		payload, err := n.jsonMarshal(message)
+		if err != nil {
+			return &model.Result{Success: false, Error: err}
+		}
+
+		if err := n.client.Publish(ctx, key, payload).Err(); err != nil {
+			return &model.Result{Success: false, Error: fmt.Errorf("publishing message: %w", err)}
+		}
+
+		// PUBLISH is fire and forget, subscribers missing it are not reported
+		return &model.Result{Success: true}
+	}
+
+	values, err := n.Fields.values(message, n.jsonMarshal)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	args := &redis.XAddArgs{
+		Stream: key,
+		MaxLen: n.MaxLen,
+		Approx: !n.ExactMaxLen,
+		Values: values,
+	}
+
+	if err := n.client.XAdd(ctx, args).Err(); err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("adding to stream: %w", err)}
+	}
+
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+func (n *RedisNotifier) keyName() string {
+	if n.Mode == ModePubSub {
+		return "channel"
+	}
+
+	return "stream"
+}
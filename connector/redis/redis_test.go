@@ -0,0 +1,318 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantKey    string
+		wantErrMsg string
+	}{
+		{
+			name:    "default-stream",
+			config:  &Config{},
+			wantKey: "notifications",
+		},
+		{
+			name:    "stream-template",
+			config:  &Config{Stream: "events:{{.Data.tenant}}"},
+			wantKey: "events:acme",
+		},
+		{
+			name:    "default-channel",
+			config:  &Config{Mode: ModePubSub},
+			wantKey: "notify:orders.created",
+		},
+		{
+			name:    "key-func",
+			config:  &Config{Mode: ModePubSub, KeyFunc: func(m *model.Notification) (string, error) { return "custom", nil }},
+			wantKey: "custom",
+		},
+		{
+			name:       "fail-stream",
+			config:     &Config{Stream: "{{.Event"},
+			wantErrMsg: "parsing stream template",
+		},
+		{
+			name:       "fail-channel",
+			config:     &Config{Mode: ModePubSub, PubSubChannel: "{{.Event"},
+			wantErrMsg: "parsing channel template",
+		},
+		{
+			name:       "fail-mode",
+			config:     &Config{Mode: "list"},
+			wantErrMsg: `unknown mode "list"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^redis[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "redis", n.Type())
+			assert.Equal(t, "localhost:6379", n.Address)
+			assert.Equal(t, 5*time.Second, n.Timeout)
+			assert.NotNil(t, n.GetChannel())
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, n.Connect(), tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			key, err := n.key(&model.Notification{Event: "orders.created", Data: map[string]any{"tenant": "acme"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantKey, key)
+		})
+	}
+}
+
+func TestRedisNotifier_Connect(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "credentials",
+			config: &Config{SASL: &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "secret"}}},
+		},
+		{
+			name:       "fail-credentials",
+			config:     &Config{SASL: &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "wrong"}}},
+			wantErrMsg: "connecting to Redis: WRONGPASS",
+		},
+		{
+			name:       "fail-mechanism",
+			config:     &Config{SASL: &utils.SASL{Mechanism: utils.SASLExternal}},
+			wantErrMsg: "unsupported SASL mechanism EXTERNAL",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			server.RequireUserAuth("user", "secret")
+
+			tt.config.Address = server.Addr()
+			n := New(tt.config)
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.EqualError(t, n.Deliver(&model.Notification{}).Error, "not connected")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestRedisNotifier_DeliverStream(t *testing.T) {
+	var (
+		timestamp = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		message   = &model.Notification{
+			ID:            "abc",
+			Event:         "orders.created",
+			Data:          map[string]any{"total": 10},
+			Timestamp:     timestamp,
+			CorrelationID: "req-1",
+			Metadata:      map[string]string{"tenant": "acme"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			serverErr  string
+			wantStream string
+			wantValues []string
+			wantErrMsg string
+		}{
+			{
+				name:       "default-fields",
+				config:     &Config{},
+				wantStream: "notifications",
+				wantValues: []string{
+					"id", "abc",
+					"event", "orders.created",
+					"data", `{"total":10}`,
+					"timestamp", "2024-05-01T10:00:00Z",
+					"correlation_id", "req-1",
+					"meta.tenant", "acme",
+				},
+			},
+			{
+				name: "mapped-fields",
+				config: &Config{
+					Stream: "events:{{.Metadata.tenant}}",
+					Fields: Fields{ID: "notification_id", Event: "type", Timestamp: "-", CorrelationID: "-", Metadata: "-"},
+				},
+				wantStream: "events:acme",
+				wantValues: []string{
+					"notification_id", "abc",
+					"type", "orders.created",
+					"data", `{"total":10}`,
+				},
+			},
+			{
+				name:       "fail-server",
+				config:     &Config{},
+				serverErr:  "READONLY You can't write against a read only replica.",
+				wantErrMsg: "adding to stream: READONLY",
+			},
+			{
+				name:       "fail-stream",
+				config:     &Config{Stream: "events:{{.Data.missing}}"},
+				wantErrMsg: "rendering stream",
+			},
+			{
+				name:       "fail-no-fields",
+				config:     &Config{Fields: Fields{ID: "-", Event: "-", Data: "-", Timestamp: "-", CorrelationID: "-", Metadata: "-"}},
+				wantErrMsg: "no fields for the entry",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+
+			tt.config.Address = server.Addr()
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+			defer n.Close()
+
+			if tt.serverErr != "" {
+				server.SetError(tt.serverErr)
+			}
+
+			r := n.Deliver(message)
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.True(t, r.Acknowledged)
+
+			entries, err := server.Stream(tt.wantStream)
+			assert.NoError(t, err)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, tt.wantValues, entries[0].Values)
+			}
+		})
+	}
+}
+
+func TestRedisNotifier_DeliverMaxLen(t *testing.T) {
+	var (
+		server = miniredis.RunT(t)
+		n      = New(&Config{Address: server.Addr(), MaxLen: 3, ExactMaxLen: true})
+	)
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+	defer n.Close()
+
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		r := n.Deliver(&model.Notification{ID: id, Event: "orders.created"})
+		assert.NoError(t, r.Error)
+	}
+
+	entries, err := server.Stream("notifications")
+	assert.NoError(t, err)
+
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.Values[1])
+	}
+
+	// the oldest entries are trimmed
+	assert.Equal(t, []string{"3", "4", "5"}, ids)
+}
+
+func TestRedisNotifier_DeliverPubSub(t *testing.T) {
+	var (
+		server = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: server.Addr()})
+		n      = New(&Config{Mode: ModePubSub, Client: client})
+	)
+
+	defer client.Close()
+
+	sub := client.Subscribe(context.Background(), "notify:orders.created")
+	defer sub.Close()
+
+	_, err := sub.Receive(context.Background())
+	if !assert.NoError(t, err) || !assert.NoError(t, n.Connect()) {
+		return
+	}
+
+	r := n.Deliver(&model.Notification{ID: "abc", Event: "orders.created", Data: map[string]any{"total": 10}})
+	assert.NoError(t, r.Error)
+	assert.True(t, r.Success)
+	assert.False(t, r.Acknowledged)
+
+	select {
+	case msg := <-sub.Channel():
+		var got model.Notification
+		assert.NoError(t, json.Unmarshal([]byte(msg.Payload), &got))
+		assert.Equal(t, "abc", got.ID)
+		assert.Equal(t, model.EventType("orders.created"), got.Event)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	// the given client is left open
+	assert.NoError(t, n.Close())
+	assert.NoError(t, client.Ping(context.Background()).Err())
+}
+
+func TestRedisNotifier_Run(t *testing.T) {
+	var (
+		server = miniredis.RunT(t)
+		n      = New(&Config{Address: server.Addr(), Stream: "events:{{.Event}}"})
+		done   = make(chan struct{})
+	)
+
+	if !assert.NoError(t, n.Connect()) {
+		return
+	}
+	defer n.Close()
+
+	go func() {
+		n.Run()
+		close(done)
+	}()
+
+	n.Notify(&model.Notification{ID: "abc", Event: "orders.created"})
+	n.Notify(&model.Notification{ID: "def", Event: "orders.shipped"})
+	close(n.Channel)
+	<-done
+
+	assert.Equal(t, []string{"events:orders.created", "events:orders.shipped"}, server.Keys())
+}
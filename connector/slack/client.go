@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/padiazg/notifier/utils"
+)
+
+// apiResponse is the response of chat.postMessage
+type apiResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// post sends the message to the incoming webhook or chat.postMessage,
+// waiting as told by Slack when rate limited. It returns the timestamp of the
+// message when posted with the Web API
+func (n *SlackNotifier) post(payload []byte) (string, error) {
+	var ts string
+
+	err := utils.RetryRateLimited(n.MaxRetries, n.sleep, func() error {
+		resp, err := n.do(payload)
+		if err != nil {
+			return err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &utils.RateLimitedError{Wait: utils.RetryAfter(resp.Header.Get("Retry-After"))}
+		}
+
+		if n.WebhookURL != "" {
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("slack webhook returned non-OK status: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+			}
+
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack API returned non-OK status: %d", resp.StatusCode)
+		}
+
+		var r apiResponse
+		if err := json.Unmarshal(body, &r); err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+
+		if !r.OK {
+			return fmt.Errorf("slack API error: %s", r.Error)
+		}
+
+		ts = r.TS
+
+		return nil
+	})
+
+	return ts, err
+}
+
+// do sends a request with the payload
+func (n *SlackNotifier) do(payload []byte) (*http.Response, error) {
+	url := n.WebhookURL
+	if url == "" {
+		url = strings.TrimSuffix(n.BaseURL, "/") + "/chat.postMessage"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	if n.WebhookURL == "" {
+		token, err := n.Token.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("resolving token: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// the webhook URL is a secret, keep it out of the error
+		return nil, fmt.Errorf("sending request: %w", utils.UnwrapURLError(err))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,231 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+const defaultBaseURL = "https://slack.com/api"
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// WebhookURL is an incoming webhook, messages are posted to the channel it
+	// was created for
+	WebhookURL string
+	// Token is a bot token used to post with chat.postMessage when WebhookURL
+	// is not set
+	Token utils.Secret
+	// BaseURL is the Web API URL, https://slack.com/api if not set
+	BaseURL string
+	// Channels maps event types to the channel their messages are posted to
+	Channels map[model.EventType]string
+	// DefaultChannel receives the notifications of events not in Channels
+	DefaultChannel string
+	// Templates maps event types to the template of their messages
+	Templates map[model.EventType]*Template
+	// Default is the template of events not in Templates, if not set the
+	// message holds the notification data as JSON
+	Default *Template
+	// Threads posts notifications with the same correlation ID as replies to
+	// the first one, only supported with Token
+	Threads bool
+	// ThreadTTL is how long a thread is remembered, 24 hours if not set
+	ThreadTTL time.Duration
+	// MaxRetries is how many times a rate limited message is retried, 3 if
+	// not set, negative to never retry
+	MaxRetries int
+	// Timeout limits each request, 10 seconds if not set
+	Timeout time.Duration
+}
+
+type SlackNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	client      *http.Client
+	templates   map[model.EventType]*template
+	fallback    *template
+	configErr   error
+	threadsLock sync.Mutex
+	threads     map[string]*thread
+	jsonMarshal func(v any) ([]byte, error)
+	sleep       func(d time.Duration)
+	now         func() time.Time
+}
+
+var _ model.Notifier = (*SlackNotifier)(nil)
+
+func New(config *Config) *SlackNotifier {
+	return (&SlackNotifier{}).New(config)
+}
+
+func (n *SlackNotifier) New(config *Config) *SlackNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = defaultBaseURL
+	}
+
+	if config.ThreadTTL == 0 {
+		config.ThreadTTL = 24 * time.Hour
+	}
+
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.client = &http.Client{Timeout: config.Timeout}
+	n.threads = make(map[string]*thread)
+	n.jsonMarshal = json.Marshal
+	n.sleep = time.Sleep
+	n.now = time.Now
+	n.configErr = n.parseConfig()
+
+	return n
+}
+
+// parseConfig checks the mode and parses the templates
+func (n *SlackNotifier) parseConfig() error {
+	var err error
+
+	if n.WebhookURL == "" && n.Token == (utils.Secret{}) {
+		return fmt.Errorf("either WebhookURL or Token must be set")
+	}
+
+	if n.Threads && n.WebhookURL != "" {
+		return fmt.Errorf("threads require a Token, incoming webhooks don't return the message timestamp")
+	}
+
+	n.templates = make(map[model.EventType]*template, len(n.Templates))
+	for event, t := range n.Templates {
+		if n.templates[event], err = t.parse(string(event)); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if n.fallback, err = n.Default.parse("default"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *SlackNotifier) Type() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) Name() string {
+	return n.Config.Name
+}
+
+func (n *SlackNotifier) Connect() error {
+	return n.configErr
+}
+
+func (n *SlackNotifier) Close() error {
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *SlackNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *SlackNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *SlackNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver posts a notification to Slack
+func (n *SlackNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	msg, err := n.render(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	msg.Channel = n.route(message.Event)
+	if msg.Channel == "" && n.WebhookURL == "" {
+		return &model.Result{Success: false, Error: fmt.Errorf("no channel for event %s", message.Event)}
+	}
+
+	threaded := n.Threads && message.CorrelationID != ""
+	if threaded {
+		msg.ThreadTS = n.thread(msg.Channel, message.CorrelationID)
+	}
+
+	payload, err := n.jsonMarshal(msg)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	ts, err := n.post(payload)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	// replies to the notification are posted in its thread
+	if threaded && msg.ThreadTS == "" {
+		n.startThread(msg.Channel, message.CorrelationID, ts)
+	}
+
+	return &model.Result{Success: true}
+}
+
+// route returns the channel of the event
+func (n *SlackNotifier) route(event model.EventType) string {
+	if channel, ok := n.Channels[event]; ok {
+		return channel
+	}
+
+	return n.DefaultChannel
+}
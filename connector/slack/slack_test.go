@@ -0,0 +1,264 @@
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeSlack answers like chat.postMessage once the queued responses are
+// used
+func newFakeSlack(t *testing.T, responses ...func(w http.ResponseWriter)) *utils.TestServer {
+	t.Helper()
+
+	return utils.NewTestServer(t, func(w http.ResponseWriter, count int) {
+		fmt.Fprintf(w, `{"ok": true, "ts": "1700000000.%06d"}`, count)
+	}, responses...)
+}
+
+func TestSlackNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "webhook",
+			config: &Config{WebhookURL: "https://hooks.slack.com/services/test"},
+		},
+		{
+			name:   "token",
+			config: &Config{Token: utils.Secret{Value: "xoxb-test"}, Threads: true},
+		},
+		{
+			name:       "fail-mode",
+			config:     &Config{},
+			wantErrMsg: "either WebhookURL or Token must be set",
+		},
+		{
+			name:       "fail-threads-webhook",
+			config:     &Config{WebhookURL: "https://hooks.slack.com/services/test", Threads: true},
+			wantErrMsg: "threads require a Token",
+		},
+		{
+			name: "fail-template",
+			config: &Config{
+				WebhookURL: "https://hooks.slack.com/services/test",
+				Templates:  map[model.EventType]*Template{"test": {Text: "test", Blocks: "{{.Event"}},
+			},
+			wantErrMsg: "parsing test blocks template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^slack[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "slack", n.Type())
+			assert.Equal(t, defaultBaseURL, n.BaseURL)
+			assert.Equal(t, 3, n.MaxRetries)
+			assert.NotNil(t, n.GetChannel())
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestSlackNotifier_Deliver(t *testing.T) {
+	tests := []struct {
+		name        string
+		webhook     bool
+		config      *Config
+		responses   []func(w http.ResponseWriter)
+		message     *model.Notification
+		wantChannel any
+		wantSleeps  []time.Duration
+		wantErrMsg  string
+	}{
+		{
+			name:        "webhook",
+			webhook:     true,
+			config:      &Config{},
+			responses:   []func(w http.ResponseWriter){func(w http.ResponseWriter) { fmt.Fprint(w, "ok") }},
+			message:     &model.Notification{Event: "orders.created"},
+			wantChannel: nil,
+		},
+		{
+			name:        "api-routed",
+			config:      &Config{DefaultChannel: "#general", Channels: map[model.EventType]string{"orders.created": "#orders"}},
+			message:     &model.Notification{Event: "orders.created"},
+			wantChannel: "#orders",
+		},
+		{
+			name:        "api-default-channel",
+			config:      &Config{DefaultChannel: "#general", Channels: map[model.EventType]string{"orders.created": "#orders"}},
+			message:     &model.Notification{Event: "users.deleted"},
+			wantChannel: "#general",
+		},
+		{
+			name:        "rate-limited",
+			config:      &Config{DefaultChannel: "#general"},
+			responses:   []func(w http.ResponseWriter){utils.TestRateLimited("2", ""), utils.TestRateLimited("", "")},
+			message:     &model.Notification{Event: "orders.created"},
+			wantChannel: "#general",
+			wantSleeps:  []time.Duration{2 * time.Second, time.Second},
+		},
+		{
+			name:       "fail-rate-limited",
+			config:     &Config{DefaultChannel: "#general", MaxRetries: 1},
+			responses:  []func(w http.ResponseWriter){utils.TestRateLimited("1", ""), utils.TestRateLimited("1", "")},
+			message:    &model.Notification{Event: "orders.created"},
+			wantSleeps: []time.Duration{time.Second},
+			wantErrMsg: "rate limited, gave up after 1 retries",
+		},
+		{
+			name:       "fail-no-retries",
+			config:     &Config{DefaultChannel: "#general", MaxRetries: -1},
+			responses:  []func(w http.ResponseWriter){utils.TestRateLimited("1", "")},
+			message:    &model.Notification{Event: "orders.created"},
+			wantErrMsg: "rate limited, gave up after 0 retries",
+		},
+		{
+			name:       "fail-api",
+			config:     &Config{DefaultChannel: "#missing"},
+			responses:  []func(w http.ResponseWriter){func(w http.ResponseWriter) { fmt.Fprint(w, `{"ok": false, "error": "channel_not_found"}`) }},
+			message:    &model.Notification{Event: "orders.created"},
+			wantErrMsg: "slack API error: channel_not_found",
+		},
+		{
+			name:    "fail-webhook",
+			webhook: true,
+			config:  &Config{},
+			responses: []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, "no_service")
+			}},
+			message:    &model.Notification{Event: "orders.created"},
+			wantErrMsg: "slack webhook returned non-OK status: 404 no_service",
+		},
+		{
+			name:       "fail-no-channel",
+			config:     &Config{},
+			message:    &model.Notification{Event: "orders.created"},
+			wantErrMsg: "no channel for event orders.created",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				server = newFakeSlack(t, tt.responses...)
+				sleeps []time.Duration
+			)
+
+			if tt.webhook {
+				tt.config.WebhookURL = server.URL + "/services/test"
+			} else {
+				tt.config.BaseURL = server.URL + "/api/"
+				tt.config.Token = utils.Secret{Value: "xoxb-test"}
+			}
+
+			n := New(tt.config)
+			n.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			r := n.Deliver(tt.message)
+			assert.Equal(t, tt.wantSleeps, sleeps)
+
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+
+			var (
+				requests = server.Requests()
+				request  = requests[len(requests)-1]
+				body     map[string]any
+			)
+
+			assert.NoError(t, server.DecodeBody(-1, &body))
+			assert.Equal(t, tt.wantChannel, body["channel"])
+
+			if tt.webhook {
+				assert.Equal(t, "/services/test", request.URL.Path)
+				assert.Empty(t, request.Header.Get("Authorization"))
+			} else {
+				assert.Equal(t, "/api/chat.postMessage", request.URL.Path)
+				assert.Equal(t, "Bearer xoxb-test", request.Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestSlackNotifier_DeliverThreads(t *testing.T) {
+	var (
+		server = newFakeSlack(t)
+		now    = time.Now()
+		n      = New(&Config{
+			BaseURL:        server.URL,
+			Token:          utils.Secret{Value: "xoxb-test"},
+			DefaultChannel: "#orders",
+			Threads:        true,
+			ThreadTTL:      time.Hour,
+		})
+	)
+
+	n.now = func() time.Time { return now }
+
+	deliver := func(correlationID string) {
+		t.Helper()
+		assert.NoError(t, n.Deliver(&model.Notification{Event: "orders.created", CorrelationID: correlationID}).Error)
+	}
+
+	deliver("order-1")
+	deliver("order-1")
+	deliver("order-2")
+	deliver("")
+
+	// the thread is forgotten once expired, the next message starts another
+	now = now.Add(time.Hour)
+	deliver("order-1")
+	deliver("order-1")
+
+	var threads []any
+	for i := range server.Requests() {
+		var body map[string]any
+		assert.NoError(t, server.DecodeBody(i, &body))
+		threads = append(threads, body["thread_ts"])
+	}
+
+	assert.Equal(t, []any{nil, "1700000000.000001", nil, nil, nil, "1700000000.000005"}, threads)
+	assert.Len(t, n.threads, 1, "expired threads not forgotten")
+}
+
+func TestSlackNotifier_DeliverUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	n := New(&Config{WebhookURL: server.URL + "/services/T000/B000/secret"})
+
+	r := n.Deliver(&model.Notification{Event: "orders.created"})
+	assert.ErrorContains(t, r.Error, "sending request:")
+	assert.NotContains(t, r.Error.Error(), "secret", "webhook URL leaked in the error")
+}
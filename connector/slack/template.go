@@ -0,0 +1,97 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Template holds the templates rendered against a notification to build its
+// message
+type Template struct {
+	// Text is the message, shown in notifications and by clients not
+	// supporting blocks when Blocks is set
+	Text string
+	// Blocks renders a JSON array of Block Kit blocks, the json function
+	// quotes values, e.g. [{"type": "section", "text": {"type": "mrkdwn", "text": {{json .Data.summary}}}}]
+	Blocks string
+}
+
+// template is a parsed Template
+type template struct {
+	text   *utils.Template
+	blocks *utils.Template
+}
+
+// message is the payload of incoming webhooks and chat.postMessage
+type message struct {
+	Channel  string            `json:"channel,omitempty"`
+	Text     string            `json:"text"`
+	Blocks   []json.RawMessage `json:"blocks,omitempty"`
+	ThreadTS string            `json:"thread_ts,omitempty"`
+}
+
+func (t *Template) parse(name string) (*template, error) {
+	var (
+		result = &template{}
+		err    error
+	)
+
+	if result.text, err = utils.ParseTemplate(name+".text", t.Text); err != nil {
+		return nil, fmt.Errorf("parsing %s text template: %w", name, err)
+	}
+
+	if t.Blocks != "" {
+		if result.blocks, err = utils.ParseTemplate(name+".blocks", t.Blocks); err != nil {
+			return nil, fmt.Errorf("parsing %s blocks template: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (t *template) render(notification *model.Notification) (*message, error) {
+	var (
+		result = &message{}
+		err    error
+	)
+
+	if result.Text, err = t.text.Render(notification); err != nil {
+		return nil, fmt.Errorf("rendering text: %w", err)
+	}
+
+	if t.blocks != nil {
+		blocks, err := t.blocks.Render(notification)
+		if err != nil {
+			return nil, fmt.Errorf("rendering blocks: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(blocks), &result.Blocks); err != nil {
+			return nil, fmt.Errorf("blocks aren't a JSON array: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// render builds the message of the notification with the template of its
+// event, the data is sent as a JSON code block if there is none
+func (n *SlackNotifier) render(notification *model.Notification) (*message, error) {
+	t, ok := n.templates[notification.Event]
+	if !ok {
+		t = n.fallback
+	}
+
+	if t != nil {
+		return t.render(notification)
+	}
+
+	data, err := n.jsonMarshal(notification.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{Text: fmt.Sprintf("*%s*\n```%s```", notification.Event, data)}, nil
+}
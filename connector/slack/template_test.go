@@ -0,0 +1,91 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlackNotifier_render(t *testing.T) {
+	var (
+		notification = &model.Notification{
+			ID:    "abc",
+			Event: "orders.created",
+			Data:  map[string]any{"summary": `Order "abc" created`},
+		}
+
+		tests = []struct {
+			name       string
+			templates  map[model.EventType]*Template
+			fallback   *Template
+			marshal    func(v any) ([]byte, error)
+			want       *message
+			wantErrMsg string
+		}{
+			{
+				name: "blocks",
+				templates: map[model.EventType]*Template{
+					"orders.created": {
+						Text:   "{{.Data.summary}}",
+						Blocks: `[{"type": "section", "text": {"type": "mrkdwn", "text": {{json .Data.summary}}}}]`,
+					},
+				},
+				want: &message{
+					Text:   `Order "abc" created`,
+					Blocks: []json.RawMessage{json.RawMessage(`{"type": "section", "text": {"type": "mrkdwn", "text": "Order \"abc\" created"}}`)},
+				},
+			},
+			{
+				name:     "default-template",
+				fallback: &Template{Text: "{{.Event}} {{.ID}}"},
+				want:     &message{Text: "orders.created abc"},
+			},
+			{
+				name: "data-as-json",
+				want: &message{Text: "*orders.created*\n```{\"summary\":\"Order \\\"abc\\\" created\"}```"},
+			},
+			{
+				name:       "fail-marshal",
+				marshal:    func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+				wantErrMsg: "test-Marshal-error",
+			},
+			{
+				name:       "fail-text",
+				fallback:   &Template{Text: "{{.Data.region}}"},
+				wantErrMsg: "rendering text",
+			},
+			{
+				name:       "fail-blocks-not-array",
+				fallback:   &Template{Text: "test", Blocks: `{"type": "divider"}`},
+				wantErrMsg: "blocks aren't a JSON array",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(&Config{Token: utils.Secret{Value: "xoxb-test"}, Templates: tt.templates, Default: tt.fallback})
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			got, err := n.render(notification)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package slack
+
+import "time"
+
+// thread is the first message posted for a correlation ID
+type thread struct {
+	ts      string
+	started time.Time
+}
+
+func threadKey(channel, correlationID string) string {
+	return channel + "\x00" + correlationID
+}
+
+// thread returns the timestamp of the thread of the correlation ID in the
+// channel, empty if not started or expired
+func (n *SlackNotifier) thread(channel, correlationID string) string {
+	n.threadsLock.Lock()
+	defer n.threadsLock.Unlock()
+
+	t, ok := n.threads[threadKey(channel, correlationID)]
+	if !ok || n.now().Sub(t.started) >= n.ThreadTTL {
+		return ""
+	}
+
+	return t.ts
+}
+
+// startThread remembers the message starting the thread of the correlation
+// ID, forgetting the expired threads
+func (n *SlackNotifier) startThread(channel, correlationID, ts string) {
+	if ts == "" {
+		return
+	}
+
+	n.threadsLock.Lock()
+	defer n.threadsLock.Unlock()
+
+	now := n.now()
+	for k, t := range n.threads {
+		if now.Sub(t.started) >= n.ThreadTTL {
+			delete(n.threads, k)
+		}
+	}
+
+	n.threads[threadKey(channel, correlationID)] = &thread{ts: ts, started: now}
+}
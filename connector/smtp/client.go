@@ -0,0 +1,176 @@
+package smtp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/padiazg/notifier/utils"
+)
+
+// send opens an SMTP session and sends the email to the recipients
+func (n *SMTPNotifier) send(recipients []string, data []byte) error {
+	host, _, err := net.SplitHostPort(n.Address)
+	if err != nil {
+		return fmt.Errorf("parsing address: %w", err)
+	}
+
+	conn, err := n.dial("tcp", n.Address, n.Timeout)
+	if err != nil {
+		return fmt.Errorf("dialing SMTP server: %w", err)
+	}
+
+	if err := conn.SetDeadline(n.now().Add(n.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	if n.Security != SecurityNone {
+		if tlsConfig, err = n.tlsConfig(host); err != nil {
+			conn.Close()
+			return fmt.Errorf("configuring TLS: %w", err)
+		}
+	}
+
+	if n.Security == SecurityImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("starting SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Hello(n.LocalName); err != nil {
+		return fmt.Errorf("greeting SMTP server: %w", err)
+	}
+
+	if n.Security == SecuritySTARTTLS {
+		// never fall back to an unencrypted session
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server doesn't support STARTTLS")
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+
+	if n.Auth != nil {
+		auth, err := n.auth(host)
+		if err != nil {
+			return fmt.Errorf("configuring authentication: %w", err)
+		}
+
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.from.Address); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+
+	for _, r := range recipients {
+		if err := client.Rcpt(r); err != nil {
+			return fmt.Errorf("adding recipient %s: %w", r, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing data: %w", err)
+	}
+
+	// the server accepts the email when the data is closed
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending data: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// tlsConfig verifies the server against the host in the address, unless
+// other server name is set
+func (n *SMTPNotifier) tlsConfig(host string) (*tls.Config, error) {
+	config, err := n.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	return config, nil
+}
+
+// auth returns the authentication mechanism
+func (n *SMTPNotifier) auth(host string) (smtp.Auth, error) {
+	mechanism, username, password, err := n.Auth.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	switch mechanism {
+	case utils.SASLPlain:
+		return smtp.PlainAuth("", username, password, host), nil
+	case utils.SASLLogin:
+		return &loginAuth{username: username, password: password, host: host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q", mechanism)
+	}
+}
+
+// loginAuth implements the LOGIN mechanism, like smtp.PlainAuth credentials
+// are only sent over TLS or to localhost
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return utils.SASLLogin, nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
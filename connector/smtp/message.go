@@ -0,0 +1,217 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// part is a text body of the email
+type part struct {
+	contentType string
+	body        string
+}
+
+// compose builds the MIME message. Text and HTML bodies are sent as
+// multipart/alternative, wrapped in multipart/mixed when there are attachments
+func (n *SMTPNotifier) compose(message *model.Notification, to, cc []*mail.Address, c *content, attachments []Attachment) ([]byte, error) {
+	var (
+		buf   bytes.Buffer
+		parts []part
+	)
+
+	if c.text != "" {
+		parts = append(parts, part{contentType: "text/plain; charset=utf-8", body: c.text})
+	}
+
+	if c.html != "" {
+		parts = append(parts, part{contentType: "text/html; charset=utf-8", body: c.html})
+	}
+
+	if len(parts) == 0 {
+		parts = append(parts, part{contentType: "text/plain; charset=utf-8"})
+	}
+
+	n.writeHeaders(&buf, message, to, cc, c.subject)
+
+	switch {
+	case len(attachments) == 0 && len(parts) == 1:
+		fmt.Fprintf(&buf, "Content-Type: %s\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", parts[0].contentType)
+		if err := writeQuotedPrintable(&buf, parts[0].body); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case len(attachments) == 0:
+		mw := multipart.NewWriter(&buf)
+		fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+		for _, p := range parts {
+			if err := writePart(mw, p); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	if err := writeAlternative(mw, parts); err != nil {
+		return nil, err
+	}
+
+	for _, a := range attachments {
+		if err := writeAttachment(mw, a); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (n *SMTPNotifier) writeHeaders(w io.Writer, message *model.Notification, to, cc []*mail.Address, subject string) {
+	date := message.Timestamp
+	if date.IsZero() {
+		date = n.now()
+	}
+
+	id := message.ID
+	if id == "" {
+		id = utils.RandomId(utils.ID12)
+	}
+
+	fmt.Fprintf(w, "From: %s\r\n", n.from)
+	if len(to) > 0 {
+		fmt.Fprintf(w, "To: %s\r\n", addressList(to))
+	}
+	if len(cc) > 0 {
+		fmt.Fprintf(w, "Cc: %s\r\n", addressList(cc))
+	}
+	fmt.Fprintf(w, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(w, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(w, "Message-ID: <%s@%s>\r\n", id, domain(n.from))
+	fmt.Fprint(w, "MIME-Version: 1.0\r\n")
+}
+
+// writeAlternative writes the text bodies as a part, nested in a
+// multipart/alternative part if more than one
+func writeAlternative(mw *multipart.Writer, parts []part) error {
+	if len(parts) == 1 {
+		return writePart(mw, parts[0])
+	}
+
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + boundary},
+	})
+	if err != nil {
+		return err
+	}
+
+	alternative := multipart.NewWriter(w)
+	if err := alternative.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, p := range parts {
+		if err := writePart(alternative, p); err != nil {
+			return err
+		}
+	}
+
+	return alternative.Close()
+}
+
+func writePart(mw *multipart.Writer, p part) error {
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {p.contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeQuotedPrintable(w, p.body)
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+	})
+	if err != nil {
+		return err
+	}
+
+	// lines of 76 characters at most
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err = io.WriteString(w, encoded+"\r\n")
+
+	return err
+}
+
+func addressList(list []*mail.Address) string {
+	formatted := make([]string, len(list))
+	for i, a := range list {
+		formatted[i] = a.String()
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+// domain returns the domain of the address, used in message IDs
+func domain(a *mail.Address) string {
+	if i := strings.LastIndexByte(a.Address, '@'); i >= 0 {
+		return a.Address[i+1:]
+	}
+
+	return "localhost"
+}
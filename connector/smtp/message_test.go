@@ -0,0 +1,191 @@
+package smtp
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// mimePart is a decoded part of an email, nested parts flattened
+type mimePart struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+// parseParts reads the parts of the body, decoding them
+func parseParts(t *testing.T, contentType string, body io.Reader) []mimePart {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		data, _ := io.ReadAll(body)
+		return []mimePart{{contentType: mediaType, body: string(data)}}
+	}
+
+	var (
+		parts  []mimePart
+		reader = multipart.NewReader(body, params["boundary"])
+	)
+
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partType := p.Header.Get("Content-Type")
+		if strings.HasPrefix(partType, "multipart/") {
+			parts = append(parts, mimePart{contentType: strings.Split(partType, ";")[0]})
+			parts = append(parts, parseParts(t, partType, p)...)
+			continue
+		}
+
+		data, _ := io.ReadAll(p)
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			data, _ = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(data), "\r\n", ""))
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(partType)
+		parts = append(parts, mimePart{contentType: mediaType, filename: p.FileName(), body: string(data)})
+	}
+}
+
+func TestSMTPNotifier_compose(t *testing.T) {
+	var (
+		large = strings.Repeat("0123456789", 20)
+
+		tests = []struct {
+			name        string
+			content     *content
+			attachments []Attachment
+			wantType    string
+			wantParts   []mimePart
+		}{
+			{
+				name:      "text",
+				content:   &content{subject: "test", text: "hello"},
+				wantType:  "text/plain",
+				wantParts: []mimePart{{contentType: "text/plain", body: "hello"}},
+			},
+			{
+				name:      "html",
+				content:   &content{subject: "test", html: "<p>hello</p>"},
+				wantType:  "text/html",
+				wantParts: []mimePart{{contentType: "text/html", body: "<p>hello</p>"}},
+			},
+			{
+				name:     "alternative",
+				content:  &content{subject: "test", text: "hello", html: "<p>hello</p>"},
+				wantType: "multipart/alternative",
+				wantParts: []mimePart{
+					{contentType: "text/plain", body: "hello"},
+					{contentType: "text/html", body: "<p>hello</p>"},
+				},
+			},
+			{
+				name:    "attachments",
+				content: &content{subject: "test", text: "hello", html: "<p>hello</p>"},
+				attachments: []Attachment{
+					{Filename: "report.csv", Data: []byte("a,b\n1,2\n")},
+					{Filename: "dump", Data: []byte(large)},
+				},
+				wantType: "multipart/mixed",
+				wantParts: []mimePart{
+					{contentType: "multipart/alternative"},
+					{contentType: "text/plain", body: "hello"},
+					{contentType: "text/html", body: "<p>hello</p>"},
+					{contentType: "text/csv", filename: "report.csv", body: "a,b\n1,2\n"},
+					{contentType: "application/octet-stream", filename: "dump", body: large},
+				},
+			},
+			{
+				name:        "attachment-text",
+				content:     &content{subject: "test", text: "hello"},
+				attachments: []Attachment{{Filename: "data.json", ContentType: "application/json", Data: []byte(`{}`)}},
+				wantType:    "multipart/mixed",
+				wantParts: []mimePart{
+					{contentType: "text/plain", body: "hello"},
+					{contentType: "application/json", filename: "data.json", body: `{}`},
+				},
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(&Config{From: "Notifier <notifier@example.com>"})
+
+			data, err := n.compose(&model.Notification{ID: "abc"}, nil, nil, tt.content, tt.attachments)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			contentType := msg.Header.Get("Content-Type")
+			assert.True(t, strings.HasPrefix(contentType, tt.wantType), "Content-Type = %s, want %s", contentType, tt.wantType)
+
+			// single parts are decoded here, nested ones by the multipart reader
+			body := msg.Body
+			if msg.Header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+				body = quotedprintable.NewReader(body)
+			}
+
+			assert.Equal(t, tt.wantParts, parseParts(t, contentType, body))
+		})
+	}
+}
+
+func TestSMTPNotifier_writeHeaders(t *testing.T) {
+	var (
+		n = New(&Config{From: "Notifier <notifier@example.com>"})
+		b strings.Builder
+	)
+
+	to, _ := mail.ParseAddressList("Alice <alice@example.com>")
+	cc, _ := mail.ParseAddressList("bob@example.com")
+
+	n.writeHeaders(&b, &model.Notification{
+		ID:        "abc",
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, to, cc, "Pedido confirmado ✓\r\nBcc: evil@example.com")
+
+	msg, err := mail.ReadMessage(strings.NewReader(b.String() + "\r\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+
+	// line breaks in the subject are encoded, not taken as headers
+	assert.Equal(t, "Pedido confirmado ✓\r\nBcc: evil@example.com", subject)
+	assert.Empty(t, msg.Header.Get("Bcc"))
+	assert.Equal(t, `"Notifier" <notifier@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, `"Alice" <alice@example.com>`, msg.Header.Get("To"))
+	assert.Equal(t, "<bob@example.com>", msg.Header.Get("Cc"))
+	assert.Equal(t, "Tue, 02 Jan 2024 03:04:05 +0000", msg.Header.Get("Date"))
+	assert.Equal(t, "<abc@example.com>", msg.Header.Get("Message-ID"))
+	assert.Equal(t, "1.0", msg.Header.Get("MIME-Version"))
+}
@@ -0,0 +1,245 @@
+package smtp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// received is an email accepted by the fake server
+type received struct {
+	from string
+	to   []string
+	data string
+	// user is the authenticated user, if any
+	user string
+	tls  bool
+}
+
+// fakeServer is a minimal SMTP server supporting STARTTLS, implicit TLS and
+// the PLAIN and LOGIN mechanisms. Recipients with "reject" in their address
+// are refused
+type fakeServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	starttls bool
+	username string
+	password string
+	lock     sync.Mutex
+	mails    []received
+}
+
+// newFakeServer starts a server, with implicit TLS if implicit is set, and
+// offering STARTTLS if starttls is set
+func newFakeServer(t *testing.T, implicit, starttls bool) *fakeServer {
+	t.Helper()
+
+	s := &fakeServer{
+		tls:      &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}},
+		starttls: starttls,
+		username: "user",
+		password: "secret",
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if implicit {
+		listener = tls.NewListener(listener, s.tls)
+	}
+
+	s.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+
+	return s
+}
+
+func (s *fakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) received() []received {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]received(nil), s.mails...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.session(conn)
+	}
+}
+
+func (s *fakeServer) session(conn net.Conn) {
+	defer conn.Close()
+
+	var (
+		_, secure = conn.(*tls.Conn)
+		text      = textproto.NewConn(conn)
+		mail      received
+	)
+
+	_ = text.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"250-fake"}
+			if s.starttls && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			lines = append(lines, "250-AUTH PLAIN LOGIN", "250 8BITMIME")
+			_ = text.PrintfLine("%s", strings.Join(lines, "\r\n"))
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure, text = tlsConn, true, textproto.NewConn(tlsConn)
+		case "AUTH":
+			mail.user = s.auth(text, arg)
+		case "MAIL":
+			mail.from = address(arg)
+			mail.tls = secure
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			to := address(arg)
+			if strings.Contains(to, "reject") {
+				_ = text.PrintfLine("550 no such user")
+				continue
+			}
+			mail.to = append(mail.to, to)
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+
+			s.lock.Lock()
+			s.mails = append(s.mails, mail)
+			s.lock.Unlock()
+
+			mail = received{user: mail.user}
+			_ = text.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			_ = text.PrintfLine("250 ok")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// auth runs the AUTH exchange, returning the authenticated user
+func (s *fakeServer) auth(text *textproto.Conn, arg string) string {
+	var (
+		mechanism, initial, _ = strings.Cut(arg, " ")
+		username, password    string
+	)
+
+	challenge := func(prompt string) string {
+		_ = text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, _ := text.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			initial = base64.StdEncoding.EncodeToString([]byte(challenge("")))
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		fields := strings.Split(string(decoded), "\x00")
+		if len(fields) == 3 {
+			username, password = fields[1], fields[2]
+		}
+	case "LOGIN":
+		username = challenge("Username:")
+		password = challenge("Password:")
+	default:
+		_ = text.PrintfLine("504 unsupported mechanism")
+		return ""
+	}
+
+	if username != s.username || password != s.password {
+		_ = text.PrintfLine("535 authentication failed")
+		return ""
+	}
+
+	_ = text.PrintfLine("235 authenticated")
+
+	return username
+}
+
+// address extracts the address of MAIL FROM:<a> and RCPT TO:<a>
+func address(arg string) string {
+	start, end := strings.IndexByte(arg, '<'), strings.IndexByte(arg, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return arg[start+1 : end]
+}
+
+// testCertificate generates a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,281 @@
+package smtp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Security is how the connection to the server is encrypted
+type Security string
+
+const (
+	// SecurityNone sends in the clear, credentials are only sent to localhost
+	SecurityNone Security = ""
+	// SecuritySTARTTLS upgrades the connection, failing if the server doesn't support it
+	SecuritySTARTTLS Security = "starttls"
+	// SecurityImplicit connects with TLS, usually on port 465
+	SecurityImplicit Security = "tls"
+)
+
+// Metadata keys with comma separated recipients of a notification, they
+// replace the ones in the config
+const (
+	MetadataTo  = "email.to"
+	MetadataCc  = "email.cc"
+	MetadataBcc = "email.bcc"
+)
+
+// Attachment is a file attached to the email
+type Attachment struct {
+	Filename string
+	// ContentType is detected from the filename extension if empty
+	ContentType string
+	Data        []byte
+}
+
+// AttachmentFunc returns the files attached to the email of a notification
+type AttachmentFunc func(message *model.Notification) ([]Attachment, error)
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// Address is the host:port of the server
+	Address  string
+	Security Security
+	// TLS verifies the server certificate, the host in Address is used as the
+	// server name if not set
+	TLS *utils.TLSOptions
+	// Auth authenticates with the PLAIN or LOGIN mechanisms, no authentication
+	// if not set
+	Auth *utils.SASL
+	// LocalName is sent in the EHLO command, localhost if not set
+	LocalName string
+	From      string
+	// To, Cc and Bcc are the recipients of notifications without recipients
+	// in their metadata
+	To  []string
+	Cc  []string
+	Bcc []string
+	// Templates maps event types to the template of their emails
+	Templates map[model.EventType]*Template
+	// Default is the template of events not in Templates, if not set the email
+	// holds the notification as JSON
+	Default     *Template
+	Attachments AttachmentFunc
+	// Timeout limits the whole SMTP session, 30 seconds if not set
+	Timeout time.Duration
+}
+
+type SMTPNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	from        *mail.Address
+	templates   map[model.EventType]*template
+	fallback    *template
+	configErr   error
+	jsonMarshal func(v any, prefix, indent string) ([]byte, error)
+	dial        func(network, address string, timeout time.Duration) (net.Conn, error)
+	now         func() time.Time
+}
+
+var _ model.Notifier = (*SMTPNotifier)(nil)
+
+func New(config *Config) *SMTPNotifier {
+	return (&SMTPNotifier{}).New(config)
+}
+
+func (n *SMTPNotifier) New(config *Config) *SMTPNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.LocalName == "" {
+		config.LocalName = "localhost"
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.MarshalIndent
+	n.dial = net.DialTimeout
+	n.now = time.Now
+	n.configErr = n.parseConfig()
+
+	return n
+}
+
+// parseConfig checks the sender and parses the templates
+func (n *SMTPNotifier) parseConfig() error {
+	var err error
+
+	if n.from, err = mail.ParseAddress(n.From); err != nil {
+		return fmt.Errorf("parsing from address: %w", err)
+	}
+
+	switch n.Security {
+	case SecurityNone, SecuritySTARTTLS, SecurityImplicit:
+	default:
+		return fmt.Errorf("unsupported security %q", n.Security)
+	}
+
+	n.templates = make(map[model.EventType]*template, len(n.Templates))
+	for event, t := range n.Templates {
+		if n.templates[event], err = t.parse(string(event)); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if n.fallback, err = n.Default.parse("default"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *SMTPNotifier) Type() string {
+	return "smtp"
+}
+
+func (n *SMTPNotifier) Name() string {
+	return n.Config.Name
+}
+
+func (n *SMTPNotifier) Connect() error {
+	return n.configErr
+}
+
+// Close does nothing, a connection is opened for each email
+func (n *SMTPNotifier) Close() error {
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *SMTPNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *SMTPNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *SMTPNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver emails a notification
+func (n *SMTPNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	to, cc, bcc, err := n.recipients(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	content, err := n.render(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	var attachments []Attachment
+	if n.Attachments != nil {
+		if attachments, err = n.Attachments(message); err != nil {
+			return &model.Result{Success: false, Error: fmt.Errorf("getting attachments: %w", err)}
+		}
+	}
+
+	data, err := n.compose(message, to, cc, content, attachments)
+	if err != nil {
+		return &model.Result{Success: false, Error: fmt.Errorf("composing email: %w", err)}
+	}
+
+	if err := n.send(addresses(to, cc, bcc), data); err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	// the server took responsibility for the email
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+// recipients returns the recipients of the notification, from its metadata
+// or the config
+func (n *SMTPNotifier) recipients(message *model.Notification) (to, cc, bcc []*mail.Address, err error) {
+	lists := [][]string{n.To, n.Cc, n.Bcc}
+
+	if _, ok := message.Metadata[MetadataTo]; ok {
+		lists = [][]string{{message.Metadata[MetadataTo]}, {message.Metadata[MetadataCc]}, {message.Metadata[MetadataBcc]}}
+	}
+
+	parsed := make([][]*mail.Address, len(lists))
+	for i, list := range lists {
+		for _, l := range list {
+			if l == "" {
+				continue
+			}
+
+			addresses, err := mail.ParseAddressList(l)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parsing recipients: %w", err)
+			}
+
+			parsed[i] = append(parsed[i], addresses...)
+		}
+	}
+
+	if len(parsed[0])+len(parsed[1])+len(parsed[2]) == 0 {
+		return nil, nil, nil, fmt.Errorf("no recipients")
+	}
+
+	return parsed[0], parsed[1], parsed[2], nil
+}
+
+// addresses returns the envelope addresses of the recipients
+func addresses(lists ...[]*mail.Address) []string {
+	var result []string
+	for _, list := range lists {
+		for _, a := range list {
+			result = append(result, a.Address)
+		}
+	}
+
+	return result
+}
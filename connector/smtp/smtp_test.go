@@ -0,0 +1,234 @@
+package smtp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "ok",
+			config: &Config{From: "Notifier <notifier@example.com>", Templates: map[model.EventType]*Template{"test": {Subject: "{{.Event}}", Text: "{{.Data}}"}}},
+		},
+		{
+			name:       "fail-from",
+			config:     &Config{From: "not an address"},
+			wantErrMsg: "parsing from address",
+		},
+		{
+			name:       "fail-security",
+			config:     &Config{From: "notifier@example.com", Security: "ssl"},
+			wantErrMsg: `unsupported security "ssl"`,
+		},
+		{
+			name:       "fail-template",
+			config:     &Config{From: "notifier@example.com", Templates: map[model.EventType]*Template{"test": {Subject: "{{.Event", Text: "test"}}},
+			wantErrMsg: "parsing test subject template",
+		},
+		{
+			name:       "fail-default-without-body",
+			config:     &Config{From: "notifier@example.com", Default: &Template{Subject: "test"}},
+			wantErrMsg: "template default without body",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^smtp[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "smtp", n.Type())
+			assert.NotNil(t, n.GetChannel())
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				r := n.Deliver(&model.Notification{Event: "test"})
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestSMTPNotifier_Deliver(t *testing.T) {
+	var (
+		insecure = &utils.TLSOptions{InsecureSkipVerify: true}
+		plain    = &utils.SASL{Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "secret"}}
+
+		tests = []struct {
+			name       string
+			implicit   bool
+			starttls   bool
+			config     *Config
+			message    *model.Notification
+			wantTo     []string
+			wantUser   string
+			wantTLS    bool
+			wantErrMsg string
+		}{
+			{
+				name:    "plain",
+				config:  &Config{To: []string{"ops@example.com"}},
+				message: &model.Notification{Event: "test"},
+				wantTo:  []string{"ops@example.com"},
+			},
+			{
+				name:     "starttls-auth-plain",
+				starttls: true,
+				config:   &Config{Security: SecuritySTARTTLS, TLS: insecure, Auth: plain, To: []string{"ops@example.com"}},
+				message:  &model.Notification{Event: "test"},
+				wantTo:   []string{"ops@example.com"},
+				wantUser: "user",
+				wantTLS:  true,
+			},
+			{
+				name:     "implicit-auth-login",
+				implicit: true,
+				config: &Config{
+					Security: SecurityImplicit,
+					TLS:      insecure,
+					Auth:     &utils.SASL{Mechanism: utils.SASLLogin, Username: utils.Secret{Value: "user"}, Password: utils.Secret{Value: "secret"}},
+					To:       []string{"ops@example.com"},
+				},
+				message:  &model.Notification{Event: "test"},
+				wantTo:   []string{"ops@example.com"},
+				wantUser: "user",
+				wantTLS:  true,
+			},
+			{
+				name:   "recipients-from-metadata",
+				config: &Config{To: []string{"ops@example.com"}},
+				message: &model.Notification{
+					Event: "test",
+					Metadata: map[string]string{
+						MetadataTo:  "Alice <alice@example.com>, bob@example.com",
+						MetadataBcc: "audit@example.com",
+					},
+				},
+				wantTo: []string{"alice@example.com", "bob@example.com", "audit@example.com"},
+			},
+			{
+				name:       "fail-starttls-unsupported",
+				config:     &Config{Security: SecuritySTARTTLS, TLS: insecure, To: []string{"ops@example.com"}},
+				message:    &model.Notification{Event: "test"},
+				wantErrMsg: "server doesn't support STARTTLS",
+			},
+			{
+				name:       "fail-auth",
+				starttls:   true,
+				config:     &Config{Security: SecuritySTARTTLS, TLS: insecure, Auth: &utils.SASL{Username: utils.Secret{Value: "user"}}, To: []string{"ops@example.com"}},
+				message:    &model.Notification{Event: "test"},
+				wantErrMsg: `authenticating: 535 "authentication failed"`,
+			},
+			{
+				name:       "fail-auth-mechanism",
+				config:     &Config{Auth: &utils.SASL{Mechanism: utils.SASLExternal}, To: []string{"ops@example.com"}},
+				message:    &model.Notification{Event: "test"},
+				wantErrMsg: `unsupported SASL mechanism "EXTERNAL"`,
+			},
+			{
+				name:       "fail-recipient",
+				config:     &Config{To: []string{"ops@example.com", "reject@example.com"}},
+				message:    &model.Notification{Event: "test"},
+				wantErrMsg: `adding recipient reject@example.com: 550 "no such user"`,
+			},
+			{
+				name:       "fail-no-recipients",
+				config:     &Config{},
+				message:    &model.Notification{Event: "test"},
+				wantErrMsg: "no recipients",
+			},
+			{
+				name:       "fail-parse-recipients",
+				config:     &Config{},
+				message:    &model.Notification{Event: "test", Metadata: map[string]string{MetadataTo: "not an address"}},
+				wantErrMsg: "parsing recipients",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, tt.implicit, tt.starttls)
+
+			tt.config.Address = server.Addr()
+			tt.config.From = "Notifier <notifier@example.com>"
+			tt.config.Logger = log.New(&bytes.Buffer{}, "test:", log.LstdFlags)
+
+			r := New(tt.config).Deliver(tt.message)
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				assert.Empty(t, server.received())
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.True(t, r.Acknowledged)
+
+			mails := server.received()
+			if !assert.Len(t, mails, 1) {
+				return
+			}
+
+			assert.Equal(t, "notifier@example.com", mails[0].from)
+			assert.Equal(t, tt.wantTo, mails[0].to)
+			assert.Equal(t, tt.wantUser, mails[0].user)
+			assert.Equal(t, tt.wantTLS, mails[0].tls)
+
+			// blind copies aren't in the headers
+			msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+			if assert.NoError(t, err) {
+				assert.NotContains(t, msg.Header.Get("To")+msg.Header.Get("Cc"), "audit@example.com")
+			}
+		})
+	}
+}
+
+func TestSMTPNotifier_DeliverAttachments(t *testing.T) {
+	server := newFakeServer(t, false, false)
+
+	n := New(&Config{
+		Address: server.Addr(),
+		From:    "notifier@example.com",
+		To:      []string{"ops@example.com"},
+		Attachments: func(m *model.Notification) ([]Attachment, error) {
+			if m.Event == "fail" {
+				return nil, fmt.Errorf("test-Attachments-error")
+			}
+			return []Attachment{{Filename: "notification.txt", Data: []byte(m.ID)}}, nil
+		},
+	})
+
+	r := n.Deliver(&model.Notification{ID: "abc", Event: "test"})
+	assert.NoError(t, r.Error)
+
+	if mails := server.received(); assert.Len(t, mails, 1) {
+		assert.Contains(t, mails[0].data, `Content-Disposition: attachment; filename=notification.txt`)
+	}
+
+	r = n.Deliver(&model.Notification{ID: "abc", Event: "fail"})
+	assert.ErrorContains(t, r.Error, "getting attachments: test-Attachments-error")
+}
@@ -0,0 +1,111 @@
+package smtp
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Template holds the templates rendered against a notification to build its
+// email. Text and HTML are both optional, the email is multipart when both
+// are set
+type Template struct {
+	Subject string
+	Text    string
+	// HTML is rendered with html/template, escaping the notification fields
+	HTML string
+}
+
+// template is a parsed Template
+type template struct {
+	subject *utils.Template
+	text    *utils.Template
+	html    *htmltemplate.Template
+}
+
+// content is the rendered email
+type content struct {
+	subject string
+	text    string
+	html    string
+}
+
+func (t *Template) parse(name string) (*template, error) {
+	var (
+		result = &template{}
+		err    error
+	)
+
+	if t.Text == "" && t.HTML == "" {
+		return nil, fmt.Errorf("template %s without body", name)
+	}
+
+	if result.subject, err = utils.ParseTemplate(name+".subject", t.Subject); err != nil {
+		return nil, fmt.Errorf("parsing %s subject template: %w", name, err)
+	}
+
+	if t.Text != "" {
+		if result.text, err = utils.ParseTemplate(name+".text", t.Text); err != nil {
+			return nil, fmt.Errorf("parsing %s text template: %w", name, err)
+		}
+	}
+
+	if t.HTML != "" {
+		if result.html, err = htmltemplate.New(name + ".html").Option("missingkey=error").Parse(t.HTML); err != nil {
+			return nil, fmt.Errorf("parsing %s html template: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (t *template) render(message *model.Notification) (*content, error) {
+	var (
+		result = &content{}
+		err    error
+	)
+
+	if result.subject, err = t.subject.Render(message); err != nil {
+		return nil, fmt.Errorf("rendering subject: %w", err)
+	}
+
+	if t.text != nil {
+		if result.text, err = t.text.Render(message); err != nil {
+			return nil, fmt.Errorf("rendering text: %w", err)
+		}
+	}
+
+	if t.html != nil {
+		var sb strings.Builder
+		if err := t.html.Execute(&sb, message); err != nil {
+			return nil, fmt.Errorf("rendering html: %w", err)
+		}
+
+		result.html = sb.String()
+	}
+
+	return result, nil
+}
+
+// render builds the email of the notification with the template of its
+// event, the notification is sent as JSON if there is none
+func (n *SMTPNotifier) render(message *model.Notification) (*content, error) {
+	t, ok := n.templates[message.Event]
+	if !ok {
+		t = n.fallback
+	}
+
+	if t != nil {
+		return t.render(message)
+	}
+
+	payload, err := n.jsonMarshal(message, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return &content{subject: string(message.Event), text: string(payload)}, nil
+}
@@ -0,0 +1,93 @@
+package smtp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPNotifier_render(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:    "abc",
+			Event: "orders.created",
+			Data:  map[string]any{"customer": "<Alice>"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			marshal    func(v any, prefix, indent string) ([]byte, error)
+			want       *content
+			wantErrMsg string
+		}{
+			{
+				name: "event-template",
+				config: &Config{
+					Templates: map[model.EventType]*Template{
+						"orders.created": {
+							Subject: "Order {{.ID}}",
+							Text:    "Hi {{.Data.customer}}",
+							HTML:    "<p>Hi {{.Data.customer}}</p>",
+						},
+					},
+					Default: &Template{Subject: "default", Text: "default"},
+				},
+				want: &content{subject: "Order abc", text: "Hi <Alice>", html: "<p>Hi &lt;Alice&gt;</p>"},
+			},
+			{
+				name:   "default-template",
+				config: &Config{Default: &Template{Subject: "{{.Event}}", HTML: "<b>{{.ID}}</b>"}},
+				want:   &content{subject: "orders.created", html: "<b>abc</b>"},
+			},
+			{
+				name:    "json",
+				config:  &Config{},
+				marshal: func(v any, prefix, indent string) ([]byte, error) { return []byte("test-json"), nil },
+				want:    &content{subject: "orders.created", text: "test-json"},
+			},
+			{
+				name:       "fail-json",
+				config:     &Config{},
+				marshal:    func(v any, prefix, indent string) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+				wantErrMsg: "test-Marshal-error",
+			},
+			{
+				name:       "fail-subject",
+				config:     &Config{Default: &Template{Subject: "{{.Data.region}}", Text: "test"}},
+				wantErrMsg: `rendering subject: template: default.subject:1:7: executing "default.subject" at <.Data.region>: map has no entry for key "region"`,
+			},
+			{
+				name:       "fail-html",
+				config:     &Config{Default: &Template{Subject: "test", HTML: "{{.Data.region}}"}},
+				wantErrMsg: "rendering html",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.From = "notifier@example.com"
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			got, err := n.render(message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
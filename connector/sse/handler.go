@@ -0,0 +1,177 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+)
+
+// EventsParam is the query parameter listing the events a client wants,
+// comma separated or repeated. A trailing * matches a prefix, e.g.
+// ?events=orders.*,users.deleted
+const EventsParam = "events"
+
+// client is a connected browser
+type client struct {
+	addr   string
+	events []string
+	queue  chan *event
+	// gone is closed when the client is disconnected by the notifier
+	gone chan struct{}
+}
+
+// wants tells whether the client asked for the event, every event is sent
+// when it didn't ask for any
+func (c *client) wants(event model.EventType) bool {
+	if len(c.events) == 0 {
+		return true
+	}
+
+	for _, e := range c.events {
+		if strings.HasSuffix(e, "*") {
+			if strings.HasPrefix(string(event), e[:len(e)-1]) {
+				return true
+			}
+			continue
+		}
+
+		if e == string(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServeHTTP streams the notifications to a client until it disconnects, the
+// notifier is closed or the client falls behind
+func (n *SSENotifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := &client{
+		addr:   r.RemoteAddr,
+		events: parseEvents(r.URL.Query()[EventsParam]),
+		queue:  make(chan *event, n.BufferSize),
+		gone:   make(chan struct{}),
+	}
+
+	// the replayed events and the queue don't overlap as both are taken
+	// under the lock
+	n.lock.Lock()
+	select {
+	case <-n.done:
+		n.lock.Unlock()
+		http.Error(w, "notifier closed", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	n.clients[c] = struct{}{}
+	replay := n.since(c, r.Header.Get("Last-Event-ID"))
+	n.lock.Unlock()
+
+	defer func() {
+		n.lock.Lock()
+		n.evict(c)
+		n.lock.Unlock()
+	}()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+
+	if n.AllowOrigin != "" {
+		h.Set("Access-Control-Allow-Origin", n.AllowOrigin)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	var (
+		rc    = http.NewResponseController(w)
+		first = ""
+	)
+
+	if n.Retry > 0 {
+		first = fmt.Sprintf("retry: %d\n\n", n.Retry.Milliseconds())
+	}
+
+	if err := n.write(rc, w, []byte(first)); err != nil {
+		return
+	}
+
+	for _, e := range replay {
+		if err := n.write(rc, w, e.encode()); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(n.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var data []byte
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.gone:
+			return
+		case <-n.done:
+			return
+		case <-heartbeat.C:
+			data = []byte(": heartbeat\n\n")
+		case e := <-c.queue:
+			data = e.encode()
+		}
+
+		if err := n.write(rc, w, data); err != nil {
+			n.Logger.Printf("%s: writing to client %s: %v", n.Name(), c.addr, err)
+			return
+		}
+	}
+}
+
+// write sends data to the client, limited by the write timeout when the
+// server supports it
+func (n *SSENotifier) write(rc *http.ResponseController, w http.ResponseWriter, data []byte) error {
+	err := rc.SetWriteDeadline(time.Now().Add(n.WriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return rc.Flush()
+}
+
+// parseEvents returns the events listed in the query parameter values
+func parseEvents(values []string) []string {
+	var events []string
+
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				events = append(events, e)
+			}
+		}
+	}
+
+	return events
+}
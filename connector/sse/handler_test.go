@@ -0,0 +1,266 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// received is an event or comment read from the stream
+type received struct {
+	id      string
+	event   string
+	data    string
+	comment string
+	retry   string
+}
+
+// subscribe connects to the stream, the client is registered once it returns
+func subscribe(t *testing.T, url, lastID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res, bufio.NewReader(res.Body)
+}
+
+// next reads the next event or comment
+func next(t *testing.T, r *bufio.Reader) received {
+	t.Helper()
+
+	var got received
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return got
+		}
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "":
+			got.comment = value
+		case "id":
+			got.id = value
+		case "event":
+			got.event = value
+		case "data":
+			got.data = value
+		case "retry":
+			got.retry = value
+		}
+	}
+}
+
+func TestSSENotifier_ServeHTTP(t *testing.T) {
+	var (
+		n      = New(&Config{Retry: 3 * time.Second, AllowOrigin: "*"})
+		server = httptest.NewServer(n)
+	)
+
+	defer server.Close()
+	defer n.Close()
+
+	res, stream := subscribe(t, server.URL+"?events=orders.*&events=users.deleted", "")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	assert.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, received{retry: "3000"}, next(t, stream))
+
+	_, all := subscribe(t, server.URL, "")
+	next(t, all)
+	assert.Equal(t, 2, n.Clients())
+
+	for _, event := range []model.EventType{"orders.created", "users.created", "users.deleted"} {
+		n.Deliver(&model.Notification{ID: "id-" + string(event), Event: event})
+	}
+
+	got := next(t, stream)
+	assert.Equal(t, n.epoch+"-1", got.id)
+	assert.Equal(t, "orders.created", got.event)
+
+	var data model.Notification
+	assert.NoError(t, json.Unmarshal([]byte(got.data), &data))
+	assert.Equal(t, "id-orders.created", data.ID)
+
+	// users.created is filtered out
+	got = next(t, stream)
+	assert.Equal(t, n.epoch+"-3", got.id)
+	assert.Equal(t, "users.deleted", got.event)
+
+	for _, want := range []string{"1", "2", "3"} {
+		assert.Equal(t, n.epoch+"-"+want, next(t, all).id)
+	}
+
+	// closing disconnects every client
+	assert.NoError(t, n.Close())
+	_, err := stream.ReadString('\n')
+	assert.Error(t, err)
+	assert.Equal(t, 0, n.Clients())
+
+	res, err = http.Get(server.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		res.Body.Close()
+	}
+}
+
+func TestSSENotifier_ServeHTTPResume(t *testing.T) {
+	var (
+		n      = New(&Config{ReplaySize: 10})
+		server = httptest.NewServer(n)
+	)
+
+	defer server.Close()
+	defer n.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		n.Deliver(&model.Notification{ID: id, Event: "orders.created"})
+	}
+
+	// the events after the last one seen are replayed before new ones
+	_, stream := subscribe(t, server.URL, n.epoch+"-1")
+	n.Deliver(&model.Notification{ID: "d", Event: "orders.created"})
+
+	for _, want := range []string{"2", "3", "4"} {
+		assert.Equal(t, n.epoch+"-"+want, next(t, stream).id)
+	}
+
+	// after a restart the sequence starts over, the whole buffer is replayed
+	var (
+		restarted = New(&Config{ReplaySize: 10})
+		other     = httptest.NewServer(restarted)
+	)
+
+	defer other.Close()
+	defer restarted.Close()
+
+	for _, id := range []string{"e", "f"} {
+		restarted.Deliver(&model.Notification{ID: id, Event: "orders.created"})
+	}
+
+	_, stream = subscribe(t, other.URL, n.epoch+"-4")
+	for _, want := range []string{"1", "2"} {
+		assert.Equal(t, restarted.epoch+"-"+want, next(t, stream).id)
+	}
+}
+
+func TestSSENotifier_ServeHTTPHeartbeat(t *testing.T) {
+	var (
+		n      = New(&Config{Heartbeat: 10 * time.Millisecond})
+		server = httptest.NewServer(n)
+	)
+
+	defer server.Close()
+	defer n.Close()
+
+	_, stream := subscribe(t, server.URL, "")
+	assert.Equal(t, received{comment: "heartbeat"}, next(t, stream))
+}
+
+func TestSSENotifier_ServeHTTPMethod(t *testing.T) {
+	var (
+		n   = New(nil)
+		rec = httptest.NewRecorder()
+	)
+
+	n.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Allow"))
+}
+
+// blockingWriter blocks writes until released, like a client not reading
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	if len(data) > 0 {
+		w.once.Do(func() { close(w.writing) })
+		<-w.release
+	}
+
+	return len(data), nil
+}
+
+func TestSSENotifier_ServeHTTPSlowClient(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		lock sync.Mutex
+		n    = New(&Config{BufferSize: 1, Logger: log.New(&lockedWriter{w: &buf, lock: &lock}, "", 0)})
+		w    = &blockingWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			writing:          make(chan struct{}),
+			release:          make(chan struct{}),
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+
+	defer cancel()
+
+	go func() {
+		n.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return n.Clients() == 1 }, time.Second, time.Millisecond)
+
+	// the first event blocks the handler, the second fills the queue
+	n.Deliver(&model.Notification{ID: "a"})
+	<-w.writing
+	n.Deliver(&model.Notification{ID: "b"})
+	assert.Equal(t, 1, n.Clients())
+
+	r := n.Deliver(&model.Notification{ID: "c"})
+	assert.True(t, r.Success)
+	assert.Equal(t, 0, n.Clients())
+
+	close(w.release)
+	<-done
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Contains(t, buf.String(), "disconnecting slow client")
+}
+
+type lockedWriter struct {
+	w    *bytes.Buffer
+	lock *sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.w.Write(p)
+}
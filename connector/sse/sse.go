@@ -0,0 +1,276 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// ReplaySize is how many events are kept for clients resuming with
+	// Last-Event-ID, 100 if not set
+	ReplaySize int
+	// BufferSize is how many events are queued for a client, clients falling
+	// further behind are disconnected, 16 if not set
+	BufferSize int
+	// Heartbeat is the interval between comments keeping idle connections
+	// open through proxies, 15 seconds if not set
+	Heartbeat time.Duration
+	// WriteTimeout disconnects clients not reading, 10 seconds if not set
+	WriteTimeout time.Duration
+	// Retry tells browsers how long to wait before reconnecting, left to
+	// them if not set
+	Retry time.Duration
+	// AllowOrigin is sent as Access-Control-Allow-Origin for dashboards
+	// served from other origins
+	AllowOrigin string
+}
+
+// event is an encoded notification with its position in the stream, ids
+// are sent as <epoch>-<id> so clients resuming after a restart are told
+// apart from the ones resuming from this instance
+type event struct {
+	epoch string
+	id    uint64
+	event model.EventType
+	data  []byte
+}
+
+// SSENotifier implements the Notifier interface streaming notifications to
+// the clients connected to its http.Handler
+type SSENotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	jsonMarshal func(v any) ([]byte, error)
+
+	lock      sync.Mutex
+	clients   map[*client]struct{}
+	replay    []*event
+	epoch     string
+	sequence  uint64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ model.Notifier = (*SSENotifier)(nil)
+
+func New(config *Config) *SSENotifier {
+	return (&SSENotifier{}).New(config)
+}
+
+func (n *SSENotifier) New(config *Config) *SSENotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.ReplaySize == 0 {
+		config.ReplaySize = 100
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = 16
+	}
+
+	if config.Heartbeat == 0 {
+		config.Heartbeat = 15 * time.Second
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.jsonMarshal = json.Marshal
+	n.clients = make(map[*client]struct{})
+	n.epoch = utils.RandomId(utils.ID8)
+	n.done = make(chan struct{})
+
+	return n
+}
+
+func (n *SSENotifier) Type() string {
+	return "sse"
+}
+
+func (n *SSENotifier) Name() string {
+	return n.Config.Name
+}
+
+// Connect does nothing, clients connect to the handler
+func (n *SSENotifier) Connect() error {
+	return nil
+}
+
+// Close disconnects every client, the handler refuses new ones
+func (n *SSENotifier) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for c := range n.clients {
+		n.evict(c)
+	}
+
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *SSENotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *SSENotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *SSENotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver queues a notification for the connected clients interested in its
+// event and keeps it for the ones resuming later, clients with a full queue
+// are disconnected
+func (n *SSENotifier) Deliver(message *model.Notification) *model.Result {
+	// a line break would end the event field and inject others
+	if strings.ContainsAny(string(message.Event), "\r\n") {
+		return &model.Result{Success: false, Error: fmt.Errorf("event type %q contains a line break", message.Event)}
+	}
+
+	data, err := n.jsonMarshal(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	select {
+	case <-n.done:
+		return &model.Result{Success: false, Error: errors.New("notifier closed")}
+	default:
+	}
+
+	n.sequence++
+	e := &event{epoch: n.epoch, id: n.sequence, event: message.Event, data: data}
+
+	n.replay = append(n.replay, e)
+	if len(n.replay) > n.ReplaySize {
+		n.replay = n.replay[len(n.replay)-n.ReplaySize:]
+	}
+
+	for c := range n.clients {
+		if !c.wants(e.event) {
+			continue
+		}
+
+		select {
+		case c.queue <- e:
+		default:
+			n.Logger.Printf("%s: disconnecting slow client %s", n.Name(), c.addr)
+			n.evict(c)
+		}
+	}
+
+	// browsers don't acknowledge events, missed ones are replayed on resume
+	return &model.Result{Success: true}
+}
+
+// Clients returns the number of connected clients
+func (n *SSENotifier) Clients() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return len(n.clients)
+}
+
+// since returns the kept events after the given id the client wants, all of
+// them when the id is unknown, no longer kept or from another instance. The
+// lock must be held
+func (n *SSENotifier) since(c *client, lastID string) []*event {
+	if lastID == "" {
+		return nil
+	}
+
+	var id uint64
+	if epoch, seq, ok := strings.Cut(lastID, "-"); ok && epoch == n.epoch {
+		id, _ = strconv.ParseUint(seq, 10, 64)
+	}
+
+	var events []*event
+	for _, e := range n.replay {
+		if e.id > id && c.wants(e.event) {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// evict disconnects a client, the lock must be held
+func (n *SSENotifier) evict(c *client) {
+	if _, ok := n.clients[c]; ok {
+		delete(n.clients, c)
+		close(c.gone)
+	}
+}
+
+// encode formats an event for the stream, data spanning several lines is
+// sent as several data fields
+func (e *event) encode() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "id: %s-%d\n", e.epoch, e.id)
+
+	if e.event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", e.event)
+	}
+
+	for _, line := range bytes.Split(e.data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
@@ -0,0 +1,114 @@
+package sse
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSENotifier_New(t *testing.T) {
+	n := New(nil)
+
+	assert.Regexp(t, regexp.MustCompile(`^sse[abcdef0-9]{8}`), n.Name())
+	assert.Equal(t, "sse", n.Type())
+	assert.Equal(t, 100, n.ReplaySize)
+	assert.Equal(t, 16, n.BufferSize)
+	assert.Equal(t, 15*time.Second, n.Heartbeat)
+	assert.Equal(t, 10*time.Second, n.WriteTimeout)
+	assert.NotNil(t, n.GetChannel())
+	assert.NoError(t, n.Connect())
+}
+
+func TestSSENotifier_Deliver(t *testing.T) {
+	n := New(&Config{ReplaySize: 3})
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		r := n.Deliver(&model.Notification{ID: id, Event: "orders.created"})
+		assert.NoError(t, r.Error)
+		assert.True(t, r.Success)
+		assert.False(t, r.Acknowledged)
+	}
+
+	// only the last events are kept
+	var ids []uint64
+	for _, e := range n.replay {
+		ids = append(ids, e.id)
+	}
+	assert.Equal(t, []uint64{3, 4, 5}, ids)
+
+	r := n.Deliver(&model.Notification{ID: "f", Event: "orders.created\nevent: users.deleted"})
+	assert.False(t, r.Success)
+	assert.EqualError(t, r.Error, `event type "orders.created\nevent: users.deleted" contains a line break`)
+	assert.Len(t, n.replay, 3)
+
+	assert.NoError(t, n.Close())
+	assert.EqualError(t, n.Deliver(&model.Notification{ID: "f"}).Error, "notifier closed")
+}
+
+func TestSSENotifier_since(t *testing.T) {
+	var (
+		n = New(&Config{ReplaySize: 3})
+		c = &client{events: []string{"orders.*"}}
+	)
+
+	for _, event := range []model.EventType{"orders.created", "users.created", "orders.shipped", "orders.paid"} {
+		n.Deliver(&model.Notification{Event: event})
+	}
+
+	tests := []struct {
+		name    string
+		lastID  string
+		wantIDs []uint64
+	}{
+		{name: "new-client", lastID: ""},
+		{name: "resume", lastID: n.epoch + "-3", wantIDs: []uint64{4}},
+		{name: "up-to-date", lastID: n.epoch + "-4"},
+		// event 1 is no longer kept, everything kept is sent
+		{name: "too-old", lastID: n.epoch + "-0", wantIDs: []uint64{3, 4}},
+		// the client saw event 4 of a previous instance, not this one
+		{name: "other-epoch", lastID: "0badcafe-4", wantIDs: []uint64{3, 4}},
+		{name: "no-epoch", lastID: "4", wantIDs: []uint64{3, 4}},
+		{name: "unknown", lastID: n.epoch + "-abc", wantIDs: []uint64{3, 4}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []uint64
+			for _, e := range n.since(c, tt.lastID) {
+				ids = append(ids, e.id)
+			}
+
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestEvent_encode(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *event
+		want  string
+	}{
+		{
+			name:  "event",
+			event: &event{epoch: "0badcafe", id: 7, event: "orders.created", data: []byte(`{"ID":"abc"}`)},
+			want:  "id: 0badcafe-7\nevent: orders.created\ndata: {\"ID\":\"abc\"}\n\n",
+		},
+		{
+			name:  "no-event-multiline",
+			event: &event{epoch: "0badcafe", id: 8, data: []byte("a\nb")},
+			want:  "id: 0badcafe-8\ndata: a\ndata: b\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(tt.event.encode()))
+		})
+	}
+}
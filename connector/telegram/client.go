@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/padiazg/notifier/utils"
+)
+
+// apiResponse is the response of the Bot API methods
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// send calls sendMessage with the payload, waiting as told by Telegram when
+// rate limited
+func (n *TelegramNotifier) send(payload []byte) error {
+	return utils.RetryRateLimited(n.MaxRetries, n.sleep, func() error {
+		r, err := n.do(payload)
+		if err != nil {
+			return err
+		}
+
+		if r.ErrorCode == http.StatusTooManyRequests {
+			return &utils.RateLimitedError{Wait: time.Duration(r.Parameters.RetryAfter) * time.Second}
+		}
+
+		if !r.OK {
+			return fmt.Errorf("telegram API error: %d %s", r.ErrorCode, r.Description)
+		}
+
+		return nil
+	})
+}
+
+// do sends a request with the payload, decoding the response
+func (n *TelegramNotifier) do(payload []byte) (*apiResponse, error) {
+	token, err := n.Token.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolving token: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(n.BaseURL, "/") + "/bot" + token + "/sendMessage"
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// the URL holds the token, keep it out of the error
+		return nil, fmt.Errorf("sending request: %w", utils.UnwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var r apiResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("telegram API returned non-OK status: %d", resp.StatusCode)
+	}
+
+	return &r, nil
+}
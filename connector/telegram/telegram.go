@@ -0,0 +1,239 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+const (
+	defaultBaseURL = "https://api.telegram.org"
+	// MaxLength is the length limit of a message, longer ones are split
+	MaxLength = 4096
+)
+
+// Parse modes of the text of messages
+const (
+	ParseModeNone       = ""
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeMarkdown   = "Markdown"
+	ParseModeHTML       = "HTML"
+)
+
+type Config struct {
+	Logger *log.Logger
+	Name   string
+	// Token is the bot token
+	Token utils.Secret
+	// BaseURL is the Bot API URL, https://api.telegram.org if not set
+	BaseURL string
+	// Chats maps event types to the chat their messages are sent to, a
+	// numeric ID or the @username of a channel
+	Chats map[model.EventType]string
+	// DefaultChat receives the notifications of events not in Chats
+	DefaultChat string
+	// ParseMode is how the text of templates is formatted, one of
+	// MarkdownV2, Markdown, HTML or plain text if not set
+	ParseMode string
+	// Templates maps event types to the template of their messages
+	Templates map[model.EventType]*Template
+	// Default is the template of events not in Templates, if not set the
+	// message holds the notification data as JSON in plain text
+	Default *Template
+	// Silent sends every message without sound
+	Silent bool
+	// MaxRetries is how many times a rate limited message is retried, 3 if
+	// not set, negative to never retry
+	MaxRetries int
+	// Timeout limits each request, 10 seconds if not set
+	Timeout time.Duration
+}
+
+type TelegramNotifier struct {
+	*Config
+	Channel     chan *model.Notification
+	client      *http.Client
+	templates   map[model.EventType]*template
+	fallback    *template
+	configErr   error
+	jsonMarshal func(v any) ([]byte, error)
+	sleep       func(d time.Duration)
+}
+
+var _ model.Notifier = (*TelegramNotifier)(nil)
+
+func New(config *Config) *TelegramNotifier {
+	return (&TelegramNotifier{}).New(config)
+}
+
+func (n *TelegramNotifier) New(config *Config) *TelegramNotifier {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Name == "" {
+		config.Name = n.Type() + utils.RandomId(utils.ID8)
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = defaultBaseURL
+	}
+
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	n.Config = config
+	n.Channel = make(chan *model.Notification)
+	n.client = &http.Client{Timeout: config.Timeout}
+	n.jsonMarshal = json.Marshal
+	n.sleep = time.Sleep
+	n.configErr = n.parseConfig()
+
+	return n
+}
+
+// parseConfig checks the token and parse mode and parses the templates
+func (n *TelegramNotifier) parseConfig() error {
+	var err error
+
+	if n.Token == (utils.Secret{}) {
+		return fmt.Errorf("Token must be set")
+	}
+
+	switch n.ParseMode {
+	case ParseModeNone, ParseModeMarkdownV2, ParseModeMarkdown, ParseModeHTML:
+	default:
+		return fmt.Errorf("unsupported parse mode %q", n.ParseMode)
+	}
+
+	n.templates = make(map[model.EventType]*template, len(n.Templates))
+	for event, t := range n.Templates {
+		if n.templates[event], err = t.parse(string(event), n.ParseMode); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if n.fallback, err = n.Default.parse("default", n.ParseMode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *TelegramNotifier) Type() string {
+	return "telegram"
+}
+
+func (n *TelegramNotifier) Name() string {
+	return n.Config.Name
+}
+
+func (n *TelegramNotifier) Connect() error {
+	return n.configErr
+}
+
+func (n *TelegramNotifier) Close() error {
+	return nil
+}
+
+// Run starts receiving notifications
+func (n *TelegramNotifier) Run() {
+	for notification := range n.Channel {
+		r := n.Deliver(notification)
+		if !r.Success {
+			n.Logger.Printf("%s: %+v", n.Name(), r)
+		}
+	}
+}
+
+// GetChannel returns the channel used by the worker
+func (n *TelegramNotifier) GetChannel() chan *model.Notification {
+	return n.Channel
+}
+
+// Notify sends a notification to worker
+func (n *TelegramNotifier) Notify(payload *model.Notification) {
+	if n.Channel == nil {
+		n.Logger.Print("channel is nil")
+		return
+	}
+
+	if payload == nil {
+		n.Logger.Print("payload is nil")
+		return
+	}
+
+	n.Channel <- payload
+}
+
+// Deliver sends a notification to its chat, split in several messages if
+// longer than MaxLength. Formatted messages that can't be split keeping their
+// entities whole are sent as plain text
+func (n *TelegramNotifier) Deliver(message *model.Notification) *model.Result {
+	if n.configErr != nil {
+		return &model.Result{Success: false, Error: n.configErr}
+	}
+
+	chat := n.route(message.Event)
+	if chat == "" {
+		return &model.Result{Success: false, Error: fmt.Errorf("no chat for event %s", message.Event)}
+	}
+
+	msg, err := n.render(message)
+	if err != nil {
+		return &model.Result{Success: false, Error: err}
+	}
+
+	msg.ChatID = chat
+	msg.DisableNotification = msg.DisableNotification || n.Silent
+
+	parts, ok := split(msg.Text, msg.ParseMode, MaxLength)
+	if !ok {
+		msg.ParseMode = ParseModeNone
+		parts, _ = split(msg.Text, msg.ParseMode, MaxLength)
+	}
+	for i, text := range parts {
+		msg.Text = text
+
+		payload, err := n.jsonMarshal(msg)
+		if err != nil {
+			return &model.Result{Success: false, Error: err}
+		}
+
+		if err := n.send(payload); err != nil {
+			if len(parts) > 1 {
+				err = fmt.Errorf("sending part %d of %d: %w", i+1, len(parts), err)
+			}
+
+			return &model.Result{Success: false, Error: err}
+		}
+	}
+
+	return &model.Result{Success: true, Acknowledged: true}
+}
+
+// route returns the chat of the event
+func (n *TelegramNotifier) route(event model.EventType) string {
+	if chat, ok := n.Chats[event]; ok {
+		return chat
+	}
+
+	return n.DefaultChat
+}
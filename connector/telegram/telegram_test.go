@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeTelegram answers like sendMessage once the queued responses are used
+func newFakeTelegram(t *testing.T, responses ...func(w http.ResponseWriter)) *utils.TestServer {
+	t.Helper()
+
+	return utils.NewTestServer(t, func(w http.ResponseWriter, count int) {
+		fmt.Fprintf(w, `{"ok": true, "result": {"message_id": %d}}`, count)
+	}, responses...)
+}
+
+func rateLimited(seconds int) func(w http.ResponseWriter) {
+	return utils.TestRateLimited("", fmt.Sprintf(`{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after %d", "parameters": {"retry_after": %d}}`, seconds, seconds))
+}
+
+func TestTelegramNotifier_New(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErrMsg string
+	}{
+		{
+			name:   "success",
+			config: &Config{Token: utils.Secret{Value: "123:test"}, ParseMode: ParseModeHTML},
+		},
+		{
+			name:       "fail-token",
+			config:     &Config{},
+			wantErrMsg: "Token must be set",
+		},
+		{
+			name:       "fail-parse-mode",
+			config:     &Config{Token: utils.Secret{Value: "123:test"}, ParseMode: "markdown"},
+			wantErrMsg: `unsupported parse mode "markdown"`,
+		},
+		{
+			name: "fail-template-parse-mode",
+			config: &Config{
+				Token:     utils.Secret{Value: "123:test"},
+				Templates: map[model.EventType]*Template{"test": {Text: "test", ParseMode: "html"}},
+			},
+			wantErrMsg: `unsupported test parse mode "html"`,
+		},
+		{
+			name: "fail-template",
+			config: &Config{
+				Token:   utils.Secret{Value: "123:test"},
+				Default: &Template{Text: "{{.Event"},
+			},
+			wantErrMsg: "parsing default text template",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			assert.Regexp(t, regexp.MustCompile(`^telegram[abcdef0-9]{8}`), n.Name())
+			assert.Equal(t, "telegram", n.Type())
+			assert.Equal(t, defaultBaseURL, n.BaseURL)
+			assert.Equal(t, 3, n.MaxRetries)
+			assert.NotNil(t, n.GetChannel())
+
+			err := n.Connect()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				assert.ErrorContains(t, n.Deliver(&model.Notification{}).Error, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, n.Close())
+		})
+	}
+}
+
+func TestTelegramNotifier_Deliver(t *testing.T) {
+	var (
+		long = strings.Repeat("a", 3000) + "\n" + strings.Repeat("b", 3000)
+		bold = "<b>" + long + "</b>"
+
+		tests = []struct {
+			name       string
+			config     *Config
+			responses  []func(w http.ResponseWriter)
+			message    *model.Notification
+			want       []message
+			wantSleeps []time.Duration
+			wantErrMsg string
+		}{
+			{
+				name: "routed",
+				config: &Config{
+					DefaultChat: "-100",
+					Chats:       map[model.EventType]string{"orders.created": "@orders"},
+					ParseMode:   ParseModeHTML,
+					Default:     &Template{Text: "<b>{{.Event}}</b>"},
+				},
+				message: &model.Notification{Event: "orders.created"},
+				want:    []message{{ChatID: "@orders", Text: "<b>orders.created</b>", ParseMode: ParseModeHTML}},
+			},
+			{
+				name: "default-chat-silent",
+				config: &Config{
+					DefaultChat: "-100",
+					Chats:       map[model.EventType]string{"orders.created": "@orders"},
+					Silent:      true,
+					Default:     &Template{Text: "{{.Event}}"},
+				},
+				message: &model.Notification{Event: "users.deleted"},
+				want:    []message{{ChatID: "-100", Text: "users.deleted", DisableNotification: true}},
+			},
+			{
+				name:    "split",
+				config:  &Config{DefaultChat: "-100", Default: &Template{Text: "{{.Data}}"}},
+				message: &model.Notification{Event: "orders.created", Data: long},
+				want: []message{
+					{ChatID: "-100", Text: strings.Repeat("a", 3000)},
+					{ChatID: "-100", Text: strings.Repeat("b", 3000)},
+				},
+			},
+			{
+				name: "split-unbalanced-plain",
+				config: &Config{
+					DefaultChat: "-100",
+					ParseMode:   ParseModeHTML,
+					Default:     &Template{Text: "{{.Data}}"},
+				},
+				message: &model.Notification{Event: "orders.created", Data: bold},
+				want: []message{
+					{ChatID: "-100", Text: "<b>" + strings.Repeat("a", 3000)},
+					{ChatID: "-100", Text: strings.Repeat("b", 3000) + "</b>"},
+				},
+			},
+			{
+				name:       "rate-limited",
+				config:     &Config{DefaultChat: "-100", Default: &Template{Text: "{{.Event}}"}},
+				responses:  []func(w http.ResponseWriter){rateLimited(5), rateLimited(0)},
+				message:    &model.Notification{Event: "orders.created"},
+				want:       []message{{ChatID: "-100", Text: "orders.created"}},
+				wantSleeps: []time.Duration{5 * time.Second, time.Second},
+			},
+			{
+				name:       "fail-rate-limited",
+				config:     &Config{DefaultChat: "-100", MaxRetries: 1},
+				responses:  []func(w http.ResponseWriter){rateLimited(1), rateLimited(1)},
+				message:    &model.Notification{Event: "orders.created"},
+				wantSleeps: []time.Duration{time.Second},
+				wantErrMsg: "rate limited, gave up after 1 retries",
+			},
+			{
+				name:   "fail-api",
+				config: &Config{DefaultChat: "-100"},
+				responses: []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`)
+				}},
+				message:    &model.Notification{Event: "orders.created"},
+				wantErrMsg: "telegram API error: 400 Bad Request: chat not found",
+			},
+			{
+				name:   "fail-split",
+				config: &Config{DefaultChat: "-100", Default: &Template{Text: "{{.Data}}"}},
+				responses: []func(w http.ResponseWriter){
+					func(w http.ResponseWriter) { fmt.Fprint(w, `{"ok": true}`) },
+					func(w http.ResponseWriter) {
+						fmt.Fprint(w, `{"ok": false, "error_code": 400, "description": "Bad Request"}`)
+					},
+				},
+				message:    &model.Notification{Event: "orders.created", Data: long},
+				wantErrMsg: "sending part 2 of 2: telegram API error: 400 Bad Request",
+			},
+			{
+				name:   "fail-status",
+				config: &Config{DefaultChat: "-100"},
+				responses: []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusBadGateway)
+				}},
+				message:    &model.Notification{Event: "orders.created"},
+				wantErrMsg: "telegram API returned non-OK status: 502",
+			},
+			{
+				name:       "fail-no-chat",
+				config:     &Config{},
+				message:    &model.Notification{Event: "orders.created"},
+				wantErrMsg: "no chat for event orders.created",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				server = newFakeTelegram(t, tt.responses...)
+				sleeps []time.Duration
+			)
+
+			tt.config.BaseURL = server.URL + "/"
+			tt.config.Token = utils.Secret{Value: "123:test"}
+
+			n := New(tt.config)
+			n.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			r := n.Deliver(tt.message)
+			assert.Equal(t, tt.wantSleeps, sleeps)
+
+			if tt.wantErrMsg != "" {
+				assert.False(t, r.Success)
+				assert.ErrorContains(t, r.Error, tt.wantErrMsg)
+				assert.NotContains(t, r.Error.Error(), "123:test", "token leaked in the error")
+				return
+			}
+
+			assert.NoError(t, r.Error)
+			assert.True(t, r.Success)
+			assert.True(t, r.Acknowledged)
+
+			requests := server.Requests()
+			for _, r := range requests {
+				assert.Equal(t, "/bot123:test/sendMessage", r.URL.Path)
+			}
+
+			// rate limited attempts are left out
+			got := make([]message, len(tt.want))
+			for i := range got {
+				assert.NoError(t, server.DecodeBody(len(requests)-len(tt.want)+i, &got[i]))
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTelegramNotifier_DeliverUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	n := New(&Config{BaseURL: server.URL, Token: utils.Secret{Value: "123:secret"}, DefaultChat: "-100"})
+
+	r := n.Deliver(&model.Notification{Event: "orders.created"})
+	assert.ErrorContains(t, r.Error, "sending request:")
+	assert.NotContains(t, r.Error.Error(), "123:secret", "token leaked in the error")
+}
@@ -0,0 +1,299 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	tpl "text/template"
+	"unicode/utf8"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Template holds the template rendered against a notification to build its
+// message
+type Template struct {
+	// Text is the message, formatted as told by ParseMode. The escape func
+	// escapes values for the parse mode, e.g. *{{escape .Data.customer}}*
+	Text string
+	// ParseMode overrides the parse mode of the Config
+	ParseMode string
+	// Silent sends the message without sound
+	Silent bool
+}
+
+// template is a parsed Template
+type template struct {
+	text      *utils.Template
+	parseMode string
+	silent    bool
+}
+
+// message is the payload of sendMessage
+type message struct {
+	ChatID              string `json:"chat_id"`
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode,omitempty"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
+}
+
+// parse parses the template, parseMode is the one of the Config
+func (t *Template) parse(name, parseMode string) (*template, error) {
+	var (
+		result = &template{parseMode: t.ParseMode, silent: t.Silent}
+		err    error
+	)
+
+	switch t.ParseMode {
+	case ParseModeNone:
+		result.parseMode = parseMode
+	case ParseModeMarkdownV2, ParseModeMarkdown, ParseModeHTML:
+	default:
+		return nil, fmt.Errorf("unsupported %s parse mode %q", name, t.ParseMode)
+	}
+
+	funcs := tpl.FuncMap{"escape": escaper(result.parseMode)}
+	if result.text, err = utils.ParseTemplate(name+".text", t.Text, funcs); err != nil {
+		return nil, fmt.Errorf("parsing %s text template: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// render builds the message of the notification with the template of its
+// event, the data is sent as JSON in plain text if there is none
+func (n *TelegramNotifier) render(notification *model.Notification) (*message, error) {
+	t, ok := n.templates[notification.Event]
+	if !ok {
+		t = n.fallback
+	}
+
+	if t == nil {
+		data, err := n.jsonMarshal(notification.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return &message{Text: fmt.Sprintf("%s\n%s", notification.Event, data)}, nil
+	}
+
+	text, err := t.text.Render(notification)
+	if err != nil {
+		return nil, fmt.Errorf("rendering text: %w", err)
+	}
+
+	return &message{Text: text, ParseMode: t.parseMode, DisableNotification: t.silent}, nil
+}
+
+// escaper returns the func escaping values for the parse mode, so they are
+// shown as is instead of formatting the message
+func escaper(parseMode string) func(v any) string {
+	var replacer *strings.Replacer
+
+	switch parseMode {
+	case ParseModeMarkdownV2:
+		replacer = escapeReplacer(`\_*[]()~` + "`" + `>#+-=|{}.!`)
+	case ParseModeMarkdown:
+		replacer = escapeReplacer("_*[`")
+	case ParseModeHTML:
+		replacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	}
+
+	return func(v any) string {
+		text := fmt.Sprint(v)
+		if replacer == nil {
+			return text
+		}
+
+		return replacer.Replace(text)
+	}
+}
+
+// escapeReplacer prefixes each of chars with a backslash
+func escapeReplacer(chars string) *strings.Replacer {
+	var pairs []string
+	for _, c := range chars {
+		pairs = append(pairs, string(c), `\`+string(c))
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// split cuts text in parts of at most max characters at the last line break
+// of each part. Formatted text is only cut at line breaks no entity spans, so
+// each part is parsed on its own, ok is false when there is none. Plain text
+// without line breaks is cut anywhere
+func split(text, parseMode string, max int) (parts []string, ok bool) {
+	for utf8.RuneCountInString(text) > max {
+		// byte offset of the first character past the limit
+		cut, count := 0, 0
+		for i := range text {
+			if count == max {
+				cut = i
+				break
+			}
+			count++
+		}
+
+		if i := lastBefore(boundaries(text, parseMode), cut); i > 0 {
+			parts = append(parts, text[:i])
+			text = text[i+1:]
+			continue
+		}
+
+		if parseMode != ParseModeNone {
+			return nil, false
+		}
+
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+
+	return append(parts, text), true
+}
+
+// lastBefore returns the last of offsets before cut, -1 if none
+func lastBefore(offsets []int, cut int) int {
+	last := -1
+	for _, o := range offsets {
+		if o >= cut {
+			break
+		}
+		last = o
+	}
+
+	return last
+}
+
+// boundaries returns the byte offsets of the line breaks of text outside of
+// the entities of the parse mode
+func boundaries(text, parseMode string) []int {
+	switch parseMode {
+	case ParseModeHTML:
+		return htmlBoundaries(text)
+	case ParseModeMarkdownV2:
+		return markdownBoundaries(text, true)
+	case ParseModeMarkdown:
+		return markdownBoundaries(text, false)
+	}
+
+	var result []int
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
+
+// htmlBoundaries returns the line breaks outside of any tag, Telegram has no
+// void tags so every opening tag has a closing one
+func htmlBoundaries(text string) []int {
+	var (
+		result []int
+		depth  int
+	)
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				return result
+			}
+
+			if strings.HasPrefix(text[i:], "</") {
+				depth--
+			} else {
+				depth++
+			}
+
+			i += end
+		case '\n':
+			if depth == 0 {
+				result = append(result, i)
+			}
+		}
+	}
+
+	return result
+}
+
+// markdownBoundaries returns the line breaks outside of any entity, v2 tells
+// MarkdownV2 from the legacy Markdown with fewer entities
+func markdownBoundaries(text string, v2 bool) []int {
+	var (
+		result []int
+		// open holds the delimiters of the entities not closed yet
+		open = make(map[string]bool)
+	)
+
+	toggle := func(delimiter string) {
+		if open[delimiter] {
+			delete(open, delimiter)
+		} else {
+			open[delimiter] = true
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		// nothing is formatted in code, the text of links can be
+		case strings.HasPrefix(text[i:], "```"):
+			end := closing(text[i+3:], "```", v2)
+			if end < 0 {
+				return result
+			}
+			i += 3 + end - 1
+		case text[i] == '`':
+			end := closing(text[i+1:], "`", v2)
+			if end < 0 {
+				return result
+			}
+			i += end
+		case text[i] == '[':
+			open["["] = true
+		case text[i] == ']' && open["["]:
+			delete(open, "[")
+			if strings.HasPrefix(text[i+1:], "(") {
+				end := closing(text[i+2:], ")", v2)
+				if end < 0 {
+					return result
+				}
+				i += 1 + end
+			}
+		case v2 && (strings.HasPrefix(text[i:], "__") || strings.HasPrefix(text[i:], "||")):
+			toggle(text[i : i+2])
+			i++
+		case text[i] == '*' || text[i] == '_' || (v2 && text[i] == '~'):
+			toggle(text[i : i+1])
+		case text[i] == '\n':
+			if len(open) == 0 {
+				result = append(result, i)
+			}
+		}
+	}
+
+	return result
+}
+
+// closing returns the offset past the delimiter closing an entity started
+// before text, -1 if there is none. MarkdownV2 escapes delimiters inside
+// entities with a backslash
+func closing(text, delimiter string, escapes bool) int {
+	for i := 0; i < len(text); i++ {
+		if escapes && text[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(text[i:], delimiter) {
+			return i + len(delimiter)
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,242 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramNotifier_render(t *testing.T) {
+	var (
+		notification = &model.Notification{
+			ID:    "abc",
+			Event: "orders.created",
+			Data:  map[string]any{"customer": "Alice"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			marshal    func(v any) ([]byte, error)
+			data       any
+			want       *message
+			wantErrMsg string
+		}{
+			{
+				name: "event-template",
+				config: &Config{
+					ParseMode: ParseModeMarkdownV2,
+					Templates: map[model.EventType]*Template{
+						"orders.created": {Text: "*{{.Data.customer}}* ordered", ParseMode: ParseModeHTML, Silent: true},
+					},
+					Default: &Template{Text: "default"},
+				},
+				want: &message{Text: "*Alice* ordered", ParseMode: ParseModeHTML, DisableNotification: true},
+			},
+			{
+				name:   "config-parse-mode",
+				config: &Config{ParseMode: ParseModeMarkdownV2, Default: &Template{Text: "*{{.ID}}*"}},
+				want:   &message{Text: "*abc*", ParseMode: ParseModeMarkdownV2},
+			},
+			{
+				name:    "json",
+				config:  &Config{ParseMode: ParseModeHTML},
+				marshal: func(v any) ([]byte, error) { return []byte("test-json"), nil },
+				want:    &message{Text: "orders.created\ntest-json"},
+			},
+			{
+				name: "escape-markdownv2",
+				config: &Config{
+					ParseMode: ParseModeMarkdownV2,
+					Default:   &Template{Text: "*{{escape .Data.customer}}* ordered"},
+				},
+				data: map[string]any{"customer": "J.R. *Bob* [Jr]_1-2"},
+				want: &message{Text: `*J\.R\. \*Bob\* \[Jr\]\_1\-2* ordered`, ParseMode: ParseModeMarkdownV2},
+			},
+			{
+				name: "escape-markdown",
+				config: &Config{
+					ParseMode: ParseModeMarkdown,
+					Default:   &Template{Text: "*{{escape .Data.customer}}*"},
+				},
+				data: map[string]any{"customer": "J.R. *Bob* [Jr]_1"},
+				want: &message{Text: `*J.R. \*Bob\* \[Jr]\_1*`, ParseMode: ParseModeMarkdown},
+			},
+			{
+				name: "escape-html",
+				config: &Config{
+					ParseMode: ParseModeMarkdownV2,
+					Default:   &Template{Text: "<b>{{escape .Data.customer}}</b>", ParseMode: ParseModeHTML},
+				},
+				data: map[string]any{"customer": "<Bob> & *Co*"},
+				want: &message{Text: "<b>&lt;Bob&gt; &amp; *Co*</b>", ParseMode: ParseModeHTML},
+			},
+			{
+				name:   "escape-plain",
+				config: &Config{Default: &Template{Text: "{{escape .Data.customer}}"}},
+				data:   map[string]any{"customer": "*Bob*"},
+				want:   &message{Text: "*Bob*"},
+			},
+			{
+				name:       "fail-json",
+				config:     &Config{},
+				marshal:    func(v any) ([]byte, error) { return nil, fmt.Errorf("test-Marshal-error") },
+				wantErrMsg: "test-Marshal-error",
+			},
+			{
+				name:       "fail-text",
+				config:     &Config{Default: &Template{Text: "{{.Data.region}}"}},
+				wantErrMsg: "rendering text",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Token = utils.Secret{Value: "123:test"}
+			n := New(tt.config)
+			if !assert.NoError(t, n.Connect()) {
+				return
+			}
+
+			if tt.marshal != nil {
+				n.jsonMarshal = tt.marshal
+			}
+
+			message := notification
+			if tt.data != nil {
+				message = &model.Notification{ID: notification.ID, Event: notification.Event, Data: tt.data}
+			}
+
+			got, err := n.render(message)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_split(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		max       int
+		want      []string
+		wantOK    bool
+	}{
+		{
+			name:   "short",
+			text:   "hello",
+			max:    10,
+			want:   []string{"hello"},
+			wantOK: true,
+		},
+		{
+			name:   "exact",
+			text:   "0123456789",
+			max:    10,
+			want:   []string{"0123456789"},
+			wantOK: true,
+		},
+		{
+			name:   "lines",
+			text:   "one\ntwo\nthree\nfour",
+			max:    10,
+			want:   []string{"one\ntwo", "three\nfour"},
+			wantOK: true,
+		},
+		{
+			name:   "no-lines",
+			text:   strings.Repeat("x", 25),
+			max:    10,
+			want:   []string{strings.Repeat("x", 10), strings.Repeat("x", 10), strings.Repeat("x", 5)},
+			wantOK: true,
+		},
+		{
+			name:   "multibyte",
+			text:   strings.Repeat("ñ", 15),
+			max:    10,
+			want:   []string{strings.Repeat("ñ", 10), strings.Repeat("ñ", 5)},
+			wantOK: true,
+		},
+		{
+			name:      "html",
+			text:      "<b>one\ntwo</b>\n<i>three</i>\nfour",
+			parseMode: ParseModeHTML,
+			max:       20,
+			want:      []string{"<b>one\ntwo</b>", "<i>three</i>\nfour"},
+			wantOK:    true,
+		},
+		{
+			name:      "html-link",
+			text:      "<a href=\"https://example.com/a>b\">x</a>\nnext line here",
+			parseMode: ParseModeHTML,
+			max:       40,
+			want:      []string{"<a href=\"https://example.com/a>b\">x</a>", "next line here"},
+			wantOK:    true,
+		},
+		{
+			name:      "fail-html-unbalanced",
+			text:      "<pre>one\ntwo\nthree\nfour</pre>",
+			parseMode: ParseModeHTML,
+			max:       20,
+		},
+		{
+			name:      "markdownv2",
+			text:      "*bold\nline*\n_it\\_al_\n||spoiler||\nend",
+			parseMode: ParseModeMarkdownV2,
+			max:       24,
+			want:      []string{"*bold\nline*\n_it\\_al_", "||spoiler||\nend"},
+			wantOK:    true,
+		},
+		{
+			name:      "markdownv2-code",
+			text:      "```\n*a\\```\n```\nafter `b*` and [l](https://x.y/\\)*)\nend",
+			parseMode: ParseModeMarkdownV2,
+			max:       51,
+			want:      []string{"```\n*a\\```\n```\nafter `b*` and [l](https://x.y/\\)*)", "end"},
+			wantOK:    true,
+		},
+		{
+			name:      "markdownv2-underline",
+			text:      "__under\nline__ _x_\nend",
+			parseMode: ParseModeMarkdownV2,
+			max:       20,
+			want:      []string{"__under\nline__ _x_", "end"},
+			wantOK:    true,
+		},
+		{
+			name:      "fail-markdownv2-unbalanced",
+			text:      "*one\ntwo\nthree*",
+			parseMode: ParseModeMarkdownV2,
+			max:       10,
+		},
+		{
+			name:      "markdown",
+			text:      "*one*\n__two__\nthree",
+			parseMode: ParseModeMarkdown,
+			max:       14,
+			want:      []string{"*one*\n__two__", "three"},
+			wantOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := split(tt.text, tt.parseMode, tt.max)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
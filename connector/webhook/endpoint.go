@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"text/template"
+	"unicode"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// errTemplatedHost is reported when the hosts of a templated endpoint can't be
+// restricted by the template itself
+var errTemplatedHost = errors.New("endpoint host is templated without a parent domain, AllowedHosts must be set")
+
+// endpoint holds the parsed templates used to build the target of each request
+type endpoint struct {
+	url *utils.Template
+	// host is matched by the host of rendered endpoints, it's derived from a
+	// templated endpoint unless AllowedHosts restricts them instead
+	host  *regexp.Regexp
+	query map[string]*utils.Template
+	keys  []string
+}
+
+func newEndpoint(config *Config) (*endpoint, error) {
+	switch config.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("unsupported method %q", config.Method)
+	}
+
+	tpl, err := utils.ParseTemplate("endpoint", config.Endpoint, template.FuncMap{"urlvalue": urlValue})
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint template: %w", err)
+	}
+
+	e := &endpoint{
+		url:   tpl,
+		query: make(map[string]*utils.Template, len(config.Query)),
+		keys:  make([]string, 0, len(config.Query)),
+	}
+
+	if utils.IsTemplate(config.Endpoint) {
+		tpl.Escape("urlvalue")
+
+		if len(config.AllowedHosts) == 0 {
+			if e.host, err = hostPattern(config.Endpoint); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for k, v := range config.Query {
+		if e.query[k], err = utils.ParseTemplate(k, v); err != nil {
+			return nil, fmt.Errorf("parsing query parameter %s template: %w", k, err)
+		}
+
+		e.keys = append(e.keys, k)
+	}
+
+	// keep the query string stable between requests
+	sort.Strings(e.keys)
+
+	return e, nil
+}
+
+// Render builds the request URL for the notification
+func (e *endpoint) Render(message *model.Notification) (string, error) {
+	raw, err := e.url.Render(message)
+	if err != nil {
+		return "", fmt.Errorf("rendering endpoint: %w", err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("parsing endpoint: %w", err)
+	}
+
+	if e.host != nil && !e.host.MatchString(u.Host) {
+		return "", fmt.Errorf("endpoint host %q doesn't match the template", u.Host)
+	}
+
+	if len(e.keys) > 0 {
+		q := u.Query()
+		for _, k := range e.keys {
+			v, err := e.query[k].Render(message)
+			if err != nil {
+				return "", fmt.Errorf("rendering query parameter %s: %w", k, err)
+			}
+
+			q.Set(k, v)
+		}
+
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// hostPattern derives the pattern rendered hosts must match from the endpoint
+// template. A literal host must be kept as is, actions in the host must be
+// followed by the parent domain, e.g. https://{{.Data.tenant}}.example.com
+// only reaches subdomains of example.com
+func hostPattern(text string) (*regexp.Regexp, error) {
+	i := strings.Index(text, "://")
+	if i < 0 || utils.IsTemplate(text[:i]) {
+		return nil, errTemplatedHost
+	}
+
+	var (
+		pattern strings.Builder
+		literal strings.Builder
+		actions int
+		rest    = text[i+3:]
+	)
+
+	pattern.WriteString("(?i)^")
+
+	// the host ends at the first delimiter outside of actions
+	for j := 0; j < len(rest) && !strings.ContainsRune("/?#", rune(rest[j])); {
+		if strings.HasPrefix(rest[j:], "{{") {
+			end := strings.Index(rest[j:], "}}")
+			if end < 0 {
+				return nil, errTemplatedHost
+			}
+
+			pattern.WriteString(regexp.QuoteMeta(literal.String()) + ".+")
+			literal.Reset()
+			actions++
+			j += end + 2
+
+			continue
+		}
+
+		literal.WriteByte(rest[j])
+		j++
+	}
+
+	suffix := literal.String()
+	if actions > 0 && (!strings.HasPrefix(suffix, ".") || !strings.Contains(suffix[1:], ".")) {
+		return nil, errTemplatedHost
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(suffix) + "$")
+
+	return regexp.Compile(pattern.String())
+}
+
+// urlValue rejects rendered values that would change the structure of the
+// endpoint, e.g. a tenant "evil.com#" in https://{{.Data.tenant}}.example.com
+// would send the request to evil.com
+func urlValue(v any) (string, error) {
+	s := fmt.Sprint(v)
+
+	if strings.ContainsAny(s, "/?#@:\\%") || strings.IndexFunc(s, unicode.IsSpace) >= 0 || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("value %q not allowed in endpoint", s)
+	}
+
+	return s, nil
+}
+
+// checkURL verifies a rendered URL against the allowed hosts and, when enabled,
+// rejects literal addresses in private ranges
+func (n *WebhookNotifier) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("endpoint has no host")
+	}
+
+	if !n.hostAllowed(host) {
+		return fmt.Errorf("host %q is not allowed", host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && n.BlockPrivateNetworks && isPrivateIP(ip) {
+		return fmt.Errorf("address %s is in a blocked range", ip)
+	}
+
+	return nil
+}
+
+// hostAllowed matches host against AllowedHosts, "*.example.com" matches any subdomain
+func (n *WebhookNotifier) hostAllowed(host string) bool {
+	if len(n.AllowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, allowed := range n.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialControl rejects connections to private ranges after name resolution, so
+// hostnames pointing to internal addresses are blocked too
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return fmt.Errorf("address %s is in a blocked range", ip)
+	}
+
+	return nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified()
+}
@@ -0,0 +1,417 @@
+package webhook
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoint_Render(t *testing.T) {
+	var (
+		message = &model.Notification{
+			ID:    "abc123",
+			Event: model.EventType("order.created"),
+			Data: map[string]interface{}{
+				"tenant":   "acme",
+				"order":    42,
+				"evil":     "evil.com#",
+				"metadata": "169.254.169.254#",
+				"userinfo": "acme.example.com@evil.com",
+				"path":     "../admin?debug=1",
+			},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			want       string
+			wantErrMsg string
+		}{
+			{
+				name:   "success-static",
+				config: &Config{Method: http.MethodPost, Endpoint: "https://hooks.example.com/notify"},
+				want:   "https://hooks.example.com/notify",
+			},
+			{
+				name:   "success-template",
+				config: &Config{Method: http.MethodPut, Endpoint: "https://{{.Data.tenant}}.example.com/hooks/{{.Event}}"},
+				want:   "https://acme.example.com/hooks/order.created",
+			},
+			{
+				name: "success-query",
+				config: &Config{
+					Method:   http.MethodPatch,
+					Endpoint: "https://hooks.example.com/notify?source=notifier",
+					Query: map[string]string{
+						"id":    "{{.ID}}",
+						"order": "{{.Data.order}}",
+					},
+				},
+				want: "https://hooks.example.com/notify?id=abc123&order=42&source=notifier",
+			},
+			{
+				name:   "success-template-port",
+				config: &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.tenant}}.example.com:8443/hooks"},
+				want:   "https://acme.example.com:8443/hooks",
+			},
+			{
+				name: "success-template-allowed-hosts",
+				config: &Config{
+					Method:       http.MethodPost,
+					Endpoint:     "https://{{.Data.tenant}}/hooks",
+					AllowedHosts: []string{"acme"},
+				},
+				want: "https://acme/hooks",
+			},
+			{
+				name:       "fail-host-fragment",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.evil}}.example.com/hooks"},
+				wantErrMsg: `value "evil.com#" not allowed in endpoint`,
+			},
+			{
+				name:       "fail-host-metadata",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.metadata}}.example.com/hooks"},
+				wantErrMsg: `value "169.254.169.254#" not allowed in endpoint`,
+			},
+			{
+				name:       "fail-host-userinfo",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.userinfo}}.example.com/hooks"},
+				wantErrMsg: `value "acme.example.com@evil.com" not allowed in endpoint`,
+			},
+			{
+				name:       "fail-path",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://hooks.example.com/{{.Data.path}}"},
+				wantErrMsg: `value "../admin?debug=1" not allowed in endpoint`,
+			},
+			{
+				name: "fail-allowed-hosts-still-escaped",
+				config: &Config{
+					Method:       http.MethodPost,
+					Endpoint:     "https://{{.Data.evil}}.example.com/hooks",
+					AllowedHosts: []string{"*.example.com"},
+				},
+				wantErrMsg: `value "evil.com#" not allowed in endpoint`,
+			},
+			{
+				name:       "fail-host-without-parent-domain",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.tenant}}/hooks"},
+				wantErrMsg: "AllowedHosts must be set",
+			},
+			{
+				name:       "fail-host-without-separator",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://hooks{{.Data.tenant}}.com/hooks"},
+				wantErrMsg: "AllowedHosts must be set",
+			},
+			{
+				name:       "fail-templated-scheme",
+				config:     &Config{Method: http.MethodPost, Endpoint: "{{.Data.tenant}}://hooks.example.com"},
+				wantErrMsg: "AllowedHosts must be set",
+			},
+			{
+				name:       "fail-method",
+				config:     &Config{Method: http.MethodGet, Endpoint: "https://hooks.example.com/notify"},
+				wantErrMsg: `unsupported method "GET"`,
+			},
+			{
+				name:       "fail-parse-endpoint",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.tenant"},
+				wantErrMsg: "parsing endpoint template:",
+			},
+			{
+				name: "fail-parse-query",
+				config: &Config{
+					Method:   http.MethodPost,
+					Endpoint: "https://hooks.example.com/notify",
+					Query:    map[string]string{"id": "{{.ID"},
+				},
+				wantErrMsg: "parsing query parameter id template:",
+			},
+			{
+				name:       "fail-render-endpoint",
+				config:     &Config{Method: http.MethodPost, Endpoint: "https://{{.Data.region}}.example.com/hooks"},
+				wantErrMsg: "rendering endpoint:",
+			},
+			{
+				name: "fail-render-query",
+				config: &Config{
+					Method:   http.MethodPost,
+					Endpoint: "https://hooks.example.com/notify",
+					Query:    map[string]string{"region": "{{.Data.region}}"},
+				},
+				wantErrMsg: "rendering query parameter region:",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newEndpoint(tt.config)
+			if err == nil {
+				var got string
+				if got, err = e.Render(message); err == nil {
+					assert.Equalf(t, tt.want, got, "Render() = %s, want %s", got, tt.want)
+				}
+			}
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHostPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		match    []string
+		mismatch []string
+	}{
+		{
+			name:     "literal",
+			endpoint: "https://hooks.example.com/{{.Event}}",
+			match:    []string{"hooks.example.com", "HOOKS.example.com"},
+			mismatch: []string{"evil.com", "hooks.example.com.evil.com"},
+		},
+		{
+			name:     "subdomain",
+			endpoint: "https://{{.Data.tenant}}.example.com:8443?id={{.ID}}",
+			match:    []string{"acme.example.com:8443", "eu.acme.example.com:8443"},
+			mismatch: []string{"example.com:8443", "acme.example.com", "evil.com"},
+		},
+		{
+			name:     "prefix",
+			endpoint: "https://hooks-{{.Data.region}}.example.com/notify",
+			match:    []string{"hooks-eu.example.com"},
+			mismatch: []string{"eu.example.com", "hooks-.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := hostPattern(tt.endpoint)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for _, host := range tt.match {
+				assert.Truef(t, re.MatchString(host), "%s doesn't match %s", host, re)
+			}
+
+			for _, host := range tt.mismatch {
+				assert.Falsef(t, re.MatchString(host), "%s matches %s", host, re)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_checkURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		url        string
+		wantErrMsg string
+	}{
+		{
+			name:   "success-allowed-host",
+			config: &Config{AllowedHosts: []string{"hooks.example.com"}},
+			url:    "https://hooks.example.com/notify",
+		},
+		{
+			name:   "success-allowed-wildcard",
+			config: &Config{AllowedHosts: []string{"*.example.com"}},
+			url:    "https://acme.example.com/notify",
+		},
+		{
+			name:   "success-public-address",
+			config: &Config{BlockPrivateNetworks: true},
+			url:    "https://93.184.216.34/notify",
+		},
+		{
+			name:       "fail-wildcard-apex",
+			config:     &Config{AllowedHosts: []string{"*.example.com"}},
+			url:        "https://example.com/notify",
+			wantErrMsg: `host "example.com" is not allowed`,
+		},
+		{
+			name:       "fail-host-not-allowed",
+			config:     &Config{AllowedHosts: []string{"*.example.com"}},
+			url:        "https://acme.example.org/notify",
+			wantErrMsg: `host "acme.example.org" is not allowed`,
+		},
+		{
+			name:       "fail-scheme",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "file:///etc/passwd",
+			wantErrMsg: `unsupported scheme "file"`,
+		},
+		{
+			name:       "fail-no-host",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "http:///notify",
+			wantErrMsg: "endpoint has no host",
+		},
+		{
+			name:       "fail-loopback",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "http://127.0.0.1:8080/notify",
+			wantErrMsg: "address 127.0.0.1 is in a blocked range",
+		},
+		{
+			name:       "fail-private",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "http://10.1.2.3/notify",
+			wantErrMsg: "address 10.1.2.3 is in a blocked range",
+		},
+		{
+			name:       "fail-link-local",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "http://169.254.169.254/latest/meta-data",
+			wantErrMsg: "address 169.254.169.254 is in a blocked range",
+		},
+		{
+			name:       "fail-ipv6-loopback",
+			config:     &Config{BlockPrivateNetworks: true},
+			url:        "http://[::1]/notify",
+			wantErrMsg: "address ::1 is in a blocked range",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				n      = New(tt.config)
+				u, err = url.Parse(tt.url)
+			)
+
+			if assert.NoError(t, err) {
+				err = n.checkURL(u)
+			}
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	assert.NoError(t, dialControl("tcp", "93.184.216.34:443", nil))
+	assert.ErrorContains(t, dialControl("tcp", "192.168.1.10:443", nil), "is in a blocked range")
+	assert.ErrorContains(t, dialControl("tcp6", "[fe80::1]:443", nil), "is in a blocked range")
+	assert.Error(t, dialControl("tcp", "missing-port", nil))
+}
+
+func TestWebhookNotifier_DeliverDynamicEndpoint(t *testing.T) {
+	var (
+		message = &model.Notification{
+			Event: model.EventType("order.created"),
+			Data:  map[string]interface{}{"tenant": "acme", "evil": "evil.com#"},
+		}
+
+		tests = []struct {
+			name       string
+			config     *Config
+			wantMethod string
+			wantURL    string
+			checks     []model.TestCheckResultFn
+		}{
+			{
+				name: "success-put-template",
+				config: &Config{
+					Method:       http.MethodPut,
+					Endpoint:     "https://{{.Data.tenant}}.example.com/hooks",
+					Query:        map[string]string{"event": "{{.Event}}"},
+					AllowedHosts: []string{"*.example.com"},
+				},
+				wantMethod: http.MethodPut,
+				wantURL:    "https://acme.example.com/hooks?event=order.created",
+				checks: model.CheckResult(
+					model.CheckResultError(""),
+				),
+			},
+			{
+				name: "fail-host-not-allowed",
+				config: &Config{
+					Endpoint:     "https://{{.Data.tenant}}.example.org/hooks",
+					AllowedHosts: []string{"*.example.com"},
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(`host "acme.example.org" is not allowed`),
+				),
+			},
+			{
+				name: "fail-host-injection",
+				config: &Config{
+					Endpoint: "https://{{.Data.evil}}.example.com/hooks",
+					Headers:  map[string]string{"X-Api-Key": "secret"},
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(`value "evil.com#" not allowed in endpoint`),
+				),
+			},
+			{
+				name: "fail-render",
+				config: &Config{
+					Endpoint: "https://{{.Data.region}}.example.com/hooks",
+				},
+				checks: model.CheckResult(
+					model.CheckResultError("rendering endpoint:"),
+				),
+			},
+			{
+				name: "fail-invalid-method",
+				config: &Config{
+					Method:   http.MethodDelete,
+					Endpoint: "https://hooks.example.com",
+				},
+				checks: model.CheckResult(
+					model.CheckResultError(`unsupported method "DELETE"`),
+				),
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				n         = New(tt.config)
+				gotMethod string
+				gotURL    string
+			)
+
+			n.client = &mockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					gotMethod = req.Method
+					gotURL = req.URL.String()
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBufferString(`Ok`)),
+					}, nil
+				},
+			}
+
+			r := n.Deliver(message)
+			for _, c := range tt.checks {
+				c(t, n, r)
+			}
+
+			assert.Equal(t, tt.wantMethod, gotMethod)
+			assert.Equal(t, tt.wantURL, gotURL)
+		})
+	}
+}
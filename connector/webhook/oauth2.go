@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExpiryDelta = 10 * time.Second
+
+// OAuth2Config holds the settings to obtain bearer tokens using the OAuth2
+// client-credentials grant
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Audience     string
+	Scopes       []string
+	// CredentialsInBody sends the client credentials as form values instead
+	// of using HTTP basic authentication
+	CredentialsInBody bool
+	// ExpiryDelta is how long before expiration a token is considered stale
+	ExpiryDelta time.Duration
+}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	expiry      time.Time
+}
+
+// tokenSource obtains, caches and refreshes client-credentials tokens
+type tokenSource struct {
+	*OAuth2Config
+	lock  sync.Mutex
+	token *oauth2Token
+	now   func() time.Time
+}
+
+func newTokenSource(config *OAuth2Config) *tokenSource {
+	if config.ExpiryDelta == 0 {
+		config.ExpiryDelta = defaultExpiryDelta
+	}
+
+	return &tokenSource{
+		OAuth2Config: config,
+		now:          time.Now,
+	}
+}
+
+// Token returns the cached token, requesting a new one if there is none or
+// it has expired
+func (s *tokenSource) Token(client HTTPClient) (*oauth2Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.valid() {
+		return s.token, nil
+	}
+
+	token, err := s.fetch(client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = token
+
+	return token, nil
+}
+
+// Invalidate drops the cached token so the next call to Token requests a new one
+func (s *tokenSource) Invalidate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.token = nil
+}
+
+func (s *tokenSource) valid() bool {
+	if s.token == nil {
+		return false
+	}
+
+	if s.token.expiry.IsZero() {
+		return true
+	}
+
+	return s.now().Add(s.ExpiryDelta).Before(s.token.expiry)
+}
+
+func (s *tokenSource) fetch(client HTTPClient) (*oauth2Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	if len(s.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.Scopes, " "))
+	}
+
+	if s.Audience != "" {
+		form.Set("audience", s.Audience)
+	}
+
+	if s.CredentialsInBody {
+		form.Set("client_id", s.ClientID)
+		form.Set("client_secret", s.ClientSecret)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, s.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+
+	if !s.CredentialsInBody {
+		r.SetBasicAuth(url.QueryEscape(s.ClientID), url.QueryEscape(s.ClientSecret))
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading token response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("token endpoint returned non-OK status: %d", resp.StatusCode)
+	}
+
+	token := &oauth2Token{}
+	if err = json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access_token")
+	}
+
+	// some providers answer with a lowercase "bearer"
+	if token.TokenType == "" || strings.EqualFold(token.TokenType, "bearer") {
+		token.TokenType = "Bearer"
+	}
+
+	if token.ExpiresIn > 0 {
+		token.expiry = s.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestTokenSource_Token(t *testing.T) {
+	var (
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		tests = []struct {
+			name       string
+			config     *OAuth2Config
+			before     func(*tokenSource)
+			doFunc     func(*http.Request) (*http.Response, error)
+			wantToken  string
+			wantType   string
+			wantErrMsg string
+			wantCalls  int
+		}{
+			{
+				name: "success-basic-auth",
+				config: &OAuth2Config{
+					TokenURL:     "https://auth.example.com/token",
+					ClientID:     "client",
+					ClientSecret: "secret",
+					Audience:     "https://api.example.com",
+					Scopes:       []string{"hooks.write", "hooks.read"},
+				},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					_ = req.ParseForm()
+					user, pass, ok := req.BasicAuth()
+					if !ok || user != "client" || pass != "secret" {
+						return tokenResponse(http.StatusUnauthorized, ``), nil
+					}
+
+					if req.PostForm.Get("grant_type") != "client_credentials" ||
+						req.PostForm.Get("scope") != "hooks.write hooks.read" ||
+						req.PostForm.Get("audience") != "https://api.example.com" {
+						return tokenResponse(http.StatusBadRequest, ``), nil
+					}
+
+					return tokenResponse(http.StatusOK, `{"access_token":"abc","token_type":"bearer","expires_in":3600}`), nil
+				},
+				wantToken: "abc",
+				wantType:  "Bearer",
+				wantCalls: 1,
+			},
+			{
+				name: "success-credentials-in-body",
+				config: &OAuth2Config{
+					TokenURL:          "https://auth.example.com/token",
+					ClientID:          "client",
+					ClientSecret:      "secret",
+					CredentialsInBody: true,
+				},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					_ = req.ParseForm()
+					if req.PostForm.Get("client_id") != "client" || req.PostForm.Get("client_secret") != "secret" {
+						return tokenResponse(http.StatusUnauthorized, ``), nil
+					}
+
+					return tokenResponse(http.StatusOK, `{"access_token":"abc","token_type":"MAC"}`), nil
+				},
+				wantToken: "abc",
+				wantType:  "MAC",
+				wantCalls: 1,
+			},
+			{
+				name:   "success-cached",
+				config: &OAuth2Config{},
+				before: func(s *tokenSource) {
+					s.token = &oauth2Token{AccessToken: "cached", TokenType: "Bearer", expiry: now.Add(time.Hour)}
+				},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return tokenResponse(http.StatusOK, `{"access_token":"new"}`), nil
+				},
+				wantToken: "cached",
+				wantType:  "Bearer",
+				wantCalls: 0,
+			},
+			{
+				name:   "success-refresh-expired",
+				config: &OAuth2Config{},
+				before: func(s *tokenSource) {
+					// expires within ExpiryDelta
+					s.token = &oauth2Token{AccessToken: "cached", TokenType: "Bearer", expiry: now.Add(5 * time.Second)}
+				},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return tokenResponse(http.StatusOK, `{"access_token":"new","expires_in":60}`), nil
+				},
+				wantToken: "new",
+				wantType:  "Bearer",
+				wantCalls: 1,
+			},
+			{
+				name:   "fail-client-do",
+				config: &OAuth2Config{},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("test-token-do-error")
+				},
+				wantErrMsg: "test-token-do-error",
+				wantCalls:  1,
+			},
+			{
+				name:   "fail-status",
+				config: &OAuth2Config{},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return tokenResponse(http.StatusUnauthorized, `{"error":"invalid_client"}`), nil
+				},
+				wantErrMsg: "token endpoint returned non-OK status: 401",
+				wantCalls:  1,
+			},
+			{
+				name:   "fail-decode",
+				config: &OAuth2Config{},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return tokenResponse(http.StatusOK, `not-json`), nil
+				},
+				wantErrMsg: "decoding token response:",
+				wantCalls:  1,
+			},
+			{
+				name:   "fail-no-access-token",
+				config: &OAuth2Config{},
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					return tokenResponse(http.StatusOK, `{"token_type":"bearer"}`), nil
+				},
+				wantErrMsg: "token response has no access_token",
+				wantCalls:  1,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				calls  int
+				s      = newTokenSource(tt.config)
+				client = &mockHTTPClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						calls++
+						return tt.doFunc(req)
+					},
+				}
+			)
+
+			s.now = func() time.Time { return now }
+
+			if tt.before != nil {
+				tt.before(s)
+			}
+
+			token, err := s.Token(client)
+			assert.Equalf(t, tt.wantCalls, calls, "Token calls = %d, expected %d", calls, tt.wantCalls)
+
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantToken, token.AccessToken)
+				assert.Equal(t, tt.wantType, token.TokenType)
+			}
+		})
+	}
+}
+
+func TestTokenSource_Invalidate(t *testing.T) {
+	var (
+		calls  int
+		s      = newTokenSource(&OAuth2Config{})
+		client = &mockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				calls++
+				return tokenResponse(http.StatusOK, `{"access_token":"abc"}`), nil
+			},
+		}
+	)
+
+	_, _ = s.Token(client)
+	_, _ = s.Token(client)
+	assert.Equalf(t, 1, calls, "Token calls = %d, expected 1", calls)
+
+	s.Invalidate()
+	_, _ = s.Token(client)
+	assert.Equalf(t, 2, calls, "Token calls = %d, expected 2", calls)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 
@@ -19,17 +20,36 @@ type HTTPClient interface {
 }
 
 type Config struct {
-	Logger   *log.Logger
-	Headers  map[string]string
-	Name     string
+	Logger  *log.Logger
+	Headers map[string]string
+	// Query holds query parameters added to the endpoint, values can be templates
+	Query       map[string]string
+	OAuth2      *OAuth2Config
+	Compression *utils.Compression
+	Name        string
+	// Endpoint is the webhook URL, it can be a template rendered with the
+	// notification, e.g. https://{{.Data.tenant}}.example.com/hooks. Rendered
+	// values can't contain URL delimiters and, unless AllowedHosts is set, the
+	// host must keep the literal parent domain of the template
 	Endpoint string
-	Insecure bool
+	// Method is the HTTP method used, one of POST (default), PUT or PATCH
+	Method string
+	// AllowedHosts restricts the hosts requests can be sent to, "*.example.com"
+	// allows any subdomain
+	AllowedHosts []string
+	// BlockPrivateNetworks rejects requests to loopback, private and link-local addresses
+	BlockPrivateNetworks bool
+	Insecure             bool
 }
 
 type WebhookNotifier struct {
 	*Config
 	Channel        chan *model.Notification
 	client         HTTPClient
+	tokenClient    HTTPClient
+	tokens         *tokenSource
+	endpoint       *endpoint
+	endpointErr    error
 	jsonMarshal    func(v any) ([]byte, error)
 	httpNewRequest func(method string, url string, body io.Reader) (*http.Request, error)
 }
@@ -53,8 +73,19 @@ func (n *WebhookNotifier) New(config *Config) *WebhookNotifier {
 		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
 
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+
 	n.Config = config
 	n.Channel = make(chan *model.Notification)
+
+	if config.OAuth2 != nil {
+		n.tokens = newTokenSource(config.OAuth2)
+	}
+
+	n.endpoint, n.endpointErr = newEndpoint(config)
+
 	n.jsonMarshal = json.Marshal
 	n.httpNewRequest = http.NewRequest
 
@@ -70,7 +101,7 @@ func (n *WebhookNotifier) Name() string {
 }
 
 func (n *WebhookNotifier) Connect() error {
-	return nil
+	return n.endpointErr
 }
 
 func (n *WebhookNotifier) Close() error {
@@ -115,22 +146,7 @@ func (n *WebhookNotifier) Deliver(message *model.Notification) *model.Result {
 		return &model.Result{Success: false, Error: err}
 	}
 
-	// Send the POST request to the webhook endpoint
-	r, err := n.httpNewRequest(http.MethodPost, n.Endpoint, bytes.NewBuffer(payload))
-	if err != nil {
-		return &model.Result{Success: false, Error: err}
-	}
-
-	// Ser headers
-	r.Header.Set("Content-Type", "application/json")
-
-	for k, v := range n.Headers {
-		r.Header.Set(k, v)
-	}
-
-	client := n.getClient()
-
-	resp, err := client.Do(r)
+	resp, err := n.Request(message, payload)
 	if err != nil {
 		return &model.Result{Success: false, Error: err}
 	}
@@ -150,17 +166,132 @@ func (n *WebhookNotifier) Deliver(message *model.Notification) *model.Result {
 	return &model.Result{Success: true}
 }
 
+// Request sends a JSON payload built for the notification to the webhook, so
+// connectors with their own payload shapes reuse the endpoint templates,
+// authentication, compression and SSRF safeguards. Checking the status of
+// the response is left to the caller, which must close its body
+func (n *WebhookNotifier) Request(message *model.Notification, payload []byte) (*http.Response, error) {
+	payload, encoding, err := n.Compression.Compress(payload)
+	if err != nil {
+		return nil, fmt.Errorf("compressing payload: %w", err)
+	}
+
+	if n.endpointErr != nil {
+		return nil, n.endpointErr
+	}
+
+	endpoint, err := n.endpoint.Render(message)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.send(endpoint, payload, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token might have been revoked before its expiration, retry once with a fresh one
+	if resp.StatusCode == http.StatusUnauthorized && n.tokens != nil {
+		resp.Body.Close()
+		n.tokens.Invalidate()
+
+		return n.send(endpoint, payload, encoding)
+	}
+
+	return resp, nil
+}
+
+// send builds the request for the payload and sends it to the webhook endpoint
+func (n *WebhookNotifier) send(endpoint string, payload []byte, encoding string) (*http.Response, error) {
+	// Send the request to the webhook endpoint
+	r, err := n.httpNewRequest(n.Method, endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if n.guarded() {
+		if err = n.checkURL(r.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ser headers
+	r.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+
+	for k, v := range n.Headers {
+		r.Header.Set(k, v)
+	}
+
+	if n.tokens != nil {
+		token, err := n.tokens.Token(n.getTokenClient())
+		if err != nil {
+			return nil, fmt.Errorf("obtaining oauth2 token: %w", err)
+		}
+
+		r.Header.Set("Authorization", token.TokenType+" "+token.AccessToken)
+	}
+
+	return n.getClient().Do(r)
+}
+
 func (n *WebhookNotifier) getClient() HTTPClient {
 	if n.client != nil {
 		return n.client
 	}
 
-	n.client = &http.Client{}
+	client := &http.Client{}
+	if n.Insecure || n.BlockPrivateNetworks {
+		transport := &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: n.Insecure},
+		}
+
+		if n.BlockPrivateNetworks {
+			transport.DialContext = (&net.Dialer{Control: dialControl}).DialContext
+		}
+
+		client.Transport = transport
+	}
+
+	// redirects must comply with the same restrictions as the endpoint
+	if n.guarded() {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+
+			return n.checkURL(req.URL)
+		}
+	}
+
+	n.client = client
+
+	return n.client
+}
+
+// getTokenClient returns the client used to request OAuth2 tokens, the
+// TokenURL is configured rather than rendered from notifications, so the SSRF
+// safeguards don't apply and identity providers in private networks work
+func (n *WebhookNotifier) getTokenClient() HTTPClient {
+	if n.tokenClient != nil {
+		return n.tokenClient
+	}
+
+	client := &http.Client{}
 	if n.Insecure {
-		n.client.(*http.Client).Transport = &http.Transport{
+		client.Transport = &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
 	}
 
-	return n.client
+	n.tokenClient = client
+
+	return n.tokenClient
+}
+
+// guarded tells if requests must be checked against SSRF safeguards
+func (n *WebhookNotifier) guarded() bool {
+	return len(n.AllowedHosts) > 0 || n.BlockPrivateNetworks
 }
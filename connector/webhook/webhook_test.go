@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -215,6 +216,10 @@ func TestWebhookNotifier_Connect(t *testing.T) {
 	d := New(&Config{})
 	got := d.Connect()
 	assert.Nilf(t, got, "Connect() = %v, want nil", got)
+
+	d = New(&Config{Method: http.MethodGet})
+	got = d.Connect()
+	assert.ErrorContainsf(t, got, "unsupported method", "Connect() = %v, want unsupported method", got)
 }
 
 func TestWebhookNotifier_Close(t *testing.T) {
@@ -393,6 +398,115 @@ func TestWebhookNotifier_Deliver(t *testing.T) {
 				model.CheckResultError(""),
 			),
 		},
+		{
+			name: "compression-error",
+			config: &Config{
+				Endpoint:    "http://localhost:8080/webhook",
+				Compression: &utils.Compression{Encoding: "br"},
+			},
+			checks: model.CheckResult(
+				model.CheckResultError(`compressing payload: unsupported encoding "br"`),
+			),
+		},
+		{
+			name: "compression-gzip",
+			config: &Config{
+				Endpoint:    "http://localhost:8080/webhook",
+				Compression: &utils.Compression{Encoding: utils.EncodingGzip},
+			},
+			message: &model.Notification{
+				Event: model.EventType("test-event"),
+				Data:  "test-data",
+			},
+			before: func(n *WebhookNotifier) {
+				n.client = &mockHTTPClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if req.Header.Get("Content-Encoding") != utils.EncodingGzip {
+							return tokenResponse(http.StatusBadRequest, `missing Content-Encoding`), nil
+						}
+
+						body, _ := io.ReadAll(req.Body)
+						if plain, err := utils.Decompress(utils.EncodingGzip, body); err != nil || !bytes.Contains(plain, []byte("test-data")) {
+							return tokenResponse(http.StatusBadRequest, `invalid body`), nil
+						}
+
+						return tokenResponse(http.StatusOK, `Ok`), nil
+					},
+				}
+			},
+			checks: model.CheckResult(
+				model.CheckResultError(""),
+			),
+		},
+		{
+			name: "oauth2-token-error",
+			config: &Config{
+				Endpoint: "http://localhost:8080/webhook",
+				OAuth2:   &OAuth2Config{TokenURL: "http://localhost:8080/token"},
+			},
+			before: func(n *WebhookNotifier) {
+				n.tokenClient = &mockHTTPClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						return tokenResponse(http.StatusBadRequest, `{"error":"invalid_client"}`), nil
+					},
+				}
+			},
+			checks: model.CheckResult(
+				model.CheckResultError("obtaining oauth2 token: token endpoint returned non-OK status: 400"),
+			),
+		},
+		{
+			name: "oauth2-retry-on-unauthorized",
+			config: &Config{
+				Endpoint: "http://localhost:8080/webhook",
+				OAuth2:   &OAuth2Config{TokenURL: "http://localhost:8080/token"},
+			},
+			before: func(n *WebhookNotifier) {
+				var tokens int
+
+				n.client = &mockHTTPClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if req.URL.Path == "/token" {
+							tokens++
+							return tokenResponse(http.StatusOK, fmt.Sprintf(`{"access_token":"token-%d"}`, tokens)), nil
+						}
+
+						// only the refreshed token is accepted
+						if req.Header.Get("Authorization") != "Bearer token-2" {
+							return tokenResponse(http.StatusUnauthorized, `Unauthorized`), nil
+						}
+
+						return tokenResponse(http.StatusOK, `Ok`), nil
+					},
+				}
+				n.tokenClient = n.client
+			},
+			checks: model.CheckResult(
+				model.CheckResultError(""),
+			),
+		},
+		{
+			name: "oauth2-unauthorized-after-retry",
+			config: &Config{
+				Endpoint: "http://localhost:8080/webhook",
+				OAuth2:   &OAuth2Config{TokenURL: "http://localhost:8080/token"},
+			},
+			before: func(n *WebhookNotifier) {
+				n.client = &mockHTTPClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if req.URL.Path == "/token" {
+							return tokenResponse(http.StatusOK, `{"access_token":"abc"}`), nil
+						}
+
+						return tokenResponse(http.StatusUnauthorized, `Unauthorized`), nil
+					},
+				}
+				n.tokenClient = n.client
+			},
+			checks: model.CheckResult(
+				model.CheckResultError("webhook returned non-OK status: 401"),
+			),
+		},
 	}
 
 	for _, tt := range tests {
@@ -441,6 +555,20 @@ func TestWebhookNotifier_getClient(t *testing.T) {
 			}
 		}
 
+		checkClientGuarded = func() model.TestCheckNotifierFn {
+			return func(t *testing.T, np model.Notifier) {
+				t.Helper()
+				var (
+					n, _      = np.(*WebhookNotifier)
+					client    = n.client.(*http.Client)
+					transport = client.Transport.(*http.Transport)
+				)
+
+				assert.NotNilf(t, transport.DialContext, "getClient DialContext is nil, expected to be set")
+				assert.NotNilf(t, client.CheckRedirect, "getClient CheckRedirect is nil, expected to be set")
+			}
+		}
+
 		tests = []struct {
 			name   string
 			config *Config
@@ -477,6 +605,18 @@ func TestWebhookNotifier_getClient(t *testing.T) {
 					checkClientInsecure(true),
 				),
 			},
+			{
+				name:   "block-private-networks-client",
+				config: &Config{BlockPrivateNetworks: true},
+				before: func(n *WebhookNotifier) {
+					n.client = nil
+				},
+				checks: model.CheckNotifier(
+					checkClientType(&http.Client{}),
+					checkClientInsecure(false),
+					checkClientGuarded(),
+				),
+			},
 		}
 	)
 	for _, tt := range tests {
@@ -497,6 +637,52 @@ func TestWebhookNotifier_getClient(t *testing.T) {
 	}
 }
 
+func TestWebhookNotifier_getTokenClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *Config
+		wantInsecure bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:   "block-private-networks",
+			config: &Config{BlockPrivateNetworks: true, AllowedHosts: []string{"hooks.example.com"}},
+		},
+		{
+			name:         "insecure",
+			config:       &Config{Insecure: true, BlockPrivateNetworks: true},
+			wantInsecure: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(tt.config)
+
+			client, ok := n.getTokenClient().(*http.Client)
+			if !assert.True(t, ok, "getTokenClient type = %T, expected *http.Client", n.tokenClient) {
+				return
+			}
+
+			// the identity provider isn't subject to the webhook safeguards
+			assert.Nil(t, client.CheckRedirect)
+			assert.NotSame(t, n.getClient(), client)
+
+			if !tt.wantInsecure {
+				assert.Nil(t, client.Transport)
+				return
+			}
+
+			transport := client.Transport.(*http.Transport)
+			assert.Nil(t, transport.DialContext)
+			assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+		})
+	}
+}
+
 func TestWebhookNotifier_Run(t *testing.T) {
 	var (
 		buf    bytes.Buffer
@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/padiazg/notifier/model"
 	"github.com/padiazg/notifier/utils"
@@ -69,6 +70,10 @@ func (e *Engine) Dispatch(message *model.Notification) {
 		message.ID = utils.RandomId(utils.ID12)
 	}
 
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
 	if len(message.Channels) == 0 {
 		e.dispatchAll(message)
 	} else {
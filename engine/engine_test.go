@@ -104,6 +104,19 @@ func notificationHasId() notificationCheckFn {
 	}
 }
 
+func notificationHasTimestamp() notificationCheckFn {
+	return func(t *testing.T, e *Engine, n *model.Notification) {
+		t.Helper()
+		for _, nt := range e.notifiers {
+			data := nt.(*dummy.DummyNotifier).First()
+			assert.NotNilf(t, data, "notificationHasTimestamp not found, expected at least one")
+			if data != nil {
+				assert.Falsef(t, data.Timestamp.IsZero(), "notificationHasTimestamp Timestamp is zero, expected to be set")
+			}
+		}
+	}
+}
+
 func TestNewEngine(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -268,6 +281,7 @@ func TestEngine_Dispatch(t *testing.T) {
 			},
 			checks: checkNotifications(
 				notificationHasId(),
+				notificationHasTimestamp(),
 			),
 		},
 		{
@@ -3,75 +3,59 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"log"
-	"time"
+	"os"
+	"os/signal"
 
-	"github.com/Azure/go-amqp"
-	n "github.com/padiazg/notifier/notification"
+	n "github.com/padiazg/notifier/model"
+	ra "github.com/padiazg/notifier/receiver/amqp"
 )
 
 func main() {
 	var (
-		ctx       = context.TODO()
-		conn, err = amqp.Dial(context.TODO(), "amqp:localhost", nil)
+		protocol = flag.String("protocol", "1.0", "AMQP protocol, 1.0 or 0.9.1")
+		address  = flag.String("address", "amqp://localhost", "AMQP server URL")
+		queue    = flag.String("queue", "notifier", "queue to consume from")
+		prefetch = flag.Int("prefetch", 10, "messages sent ahead by the server")
+		workers  = flag.Int("workers", 4, "messages handled at once")
+		source   ra.Source
+		err      error
 	)
 
-	if err != nil {
-		log.Fatal("Dialing AMQP server:", err)
-	}
-	defer conn.Close()
+	flag.Parse()
 
-	session, err := conn.NewSession(context.TODO(), nil)
-	if err != nil {
-		log.Fatal("Creating AMQP session:", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
+	switch *protocol {
+	case "0.9.1":
+		source, err = ra.DialAMQP09(&ra.AMQP09Options{Address: *address, Queue: *queue, Prefetch: *prefetch})
+	default:
+		source, err = ra.DialAMQP10(ctx, &ra.AMQP10Options{Address: *address, Queue: *queue, Prefetch: int32(*prefetch)})
 	}
 
-	{
-		// create a receiver
-		receiver, err := session.NewReceiver(ctx, "notifier", &amqp.ReceiverOptions{
-			SourceDurability: amqp.DurabilityUnsettledState,
-		})
-		if err != nil {
-			log.Fatal("Creating receiver link:", err)
-		}
-
-		defer func() {
-			ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
-			receiver.Close(ctx)
-			cancel()
-		}()
-
-		log.Printf("Connected to queue\n")
-
-		for {
-			// receive next message
-			msg, err := receiver.Receive(ctx, nil)
-			if err != nil {
-				log.Printf("Reading message from AMQP: %v\n", err)
-			}
-
-			// accept message
-			if err = receiver.AcceptMessage(context.TODO(), msg); err != nil {
-				log.Printf("Failure accepting message: %v", err)
-			}
-
-			// Parse the incoming JSON payload
-			var notification n.Notification
-			err = json.Unmarshal(msg.GetData(), &notification)
-			if err != nil {
-				log.Printf("Failed to decode JSON payload: %v", err)
-				return
-			}
+	if err != nil {
+		log.Fatal("Connecting to queue: ", err)
+	}
+	defer source.Close()
 
+	consumer := ra.New(source, &ra.Config{
+		Concurrency: *workers,
+		Default: func(ctx context.Context, notification *n.Notification) error {
 			formated, err := json.MarshalIndent(notification, "", "  ")
 			if err != nil {
-				log.Printf("Failed to format payload: %v", err)
-				return
+				return err
 			}
 
 			log.Printf("Message received: %s\n", formated)
-		}
-	}
+			return nil
+		},
+	})
 
+	log.Printf("Consuming from %s over AMQP %s\n", *queue, *protocol)
+
+	if err := consumer.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
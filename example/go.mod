@@ -4,10 +4,16 @@ go 1.20
 
 replace github.com/padiazg/notifier => ../
 
-require github.com/padiazg/notifier v0.0.0-00010101000000-000000000000
+require (
+	github.com/Azure/go-amqp v1.0.2
+	github.com/padiazg/notifier v0.0.0-00010101000000-000000000000
+)
 
 require (
-	github.com/Azure/go-amqp v1.0.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/google/uuid v1.3.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rabbitmq/amqp091-go v1.8.1 // indirect
+	github.com/stretchr/testify v1.8.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
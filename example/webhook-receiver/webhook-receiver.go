@@ -7,7 +7,8 @@ import (
 	"net/http"
 	"os"
 
-	n "github.com/padiazg/notifier/notification"
+	n "github.com/padiazg/notifier/model"
+	rw "github.com/padiazg/notifier/receiver/webhook"
 )
 
 func handleWebhook(w http.ResponseWriter, r *http.Request) {
@@ -53,12 +54,12 @@ func main() {
 
 	server := &http.Server{
 		Addr:    ":4000",
-		Handler: mux,
+		Handler: rw.Decompress(mux),
 	}
 
 	serverTLS := &http.Server{
 		Addr:    ":4443",
-		Handler: mux,
+		Handler: rw.Decompress(mux),
 	}
 
 	go func() {
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // EventType represents the possible event types
 type EventType string
 
@@ -9,10 +11,20 @@ type Notification struct {
 	Event    EventType
 	Data     interface{}
 	Channels []string
+	// Timestamp is when the event happened, set on dispatch if empty
+	Timestamp time.Time
+	// CorrelationID relates the notification to a request or another notification
+	CorrelationID string
+	// Metadata holds custom attributes delivered along with the notification,
+	// e.g. as message headers, so consumers can route without parsing the body
+	Metadata map[string]string
 }
 
 // Result represents the result of sending a notification
 type Result struct {
 	Error   error
 	Success bool
+	// Acknowledged tells the receiving end confirmed the delivery, as opposed
+	// to the notification being handed over without a confirmation
+	Acknowledged bool
 }
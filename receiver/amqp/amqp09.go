@@ -0,0 +1,105 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/padiazg/notifier/utils"
+	amqp09 "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQP09Options sets where to consume from with AMQP 0.9.1
+type AMQP09Options struct {
+	// Address is the server URL, amqps:// uses TLS
+	Address string
+	Queue   string
+	// ConsumerTag identifies the consumer, generated by the server if not set
+	ConsumerTag string
+	// Prefetch is how many unacknowledged messages the server sends ahead
+	Prefetch int
+	TLS      *utils.TLSOptions
+}
+
+// amqp09Source consumes from a channel, its deliveries are settled on it
+type amqp09Source struct {
+	conn       *amqp09.Connection
+	deliveries <-chan amqp09.Delivery
+}
+
+var _ Source = (*amqp09Source)(nil)
+
+// DialAMQP09 connects to the server and starts consuming from the queue
+func DialAMQP09(options *AMQP09Options) (Source, error) {
+	tlsConfig, err := options.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	conn, err := amqp09.DialTLS(options.Address, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("dialing AMQP server: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("creating AMQP channel: %w", err)
+	}
+
+	if options.Prefetch > 0 {
+		if err := channel.Qos(options.Prefetch, 0, false); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("setting prefetch: %w", err)
+		}
+	}
+
+	deliveries, err := channel.Consume(options.Queue, options.ConsumerTag, false, false, false, false, nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("consuming from %s: %w", options.Queue, err)
+	}
+
+	return &amqp09Source{conn: conn, deliveries: deliveries}, nil
+}
+
+func (s *amqp09Source) Receive(ctx context.Context) (Delivery, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case d, ok := <-s.deliveries:
+		if !ok {
+			return nil, errors.New("channel closed")
+		}
+
+		return &amqp09Delivery{delivery: d}, nil
+	}
+}
+
+func (s *amqp09Source) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+type amqp09Delivery struct {
+	delivery amqp09.Delivery
+}
+
+func (d *amqp09Delivery) Data() []byte {
+	return d.delivery.Body
+}
+
+func (d *amqp09Delivery) Encoding() string {
+	return d.delivery.ContentEncoding
+}
+
+func (d *amqp09Delivery) Ack(ctx context.Context) error {
+	return d.delivery.Ack(false)
+}
+
+func (d *amqp09Delivery) Reject(ctx context.Context, requeue bool) error {
+	return d.delivery.Reject(requeue)
+}
@@ -0,0 +1,56 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	amqp09 "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAcknowledger records the settlement of each delivery tag
+type fakeAcknowledger struct {
+	settled chan string
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled <- fmt.Sprintf("ack %d", tag)
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.settled <- fmt.Sprintf("nack %d %v", tag, requeue)
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.settled <- fmt.Sprintf("reject %d %v", tag, requeue)
+	return nil
+}
+
+func TestAMQP09Source(t *testing.T) {
+	var (
+		deliveries    = make(chan amqp09.Delivery, 3)
+		ack           = &fakeAcknowledger{settled: make(chan string, 3)}
+		source        = &amqp09Source{deliveries: deliveries}
+		gzipped, _, _ = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress([]byte(`{"Event":"orders.created"}`))
+		c             = New(source, nil)
+	)
+
+	c.Handle("orders.created", func(context.Context, *model.Notification) error { return nil })
+	c.Handle("orders.failed", func(context.Context, *model.Notification) error { return Requeue(fmt.Errorf("test-error")) })
+
+	deliveries <- amqp09.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: gzipped, ContentEncoding: utils.EncodingGzip}
+	deliveries <- amqp09.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: []byte(`{"Event":"orders.failed"}`)}
+	deliveries <- amqp09.Delivery{Acknowledger: ack, DeliveryTag: 3, Body: []byte(`{`)}
+	close(deliveries)
+
+	assert.ErrorContains(t, c.Run(context.TODO()), "receiving message: channel closed")
+	assert.Equal(t, "ack 1", <-ack.settled)
+	assert.Equal(t, "reject 2 true", <-ack.settled)
+	assert.Equal(t, "reject 3 false", <-ack.settled)
+	assert.NoError(t, source.Close())
+}
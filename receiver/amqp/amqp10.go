@@ -0,0 +1,126 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+
+	amqp10 "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/utils"
+)
+
+// AMQP10Options sets where to consume from with AMQP 1.0
+type AMQP10Options struct {
+	// Address is the server URL, amqps:// uses TLS
+	Address string
+	Queue   string
+	// Prefetch is the link credit, how many messages the server sends ahead
+	Prefetch    int32
+	TLS         *utils.TLSOptions
+	ConnOptions *amqp10.ConnOptions
+}
+
+// amqp10Receiver is the part of *amqp.Receiver used to consume
+type amqp10Receiver interface {
+	Receive(ctx context.Context, opts *amqp10.ReceiveOptions) (*amqp10.Message, error)
+	AcceptMessage(ctx context.Context, msg *amqp10.Message) error
+	RejectMessage(ctx context.Context, msg *amqp10.Message, e *amqp10.Error) error
+	ReleaseMessage(ctx context.Context, msg *amqp10.Message) error
+	Close(ctx context.Context) error
+}
+
+// amqp10Source consumes with a receiver link, its deliveries are settled on it
+type amqp10Source struct {
+	conn     *amqp10.Conn
+	receiver amqp10Receiver
+}
+
+var _ Source = (*amqp10Source)(nil)
+
+// DialAMQP10 connects to the server and attaches a receiver link to the queue
+func DialAMQP10(ctx context.Context, options *AMQP10Options) (Source, error) {
+	opts := amqp10.ConnOptions{}
+	if options.ConnOptions != nil {
+		opts = *options.ConnOptions
+	}
+
+	if options.TLS != nil {
+		tlsConfig, err := options.TLS.Config()
+		if err != nil {
+			return nil, fmt.Errorf("configuring TLS: %w", err)
+		}
+
+		opts.TLSConfig = tlsConfig
+	}
+
+	conn, err := amqp10.Dial(ctx, options.Address, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("dialing AMQP server: %w", err)
+	}
+
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("creating AMQP session: %w", err)
+	}
+
+	receiver, err := session.NewReceiver(ctx, options.Queue, &amqp10.ReceiverOptions{
+		Credit:           options.Prefetch,
+		SourceDurability: amqp10.DurabilityUnsettledState,
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("creating receiver link: %w", err)
+	}
+
+	return &amqp10Source{conn: conn, receiver: receiver}, nil
+}
+
+func (s *amqp10Source) Receive(ctx context.Context) (Delivery, error) {
+	msg, err := s.receiver.Receive(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &amqp10Delivery{receiver: s.receiver, msg: msg}, nil
+}
+
+func (s *amqp10Source) Close() error {
+	_ = s.receiver.Close(context.TODO())
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+type amqp10Delivery struct {
+	receiver amqp10Receiver
+	msg      *amqp10.Message
+}
+
+func (d *amqp10Delivery) Data() []byte {
+	return d.msg.GetData()
+}
+
+func (d *amqp10Delivery) Encoding() string {
+	if d.msg.Properties == nil || d.msg.Properties.ContentEncoding == nil {
+		return ""
+	}
+
+	return *d.msg.Properties.ContentEncoding
+}
+
+func (d *amqp10Delivery) Ack(ctx context.Context) error {
+	return d.receiver.AcceptMessage(ctx, d.msg)
+}
+
+// Reject releases the message to be delivered again when requeued, otherwise
+// it's rejected and dead-lettered if the broker is set to
+func (d *amqp10Delivery) Reject(ctx context.Context, requeue bool) error {
+	if requeue {
+		return d.receiver.ReleaseMessage(ctx, d.msg)
+	}
+
+	return d.receiver.RejectMessage(ctx, d.msg, nil)
+}
@@ -0,0 +1,80 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	amqp10 "github.com/Azure/go-amqp"
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReceiver hands out the messages sent to it and records their settlement
+type fakeReceiver struct {
+	messages chan *amqp10.Message
+	settled  chan string
+	closed   bool
+}
+
+func (r *fakeReceiver) Receive(ctx context.Context, opts *amqp10.ReceiveOptions) (*amqp10.Message, error) {
+	msg, ok := <-r.messages
+	if !ok {
+		return nil, &amqp10.LinkError{}
+	}
+
+	return msg, nil
+}
+
+func (r *fakeReceiver) AcceptMessage(ctx context.Context, msg *amqp10.Message) error {
+	r.settled <- "accept " + msg.Properties.MessageID.(string)
+	return nil
+}
+
+func (r *fakeReceiver) RejectMessage(ctx context.Context, msg *amqp10.Message, e *amqp10.Error) error {
+	r.settled <- "reject " + msg.Properties.MessageID.(string)
+	return nil
+}
+
+func (r *fakeReceiver) ReleaseMessage(ctx context.Context, msg *amqp10.Message) error {
+	r.settled <- "release " + msg.Properties.MessageID.(string)
+	return nil
+}
+
+func (r *fakeReceiver) Close(ctx context.Context) error {
+	r.closed = true
+	return nil
+}
+
+func TestAMQP10Source(t *testing.T) {
+	var (
+		receiver      = &fakeReceiver{messages: make(chan *amqp10.Message, 3), settled: make(chan string, 3)}
+		source        = &amqp10Source{receiver: receiver}
+		gzipped, _, _ = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress([]byte(`{"Event":"orders.created"}`))
+		encoding      = utils.EncodingGzip
+		c             = New(source, nil)
+	)
+
+	c.Handle("orders.created", func(context.Context, *model.Notification) error { return nil })
+	c.Handle("orders.failed", func(context.Context, *model.Notification) error { return Requeue(fmt.Errorf("test-error")) })
+
+	message := func(id string, data []byte, encoding *string) *amqp10.Message {
+		msg := amqp10.NewMessage(data)
+		msg.Properties = &amqp10.MessageProperties{MessageID: id, ContentEncoding: encoding}
+		return msg
+	}
+
+	receiver.messages <- message("1", gzipped, &encoding)
+	receiver.messages <- message("2", []byte(`{"Event":"orders.failed"}`), nil)
+	receiver.messages <- message("3", []byte(`{`), nil)
+	close(receiver.messages)
+
+	assert.ErrorContains(t, c.Run(context.TODO()), "receiving message")
+	assert.Equal(t, "accept 1", <-receiver.settled)
+	assert.Equal(t, "release 2", <-receiver.settled)
+	assert.Equal(t, "reject 3", <-receiver.settled)
+
+	assert.NoError(t, source.Close())
+	assert.True(t, receiver.closed)
+}
@@ -0,0 +1,246 @@
+package amqp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+)
+
+// Handler processes a notification. Returning nil acknowledges the message,
+// an error rejects it unless wrapped with Requeue
+type Handler func(ctx context.Context, notification *model.Notification) error
+
+// Delivery is a message received from a queue, settled once handled
+type Delivery interface {
+	// Data is the message body, compressed as told by Encoding
+	Data() []byte
+	Encoding() string
+	Ack(ctx context.Context) error
+	// Reject discards the message, dead-lettering it if the broker is set to,
+	// or puts it back in the queue
+	Reject(ctx context.Context, requeue bool) error
+}
+
+// Source receives the messages of a queue
+type Source interface {
+	// Receive waits for the next message until ctx is done
+	Receive(ctx context.Context) (Delivery, error)
+	Close() error
+}
+
+// requeueError asks for the message to be requeued
+type requeueError struct {
+	err error
+}
+
+func (e *requeueError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.err
+}
+
+// Requeue wraps an error returned by a handler so the message is put back in
+// the queue to be retried, instead of rejected
+func Requeue(err error) error {
+	return &requeueError{err: err}
+}
+
+// DefaultMaxBodySize is the size limit of decompressed message bodies, the
+// same as the webhook receiver's
+const DefaultMaxBodySize = 10 << 20
+
+type Config struct {
+	Logger *log.Logger
+	// Handlers maps event types to the handler of their notifications
+	Handlers map[model.EventType]Handler
+	// Default handles the events not in Handlers, they are rejected if not set
+	Default Handler
+	// Concurrency is how many messages are handled at once, 1 if not set. The
+	// prefetch of the source should be at least this
+	Concurrency int
+	// MaxBodySize rejects messages whose decompressed body is larger, so small
+	// payloads can't inflate into huge ones, DefaultMaxBodySize if not set
+	MaxBodySize int64
+}
+
+// Consumer decodes the messages of a source into notifications and
+// dispatches them to the handlers
+type Consumer struct {
+	*Config
+	source Source
+}
+
+func New(source Source, config *Config) *Consumer {
+	if config == nil {
+		config = &Config{}
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	if config.Handlers == nil {
+		config.Handlers = make(map[model.EventType]Handler)
+	}
+
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+
+	return &Consumer{Config: config, source: source}
+}
+
+// Handle sets the handler of an event type, it must be called before Run
+func (c *Consumer) Handle(event model.EventType, handler Handler) {
+	c.Handlers[event] = handler
+}
+
+// Run consumes messages until ctx is done or the source fails, waiting for
+// the messages being handled before returning
+func (c *Consumer) Run(ctx context.Context) error {
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, c.Concurrency)
+	)
+
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+
+		delivery, err := c.source.Receive(ctx)
+		if err != nil {
+			<-slots
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("receiving message: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			c.handle(ctx, delivery)
+		}()
+	}
+}
+
+// handle decodes the message, dispatches it and settles it with the result
+func (c *Consumer) handle(ctx context.Context, delivery Delivery) {
+	notification, err := c.decode(delivery)
+	if err != nil {
+		c.Logger.Printf("rejecting message: %v", err)
+		c.settle(delivery, false, err)
+		return
+	}
+
+	handler, ok := c.Handlers[notification.Event]
+	if !ok {
+		handler = c.Default
+	}
+
+	if handler == nil {
+		err = fmt.Errorf("no handler for event %s", notification.Event)
+		c.Logger.Printf("rejecting notification %s: %v", notification.ID, err)
+		c.settle(delivery, false, err)
+		return
+	}
+
+	err = c.call(ctx, handler, notification)
+	if err == nil {
+		c.settle(delivery, false, nil)
+		return
+	}
+
+	var requeue *requeueError
+	if errors.As(err, &requeue) {
+		c.Logger.Printf("requeueing notification %s: %v", notification.ID, err)
+		c.settle(delivery, true, err)
+		return
+	}
+
+	c.Logger.Printf("rejecting notification %s: %v", notification.ID, err)
+	c.settle(delivery, false, err)
+}
+
+// call runs the handler, a panic rejects the message instead of stopping the
+// consumer
+func (c *Consumer) call(ctx context.Context, handler Handler, notification *model.Notification) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, notification)
+}
+
+// settle acknowledges the message if handled, otherwise rejects it. Messages
+// are settled even after Run was cancelled so they aren't handled twice
+func (c *Consumer) settle(delivery Delivery, requeue bool, handled error) {
+	var (
+		ctx = context.TODO()
+		err error
+	)
+
+	if handled == nil {
+		err = delivery.Ack(ctx)
+	} else {
+		err = delivery.Reject(ctx, requeue)
+	}
+
+	if err != nil {
+		c.Logger.Printf("settling message: %v", err)
+	}
+}
+
+// decode decompresses the body of the message and parses the notification
+func (c *Consumer) decode(delivery Delivery) (*model.Notification, error) {
+	r, err := utils.NewDecompressReader(delivery.Encoding(), bytes.NewReader(delivery.Data()))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing payload: %w", err)
+	}
+	defer r.Close()
+
+	// one byte more tells if the body is over the limit
+	data, err := io.ReadAll(io.LimitReader(r, c.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing payload: %w", err)
+	}
+
+	if int64(len(data)) > c.MaxBodySize {
+		return nil, fmt.Errorf("payload larger than %d bytes", c.MaxBodySize)
+	}
+
+	notification := &model.Notification{}
+	if err := json.Unmarshal(data, notification); err != nil {
+		return nil, fmt.Errorf("decoding notification: %w", err)
+	}
+
+	return notification, nil
+}
@@ -0,0 +1,271 @@
+package amqp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/padiazg/notifier/model"
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDelivery records how it was settled
+type fakeDelivery struct {
+	data     []byte
+	encoding string
+	settled  chan string
+}
+
+func (d *fakeDelivery) Data() []byte {
+	return d.data
+}
+
+func (d *fakeDelivery) Encoding() string {
+	return d.encoding
+}
+
+func (d *fakeDelivery) Ack(ctx context.Context) error {
+	d.settled <- "ack"
+	return nil
+}
+
+func (d *fakeDelivery) Reject(ctx context.Context, requeue bool) error {
+	if requeue {
+		d.settled <- "requeue"
+	} else {
+		d.settled <- "reject"
+	}
+
+	return nil
+}
+
+// fakeSource hands out the deliveries sent to it
+type fakeSource struct {
+	deliveries chan Delivery
+	err        error
+}
+
+func (s *fakeSource) Receive(ctx context.Context) (Delivery, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case d, ok := <-s.deliveries:
+		if !ok {
+			return nil, s.err
+		}
+		return d, nil
+	}
+}
+
+func (s *fakeSource) Close() error {
+	return nil
+}
+
+func TestConsumer_handle(t *testing.T) {
+	var (
+		gzipped, _, _ = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress([]byte(`{"ID":"1","Event":"orders.created"}`))
+		// a small message inflating into a large one
+		bomb, _, _ = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress([]byte(`{"ID":"1","Event":"orders.created","Data":"` + strings.Repeat("a", 1024) + `"}`))
+
+		tests = []struct {
+			name     string
+			data     []byte
+			encoding string
+			handlers map[model.EventType]Handler
+			fallback Handler
+			maxSize  int64
+			want     string
+			wantLog  string
+		}{
+			{
+				name:     "ack",
+				data:     []byte(`{"ID":"1","Event":"orders.created","Data":"test"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return nil }},
+				want:     "ack",
+			},
+			{
+				name:     "compressed",
+				data:     gzipped,
+				encoding: utils.EncodingGzip,
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return nil }},
+				want:     "ack",
+			},
+			{
+				name:     "compressed-within-limit",
+				data:     gzipped,
+				encoding: utils.EncodingGzip,
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return nil }},
+				maxSize:  35,
+				want:     "ack",
+			},
+			{
+				name:     "reject-too-large",
+				data:     bomb,
+				encoding: utils.EncodingGzip,
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return nil }},
+				maxSize:  1024,
+				want:     "reject",
+				wantLog:  "rejecting message: payload larger than 1024 bytes",
+			},
+			{
+				name:     "reject-too-large-uncompressed",
+				data:     []byte(`{"ID":"1","Event":"orders.created"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return nil }},
+				maxSize:  34,
+				want:     "reject",
+				wantLog:  "rejecting message: payload larger than 34 bytes",
+			},
+			{
+				name:     "default",
+				data:     []byte(`{"ID":"1","Event":"users.deleted"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error { return fmt.Errorf("wrong handler") }},
+				fallback: func(context.Context, *model.Notification) error { return nil },
+				want:     "ack",
+			},
+			{
+				name:    "reject-no-handler",
+				data:    []byte(`{"ID":"1","Event":"users.deleted"}`),
+				want:    "reject",
+				wantLog: "rejecting notification 1: no handler for event users.deleted",
+			},
+			{
+				name: "reject-error",
+				data: []byte(`{"ID":"1","Event":"orders.created"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error {
+					return fmt.Errorf("test-Handler-error")
+				}},
+				want:    "reject",
+				wantLog: "rejecting notification 1: test-Handler-error",
+			},
+			{
+				name: "requeue",
+				data: []byte(`{"ID":"1","Event":"orders.created"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error {
+					return fmt.Errorf("retrying: %w", Requeue(fmt.Errorf("test-Handler-error")))
+				}},
+				want:    "requeue",
+				wantLog: "requeueing notification 1: retrying: test-Handler-error",
+			},
+			{
+				name: "reject-panic",
+				data: []byte(`{"ID":"1","Event":"orders.created"}`),
+				handlers: map[model.EventType]Handler{"orders.created": func(context.Context, *model.Notification) error {
+					panic("test-panic")
+				}},
+				want:    "reject",
+				wantLog: "handler panic: test-panic",
+			},
+			{
+				name:    "reject-malformed",
+				data:    []byte(`{"ID":`),
+				want:    "reject",
+				wantLog: "rejecting message: decoding notification",
+			},
+			{
+				name:     "reject-corrupt",
+				data:     []byte(`not gzip`),
+				encoding: utils.EncodingGzip,
+				want:     "reject",
+				wantLog:  "rejecting message: decompressing payload",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				buf = bytes.Buffer{}
+				c   = New(&fakeSource{}, &Config{
+					Handlers:    tt.handlers,
+					Default:     tt.fallback,
+					MaxBodySize: tt.maxSize,
+					Logger:      log.New(&buf, "test:", log.LstdFlags),
+				})
+				d = &fakeDelivery{data: tt.data, encoding: tt.encoding, settled: make(chan string, 1)}
+			)
+
+			c.handle(context.TODO(), d)
+
+			assert.Equal(t, tt.want, <-d.settled)
+			assert.Contains(t, buf.String(), tt.wantLog)
+		})
+	}
+}
+
+func TestConsumer_Run(t *testing.T) {
+	var (
+		source  = &fakeSource{deliveries: make(chan Delivery)}
+		c       = New(source, &Config{Concurrency: 2})
+		running sync.WaitGroup
+		release = make(chan struct{})
+		lock    sync.Mutex
+		active  int
+		maxSeen int
+	)
+
+	c.Handle("orders.created", func(ctx context.Context, n *model.Notification) error {
+		lock.Lock()
+		active++
+		if active > maxSeen {
+			maxSeen = active
+		}
+		lock.Unlock()
+
+		running.Done()
+		<-release
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	settled := make(chan string, 3)
+	running.Add(2)
+	for i := 0; i < 2; i++ {
+		source.deliveries <- &fakeDelivery{data: []byte(`{"Event":"orders.created"}`), settled: settled}
+	}
+	running.Wait()
+
+	// a third message waits for a free slot
+	select {
+	case source.deliveries <- &fakeDelivery{}:
+		t.Fatal("message received over the concurrency limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// cancelling waits for the messages being handled, which are acknowledged
+	cancel()
+	close(release)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after cancelled")
+	}
+
+	assert.Equal(t, 2, maxSeen)
+	assert.Equal(t, "ack", <-settled)
+	assert.Equal(t, "ack", <-settled)
+}
+
+func TestConsumer_RunSourceError(t *testing.T) {
+	source := &fakeSource{deliveries: make(chan Delivery), err: fmt.Errorf("test-Receive-error")}
+	close(source.deliveries)
+
+	err := New(source, nil).Run(context.TODO())
+	assert.ErrorContains(t, err, "receiving message: test-Receive-error")
+}
@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/padiazg/notifier/utils"
+)
+
+// DefaultMaxBodySize is the size limit of decompressed bodies of Decompress
+const DefaultMaxBodySize = 10 << 20
+
+// Decompress wraps next so request bodies sent compressed by the webhook
+// connector are transparently decompressed, up to DefaultMaxBodySize bytes
+func Decompress(next http.Handler) http.Handler {
+	return DecompressLimit(next, DefaultMaxBodySize)
+}
+
+// DecompressLimit is like Decompress, reading decompressed bodies larger
+// than maxBytes fails with an *http.MaxBytesError so small payloads can't
+// inflate into huge ones
+func DecompressLimit(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := utils.NewDecompressReader(encoding, r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("decompressing body: %v", err), http.StatusUnsupportedMediaType)
+			return
+		}
+		defer body.Close()
+
+		r.Body = http.MaxBytesReader(w, body, maxBytes)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/padiazg/notifier/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress(t *testing.T) {
+	var (
+		plain         = []byte(`{"ID":"abc","Event":"test-event","Data":"test-data"}`)
+		gzipped, _, _ = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress(plain)
+		bomb, _, _    = (&utils.Compression{Encoding: utils.EncodingGzip}).Compress(make([]byte, 1<<20))
+
+		tests = []struct {
+			name       string
+			encoding   string
+			body       []byte
+			maxBytes   int64
+			wantStatus int
+			wantBody   []byte
+			wantErrMsg string
+		}{
+			{
+				name:       "plain",
+				body:       plain,
+				wantStatus: http.StatusOK,
+				wantBody:   plain,
+			},
+			{
+				name:       "gzip",
+				encoding:   utils.EncodingGzip,
+				body:       gzipped,
+				wantStatus: http.StatusOK,
+				wantBody:   plain,
+			},
+			{
+				name:       "fail-too-large",
+				encoding:   utils.EncodingGzip,
+				body:       bomb,
+				maxBytes:   1024,
+				wantStatus: http.StatusOK,
+				wantBody:   make([]byte, 1024),
+				wantErrMsg: "http: request body too large",
+			},
+			{
+				name:       "fail-corrupt",
+				encoding:   utils.EncodingGzip,
+				body:       plain,
+				wantStatus: http.StatusUnsupportedMediaType,
+			},
+			{
+				name:       "fail-unsupported",
+				encoding:   "br",
+				body:       plain,
+				wantStatus: http.StatusUnsupportedMediaType,
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got     []byte
+				readErr error
+				next    = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got, readErr = io.ReadAll(r.Body)
+					assert.Empty(t, r.Header.Get("Content-Encoding"))
+				})
+				handler = Decompress(next)
+				req     = httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(tt.body))
+				rec     = httptest.NewRecorder()
+			)
+
+			if tt.maxBytes > 0 {
+				handler = DecompressLimit(next, tt.maxBytes)
+			}
+
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != nil {
+				assert.Equal(t, tt.wantBody, got)
+			}
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, readErr, tt.wantErrMsg)
+			} else {
+				assert.NoError(t, readErr)
+			}
+		})
+	}
+}
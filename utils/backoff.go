@@ -0,0 +1,54 @@
+package utils
+
+import "time"
+
+const (
+	DefaultBackoffInitial = 500 * time.Millisecond
+	DefaultBackoffMax     = 30 * time.Second
+)
+
+// Backoff computes exponentially growing wait intervals between retries
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	attempt int
+}
+
+// Next returns the interval to wait before the next attempt
+func (b *Backoff) Next() time.Duration {
+	var (
+		initial = b.Initial
+		max     = b.Max
+	)
+
+	if initial <= 0 {
+		initial = DefaultBackoffInitial
+	}
+
+	if max <= 0 {
+		max = DefaultBackoffMax
+	}
+
+	wait := initial
+	for i := 0; i < b.attempt && wait < max; i++ {
+		wait *= 2
+	}
+
+	b.attempt++
+
+	if wait > max {
+		return max
+	}
+
+	return wait
+}
+
+// Attempts returns how many intervals have been handed out since the last Reset
+func (b *Backoff) Attempts() int {
+	return b.attempt
+}
+
+// Reset starts the sequence again from the initial interval
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
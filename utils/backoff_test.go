@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff *Backoff
+		want    []time.Duration
+	}{
+		{
+			name:    "defaults",
+			backoff: &Backoff{},
+			want:    []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second},
+		},
+		{
+			name:    "capped",
+			backoff: &Backoff{Initial: 100 * time.Millisecond, Max: 300 * time.Millisecond},
+			want:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				got := tt.backoff.Next()
+				assert.Equalf(t, want, got, "Next() #%d = %v, want %v", i, got, want)
+			}
+
+			assert.Equal(t, len(tt.want), tt.backoff.Attempts())
+
+			tt.backoff.Reset()
+			assert.Equal(t, 0, tt.backoff.Attempts())
+			assert.Equal(t, tt.want[0], tt.backoff.Next())
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// Compression configures the optional compression of outgoing payloads
+type Compression struct {
+	// Encoding is the algorithm used, EncodingGzip or EncodingDeflate
+	Encoding string
+	// MinSize is the payload size in bytes from which payloads are compressed
+	MinSize int
+	// Level is the compression level, flate.DefaultCompression if nil, use
+	// CompressionLevel to set it
+	Level *int
+}
+
+// CompressionLevel returns a pointer to level for Compression.Level, so
+// flate.NoCompression can be told apart from an unset level
+func CompressionLevel(level int) *int {
+	return &level
+}
+
+// Compress compresses payload when it reaches MinSize, it returns the
+// resulting payload and the content encoding applied, empty if none
+func (c *Compression) Compress(payload []byte) ([]byte, string, error) {
+	if c == nil || c.Encoding == "" || len(payload) < c.MinSize {
+		return payload, "", nil
+	}
+
+	var (
+		buf   bytes.Buffer
+		w     io.WriteCloser
+		err   error
+		level = flate.DefaultCompression
+	)
+
+	if c.Level != nil {
+		level = *c.Level
+	}
+
+	switch c.Encoding {
+	case EncodingGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case EncodingDeflate:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	default:
+		return nil, "", fmt.Errorf("unsupported encoding %q", c.Encoding)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err = w.Write(payload); err != nil {
+		return nil, "", err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), c.Encoding, nil
+}
+
+// Decompress reverses Compress given the content encoding of data, data with
+// no encoding is returned as is
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	r, err := NewDecompressReader(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// NewDecompressReader wraps r to decompress it according to encoding
+func NewDecompressReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingDeflate:
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
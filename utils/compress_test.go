@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression_Compress(t *testing.T) {
+	var (
+		payload = bytes.Repeat([]byte(`{"event":"audit","diff":"abcdef"}`), 64)
+
+		tests = []struct {
+			name         string
+			compression  *Compression
+			wantEncoding string
+			wantStored   bool
+			wantErrMsg   string
+		}{
+			{
+				name:        "nil-compression",
+				compression: nil,
+			},
+			{
+				name:        "below-min-size",
+				compression: &Compression{Encoding: EncodingGzip, MinSize: len(payload) + 1},
+			},
+			{
+				name:         "gzip",
+				compression:  &Compression{Encoding: EncodingGzip, MinSize: 1024},
+				wantEncoding: EncodingGzip,
+			},
+			{
+				name:         "deflate",
+				compression:  &Compression{Encoding: EncodingDeflate, Level: CompressionLevel(flate.BestCompression)},
+				wantEncoding: EncodingDeflate,
+			},
+			{
+				name:         "no-compression",
+				compression:  &Compression{Encoding: EncodingGzip, Level: CompressionLevel(flate.NoCompression)},
+				wantEncoding: EncodingGzip,
+				wantStored:   true,
+			},
+			{
+				name:        "fail-encoding",
+				compression: &Compression{Encoding: "br"},
+				wantErrMsg:  `unsupported encoding "br"`,
+			},
+			{
+				name:        "fail-level",
+				compression: &Compression{Encoding: EncodingGzip, Level: CompressionLevel(42)},
+				wantErrMsg:  "invalid compression level",
+			},
+		}
+	)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding, err := tt.compression.Compress(payload)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.wantEncoding, encoding, "Compress() encoding = %s, want %s", encoding, tt.wantEncoding)
+
+			if tt.wantEncoding == "" {
+				assert.Equal(t, payload, got)
+				return
+			}
+
+			// stored blocks only add the framing
+			if tt.wantStored {
+				assert.Greater(t, len(got), len(payload))
+			} else {
+				assert.Less(t, len(got), len(payload))
+			}
+
+			plain, err := Decompress(encoding, got)
+			if assert.NoError(t, err) {
+				assert.Equal(t, payload, plain)
+			}
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	got, err := Decompress("", []byte("plain"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("plain"), got)
+
+	_, err = Decompress(EncodingGzip, []byte("not-gzip"))
+	assert.Error(t, err)
+
+	_, err = Decompress("br", []byte("data"))
+	assert.ErrorContains(t, err, `unsupported encoding "br"`)
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RateLimitedError is returned by the sends given to RetryRateLimited when the
+// server asks to wait before sending again
+type RateLimitedError struct {
+	// Wait is how long the server asked to wait, 1 second if not positive
+	Wait time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.Wait)
+}
+
+// RetryRateLimited calls send until it isn't rate limited, sleeping the wait
+// told by the server in between, at most maxRetries times
+func RetryRateLimited(maxRetries int, sleep func(d time.Duration), send func() error) error {
+	for attempt := 0; ; attempt++ {
+		var (
+			err     = send()
+			limited *RateLimitedError
+		)
+
+		if !errors.As(err, &limited) {
+			return err
+		}
+
+		if attempt >= maxRetries {
+			return fmt.Errorf("rate limited, gave up after %d retries", attempt)
+		}
+
+		wait := limited.Wait
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		sleep(wait)
+	}
+}
+
+// RetryAfter parses the seconds of a Retry-After header, 0 if missing
+func RetryAfter(header string) time.Duration {
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// UnwrapURLError drops the method and URL from the errors of an http.Client,
+// so secrets held in the URL don't end up in the results and logs
+func UnwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
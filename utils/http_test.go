@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryRateLimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		results    []error
+		wantSends  int
+		wantSleeps []time.Duration
+		wantErrMsg string
+	}{
+		{
+			name:      "success",
+			results:   []error{nil},
+			wantSends: 1,
+		},
+		{
+			name:       "retried",
+			maxRetries: 3,
+			results:    []error{&RateLimitedError{Wait: 2 * time.Second}, &RateLimitedError{}, nil},
+			wantSends:  3,
+			wantSleeps: []time.Duration{2 * time.Second, time.Second},
+		},
+		{
+			name:       "fail-gave-up",
+			maxRetries: 1,
+			results:    []error{&RateLimitedError{Wait: time.Second}, &RateLimitedError{Wait: time.Second}},
+			wantSends:  2,
+			wantSleeps: []time.Duration{time.Second},
+			wantErrMsg: "rate limited, gave up after 1 retries",
+		},
+		{
+			name:       "fail-no-retries",
+			maxRetries: -1,
+			results:    []error{&RateLimitedError{Wait: time.Second}},
+			wantSends:  1,
+			wantErrMsg: "rate limited, gave up after 0 retries",
+		},
+		{
+			name:       "fail-send",
+			maxRetries: 3,
+			results:    []error{fmt.Errorf("sending: %w", errors.New("refused"))},
+			wantSends:  1,
+			wantErrMsg: "sending: refused",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				sends  int
+				sleeps []time.Duration
+			)
+
+			err := RetryRateLimited(tt.maxRetries, func(d time.Duration) { sleeps = append(sleeps, d) }, func() error {
+				err := tt.results[sends]
+				sends++
+				return err
+			})
+
+			assert.Equal(t, tt.wantSends, sends)
+			assert.Equal(t, tt.wantSleeps, sleeps)
+
+			if tt.wantErrMsg != "" {
+				assert.EqualError(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, RetryAfter("2"))
+	assert.Equal(t, 250*time.Millisecond, RetryAfter("0.25"))
+	assert.Equal(t, time.Duration(0), RetryAfter(""))
+	assert.Equal(t, time.Duration(0), RetryAfter("-1"))
+	assert.Equal(t, time.Duration(0), RetryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
+
+func TestUnwrapURLError(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	err := UnwrapURLError(&url.Error{Op: "Post", URL: "https://example.com/secret", Err: refused})
+	assert.Equal(t, refused, err)
+	assert.NotContains(t, err.Error(), "secret")
+
+	assert.Equal(t, refused, UnwrapURLError(refused))
+	assert.Nil(t, UnwrapURLError(nil))
+}
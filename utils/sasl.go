@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SASL mechanisms supported by the connectors
+const (
+	SASLPlain     = "PLAIN"
+	SASLExternal  = "EXTERNAL"
+	SASLAnonymous = "ANONYMOUS"
+	SASLLogin     = "LOGIN"
+)
+
+// Secret is a value given inline, read from a file or from an environment
+// variable, so credentials don't need to be embedded in addresses
+type Secret struct {
+	Value string
+	// File is read when Value is empty, trailing new lines are removed
+	File string
+	// Env is looked up when Value and File are empty
+	Env string
+}
+
+// Resolve returns the value of the secret, nothing is cached so connectors
+// resolve it every time they connect or send and pick up rotated secrets
+func (s Secret) Resolve() (string, error) {
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", s.Env)
+		}
+		return value, nil
+	default:
+		return "", nil
+	}
+}
+
+// SASL configures how a client authenticates to the server
+type SASL struct {
+	// Mechanism is one of SASLPlain, SASLExternal, SASLAnonymous or SASLLogin,
+	// PLAIN if empty. Connectors report the mechanisms they don't support
+	Mechanism string
+	Username  Secret
+	Password  Secret
+}
+
+// Credentials resolves the mechanism, and the username and password for PLAIN
+// and LOGIN
+func (s *SASL) Credentials() (mechanism, username, password string, err error) {
+	mechanism = strings.ToUpper(s.Mechanism)
+	if mechanism == "" {
+		mechanism = SASLPlain
+	}
+
+	switch mechanism {
+	case SASLExternal, SASLAnonymous:
+		return mechanism, "", "", nil
+	case SASLPlain, SASLLogin:
+	default:
+		return "", "", "", fmt.Errorf("unsupported SASL mechanism %q", s.Mechanism)
+	}
+
+	if username, err = s.Username.Resolve(); err != nil {
+		return "", "", "", fmt.Errorf("resolving username: %w", err)
+	}
+
+	if password, err = s.Password.Resolve(); err != nil {
+		return "", "", "", fmt.Errorf("resolving password: %w", err)
+	}
+
+	return mechanism, username, password, nil
+}
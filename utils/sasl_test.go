@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret_Resolve(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		file = filepath.Join(dir, "password")
+	)
+
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("NOTIFIER_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name       string
+		secret     Secret
+		want       string
+		wantErrMsg string
+	}{
+		{name: "empty", secret: Secret{}, want: ""},
+		{name: "value", secret: Secret{Value: "inline", File: file}, want: "inline"},
+		{name: "file", secret: Secret{File: file, Env: "NOTIFIER_TEST_SECRET"}, want: "from-file"},
+		{name: "env", secret: Secret{Env: "NOTIFIER_TEST_SECRET"}, want: "from-env"},
+		{name: "fail-file", secret: Secret{File: filepath.Join(dir, "missing")}, wantErrMsg: "reading secret file"},
+		{name: "fail-env", secret: Secret{Env: "NOTIFIER_TEST_MISSING"}, wantErrMsg: "environment variable NOTIFIER_TEST_MISSING not set"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.secret.Resolve()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.want, got, "Resolve() = %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestSASL_Credentials(t *testing.T) {
+	t.Setenv("NOTIFIER_TEST_PASSWORD", "secret")
+
+	tests := []struct {
+		name          string
+		sasl          *SASL
+		wantMechanism string
+		wantUsername  string
+		wantPassword  string
+		wantErrMsg    string
+	}{
+		{
+			name:          "plain-default",
+			sasl:          &SASL{Username: Secret{Value: "guest"}, Password: Secret{Env: "NOTIFIER_TEST_PASSWORD"}},
+			wantMechanism: SASLPlain,
+			wantUsername:  "guest",
+			wantPassword:  "secret",
+		},
+		{
+			name:          "external",
+			sasl:          &SASL{Mechanism: "external", Username: Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wantMechanism: SASLExternal,
+		},
+		{
+			name:          "anonymous",
+			sasl:          &SASL{Mechanism: SASLAnonymous},
+			wantMechanism: SASLAnonymous,
+		},
+		{
+			name:          "login",
+			sasl:          &SASL{Mechanism: "login", Username: Secret{Value: "guest"}, Password: Secret{Value: "guest"}},
+			wantMechanism: SASLLogin,
+			wantUsername:  "guest",
+			wantPassword:  "guest",
+		},
+		{
+			name:       "fail-mechanism",
+			sasl:       &SASL{Mechanism: "SCRAM-SHA-256"},
+			wantErrMsg: `unsupported SASL mechanism "SCRAM-SHA-256"`,
+		},
+		{
+			name:       "fail-username",
+			sasl:       &SASL{Username: Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wantErrMsg: "resolving username",
+		},
+		{
+			name:       "fail-password",
+			sasl:       &SASL{Username: Secret{Value: "guest"}, Password: Secret{Env: "NOTIFIER_TEST_MISSING"}},
+			wantErrMsg: "resolving password",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mechanism, username, password, err := tt.sasl.Credentials()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMechanism, mechanism)
+			assert.Equal(t, tt.wantUsername, username)
+			assert.Equal(t, tt.wantPassword, password)
+		})
+	}
+}
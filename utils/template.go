@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a text template rendered against a notification, e.g.
+// "https://{{.Data.tenant}}.example.com/hooks"
+type Template struct {
+	text string
+	tpl  *template.Template
+}
+
+// funcs are available to every template, json quotes a value so templates
+// building JSON payloads stay valid, e.g. {"text": {{json .Data.summary}}}
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// ParseTemplate parses text as a template, missing map keys are reported as
+// errors. The extra funcs are added to the ones available to every template
+func ParseTemplate(name, text string, extra ...template.FuncMap) (*Template, error) {
+	tpl := template.New(name).Option("missingkey=error").Funcs(funcs)
+	for _, f := range extra {
+		tpl = tpl.Funcs(f)
+	}
+
+	tpl, err := tpl.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{text: text, tpl: tpl}, nil
+}
+
+// IsTemplate tells if text contains template actions
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// Escape pipes the output of every action through the named func, which must
+// be one of the extra funcs given to ParseTemplate, so the rendered values can
+// be escaped or rejected, e.g. {{.Data.tenant}} is run as {{.Data.tenant | name}}
+func (t *Template) Escape(name string) {
+	escape(t.tpl.Tree, t.tpl.Tree.Root, name)
+}
+
+func escape(tree *parse.Tree, node parse.Node, name string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, child := range n.Nodes {
+			escape(tree, child, name)
+		}
+	case *parse.ActionNode:
+		// declarations don't print anything
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escape(tree, n.List, name)
+		escape(tree, n.ElseList, name)
+	case *parse.RangeNode:
+		escape(tree, n.List, name)
+		escape(tree, n.ElseList, name)
+	case *parse.WithNode:
+		escape(tree, n.List, name)
+		escape(tree, n.ElseList, name)
+	}
+}
+
+// Render executes the template with data and returns the result
+func (t *Template) Render(data any) (string, error) {
+	var sb strings.Builder
+
+	if err := t.tpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// String returns the source text of the template
+func (t *Template) String() string {
+	return t.text
+}
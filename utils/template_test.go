@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	type notification struct {
+		Event string
+		Data  interface{}
+	}
+
+	tests := []struct {
+		name          string
+		text          string
+		funcs         template.FuncMap
+		data          any
+		want          string
+		wantParseErr  bool
+		wantRenderErr bool
+	}{
+		{
+			name: "success-map-data",
+			text: "https://{{.Data.tenant}}.example.com/hooks",
+			data: notification{Data: map[string]interface{}{"tenant": "acme"}},
+			want: "https://acme.example.com/hooks",
+		},
+		{
+			name: "success-no-actions",
+			text: "orders.created",
+			data: notification{},
+			want: "orders.created",
+		},
+		{
+			name: "success-json",
+			text: `{"text": {{json .Data.summary}}}`,
+			data: notification{Data: map[string]interface{}{"summary": "say \"hi\"\n"}},
+			want: `{"text": "say \"hi\"\n"}`,
+		},
+		{
+			name:  "success-extra-funcs",
+			text:  "{{upper .Event}}",
+			funcs: template.FuncMap{"upper": strings.ToUpper},
+			data:  notification{Event: "orders.created"},
+			want:  "ORDERS.CREATED",
+		},
+		{
+			name:         "fail-parse",
+			text:         "{{.Event",
+			wantParseErr: true,
+		},
+		{
+			name:          "fail-missing-key",
+			text:          "{{.Data.tenant}}",
+			data:          notification{Data: map[string]interface{}{}},
+			wantRenderErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := ParseTemplate(tt.name, tt.text, tt.funcs)
+			if tt.wantParseErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.text, tpl.String())
+
+			got, err := tpl.Render(tt.data)
+			if tt.wantRenderErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.want, got, "Render() = %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestTemplate_Escape(t *testing.T) {
+	var (
+		funcs = template.FuncMap{
+			"quote": func(v any) string { return fmt.Sprintf("[%v]", v) },
+		}
+		data = map[string]any{"a": "x", "b": []string{"y", "z"}}
+	)
+
+	tpl, err := ParseTemplate("escape", `{{.a}}-{{$v := .a}}{{$v}}{{if .a}}{{.a}}{{end}}{{range .b}}{{.}}{{else}}none{{end}}`, funcs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tpl.Escape("quote")
+
+	got, err := tpl.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "[x]-[x][x][y][z]", got)
+}
+
+func TestIsTemplate(t *testing.T) {
+	assert.True(t, IsTemplate("notify.{{.Event}}"))
+	assert.False(t, IsTemplate("notify.orders"))
+}
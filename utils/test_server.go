@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestServer records the requests it receives and answers with the queued
+// responses, or with the fallback once there are none left
+type TestServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	requests  []*http.Request
+	bodies    [][]byte
+	fallback  func(w http.ResponseWriter, count int)
+	responses []func(w http.ResponseWriter)
+}
+
+// NewTestServer starts a TestServer closed when the test ends, fallback gets
+// how many requests have been received so far
+func NewTestServer(t *testing.T, fallback func(w http.ResponseWriter, count int), responses ...func(w http.ResponseWriter)) *TestServer {
+	t.Helper()
+
+	s := &TestServer{fallback: fallback, responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *TestServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body)
+
+	if len(s.responses) > 0 {
+		respond := s.responses[0]
+		s.responses = s.responses[1:]
+		respond(w)
+		return
+	}
+
+	s.fallback(w, len(s.requests))
+}
+
+// Requests returns the requests received so far
+func (s *TestServer) Requests() []*http.Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// DecodeBody unmarshals the JSON body of the i-th request, counting from the
+// end when negative
+func (s *TestServer) DecodeBody(i int, v any) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if i < 0 {
+		i += len(s.bodies)
+	}
+
+	if i < 0 || i >= len(s.bodies) {
+		return fmt.Errorf("no request %d, got %d", i, len(s.bodies))
+	}
+
+	return json.Unmarshal(s.bodies[i], v)
+}
+
+// TestRateLimited answers 429 with the Retry-After header, when not empty,
+// and the body
+func TestRateLimited(header, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if header != "" {
+			w.Header().Set("Retry-After", header)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, body)
+	}
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestServer(t *testing.T) {
+	server := NewTestServer(t,
+		func(w http.ResponseWriter, count int) { fmt.Fprintf(w, `{"n": %d}`, count) },
+		TestRateLimited("2", `{"retry_after": 2}`),
+	)
+
+	post := func(body string) (int, string, string) {
+		t.Helper()
+
+		resp, err := http.Post(server.URL+"/hook", "application/json", strings.NewReader(body))
+		if !assert.NoError(t, err) {
+			return 0, "", ""
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Retry-After"), string(data)
+	}
+
+	status, header, body := post(`{"a": 1}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, "2", header)
+	assert.Equal(t, `{"retry_after": 2}`, body)
+
+	status, _, body = post(`{"a": 2}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"n": 2}`, body)
+
+	assert.Len(t, server.Requests(), 2)
+	assert.Equal(t, "/hook", server.Requests()[0].URL.Path)
+
+	var got map[string]int
+	assert.NoError(t, server.DecodeBody(-1, &got))
+	assert.Equal(t, map[string]int{"a": 2}, got)
+	assert.NoError(t, server.DecodeBody(0, &got))
+	assert.Equal(t, map[string]int{"a": 1}, got)
+	assert.ErrorContains(t, server.DecodeBody(2, &got), "no request 2")
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures the TLS connection to a server
+type TLSOptions struct {
+	// CAFile is a PEM bundle with the certificate authorities trusted to verify
+	// the server, the system pool is used if empty
+	CAFile string
+	// CertFile and KeyFile hold the PEM client certificate and its key, used
+	// by servers authenticating clients with certificates
+	CertFile string
+	KeyFile  string
+	// ServerName verifies the server certificate against another host name
+	// than the one in the address
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Config builds the tls.Config, nil if no options are set
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
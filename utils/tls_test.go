@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key as PEM files
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "notifier-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSOptions_Config(t *testing.T) {
+	var (
+		dir               = t.TempDir()
+		certFile, keyFile = writeCertificate(t, dir)
+		emptyFile         = filepath.Join(dir, "empty.pem")
+	)
+
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		options    *TLSOptions
+		wantNil    bool
+		wantCAs    bool
+		wantCerts  int
+		wantErrMsg string
+	}{
+		{
+			name:    "nil-options",
+			options: nil,
+			wantNil: true,
+		},
+		{
+			name:    "server-name",
+			options: &TLSOptions{ServerName: "broker.internal"},
+		},
+		{
+			name:      "ca-and-client-certificate",
+			options:   &TLSOptions{CAFile: certFile, CertFile: certFile, KeyFile: keyFile},
+			wantCAs:   true,
+			wantCerts: 1,
+		},
+		{
+			name:       "fail-ca-missing",
+			options:    &TLSOptions{CAFile: filepath.Join(dir, "missing.pem")},
+			wantErrMsg: "reading CA file",
+		},
+		{
+			name:       "fail-ca-empty",
+			options:    &TLSOptions{CAFile: emptyFile},
+			wantErrMsg: "no certificates found in CA file",
+		},
+		{
+			name:       "fail-key-missing",
+			options:    &TLSOptions{CertFile: certFile},
+			wantErrMsg: "loading client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.Config()
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.Equal(t, tt.options.ServerName, got.ServerName)
+			assert.Equal(t, tt.wantCAs, got.RootCAs != nil)
+			assert.Len(t, got.Certificates, tt.wantCerts)
+		})
+	}
+}